@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/alert"
+	"github.com/nightness333/k8s-monitor/pkg/notify"
+	"github.com/nightness333/k8s-monitor/pkg/storage"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+var alertsCmd = &cobra.Command{
+	Use:   "alerts",
+	Short: "Проверяет правила алертинга на сохранённых метриках",
+	Long: `Прогоняет сохранённую историю через правила алертинга так же, как monitor
+на каждом замере, и выводит переходы алертов (pending, firing, resolved).
+Позволяет отладить правила без доступа к кластеру.`,
+	Run: runAlertsCommand,
+}
+
+func init() {
+	rootCmd.AddCommand(alertsCmd)
+	addReadFlags(alertsCmd)
+	alertsCmd.Flags().StringP("file", "f", "/data/output.csv", "Файл с метриками")
+	alertsCmd.Flags().String("rules", "", "Файл правил алертинга (YAML/JSON)")
+	alertsCmd.Flags().StringP("last", "l", "", "Проверять только данные за период (1h, 24h); по умолчанию — вся история")
+	alertsCmd.Flags().String("notify", "", "Файл получателей уведомлений: отправлять переходы алертов, как это делает monitor")
+	alertsCmd.MarkFlagRequired("rules")
+}
+
+func runAlertsCommand(cmd *cobra.Command, args []string) {
+	path, _ := cmd.Flags().GetString("rules")
+	rules, err := alert.Load(path)
+	if err != nil {
+		fmt.Printf("Ошибка: %v\n", err)
+		os.Exit(1)
+	}
+
+	var q storage.Query
+	if last, _ := cmd.Flags().GetString("last"); last != "" {
+		duration, err := time.ParseDuration(last)
+		if err != nil {
+			fmt.Printf("Ошибка: неверный формат периода: %v\n", err)
+			os.Exit(1)
+		}
+		q.From = time.Now().Add(-duration)
+	}
+
+	engine := alert.NewEngine(rules)
+	nodes := make(map[int64][]types.NodeMetric)
+	if engine.UsesNodes() {
+		err := scanNodes(cmd, q, func(n types.NodeMetric) error {
+			nodes[n.Timestamp.UnixNano()] = append(nodes[n.Timestamp.UnixNano()], n)
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Ошибка чтения данных узлов: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var notifier *notify.Dispatcher
+	if path, _ := cmd.Flags().GetString("notify"); path != "" {
+		config, err := notify.Load(path)
+		if err != nil {
+			fmt.Printf("Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+		notifier = notify.NewDispatcher(config)
+	}
+
+	// Rows of one tick share a timestamp and are written together.
+	var tick []types.PodMetric
+	var tickTime time.Time
+	counts := make(map[alert.State]int)
+	evaluate := func() {
+		if len(tick) == 0 {
+			return
+		}
+		for _, a := range evaluateAlerts(engine, notifier, tickTime, tick, nodes[tickTime.UnixNano()]) {
+			counts[a.State]++
+		}
+		tick = tick[:0]
+	}
+
+	err = scanMetrics(cmd, q, func(m types.PodMetric) error {
+		if !m.Timestamp.Equal(tickTime) {
+			evaluate()
+			tickTime = m.Timestamp
+		}
+		tick = append(tick, m)
+		return nil
+	})
+	if err == nil {
+		evaluate()
+	}
+	if notifier != nil {
+		closeNotifier(notifier)
+	}
+	if err != nil {
+		fmt.Printf("Ошибка чтения метрик: %v\n", err)
+		os.Exit(1)
+	}
+
+	active := engine.Active()
+	fmt.Printf("\nИтого: pending %d, firing %d, resolved %d; активны на конец истории: %d\n",
+		counts[alert.StatePending], counts[alert.StateFiring], counts[alert.StateResolved], len(active))
+	for _, a := range active {
+		fmt.Printf("  %s\n", a)
+	}
+}
+
+const notifierCloseTimeout = 30 * time.Second
+
+// evaluateAlerts runs one tick through the engine, prints the transitions
+// and passes them to the notifier, if any.
+func evaluateAlerts(engine *alert.Engine, notifier *notify.Dispatcher, now time.Time, pods []types.PodMetric, nodes []types.NodeMetric) []alert.Alert {
+	changed := engine.Evaluate(now, pods, nodes)
+	for _, a := range changed {
+		printAlert(now, a)
+	}
+	if notifier != nil {
+		notifier.Notify(now, changed, engine.Active())
+	}
+	return changed
+}
+
+// closeNotifier waits for queued notifications to be sent.
+func closeNotifier(notifier *notify.Dispatcher) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifierCloseTimeout)
+	defer cancel()
+	notifier.Close(ctx)
+}
+
+func printAlert(now time.Time, a alert.Alert) {
+	fmt.Printf("%s Алерт %s", now.Format(time.RFC3339), a)
+	if a.Summary != "" {
+		fmt.Printf(" — %s", a.Summary)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/pricing"
+)
+
+const (
+	dimNamespace = "namespace"
+	dimWorkload  = "workload"
+	dimPod       = "pod"
+	dimNode      = "node"
+	dimLabel     = "label:"
+
+	// unallocatedBucket collects the cost of pods that have no value for a
+	// dimension, e.g. pods without the team label.
+	unallocatedBucket = "unallocated"
+)
+
+// costDimension is one --group-by key: a pod attribute or a captured label.
+type costDimension struct {
+	name  string
+	label string
+}
+
+func parseDimensions(groupBy string) ([]costDimension, error) {
+	var dims []costDimension
+	for _, name := range strings.Split(groupBy, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == dimNamespace, name == dimWorkload, name == dimPod, name == dimNode:
+			dims = append(dims, costDimension{name: name})
+		case strings.HasPrefix(name, dimLabel) && len(name) > len(dimLabel):
+			dims = append(dims, costDimension{name: name, label: strings.TrimPrefix(name, dimLabel)})
+		default:
+			return nil, fmt.Errorf("неизвестное измерение %q (допустимы namespace, workload, pod, node, label:<ключ>)", name)
+		}
+	}
+	return dims, nil
+}
+
+func (d costDimension) value(pod *PodCost) string {
+	var v string
+	switch {
+	case d.label != "":
+		v = pod.Labels[d.label]
+	case d.name == dimNamespace:
+		v = pod.Namespace
+	case d.name == dimWorkload:
+		v = pod.Owner.String()
+	case d.name == dimPod:
+		v = pod.Namespace + "/" + pod.Name
+	case d.name == dimNode:
+		v = pod.Node
+	}
+	if v == "" {
+		return unallocatedBucket
+	}
+	return v
+}
+
+type groupCost struct {
+	Values    []string `json:"values"`
+	Pods      int      `json:"pods"`
+	CPUCost   float64  `json:"cpu"`
+	MemCost   float64  `json:"memory"`
+	WasteCost float64  `json:"waste"`
+	IdleCost  float64  `json:"idle,omitempty"`
+	TotalCost float64  `json:"total"`
+}
+
+func dimensionNames(dims []costDimension) []string {
+	names := make([]string, len(dims))
+	for i, d := range dims {
+		names[i] = d.name
+	}
+	return names
+}
+
+// calculateGroupCosts sums pod costs by the combination of dimension values.
+// The idle share spread to the namespaces goes with their pods, so the group
+// totals add up to the same total as the namespaces.
+func calculateGroupCosts(podCosts map[string]*PodCost, dims []costDimension) []*groupCost {
+	groups := make(map[string]*groupCost)
+	for _, pod := range podCosts {
+		values := make([]string, len(dims))
+		for i, d := range dims {
+			values[i] = d.value(pod)
+		}
+		key := strings.Join(values, "\x00")
+
+		g, exists := groups[key]
+		if !exists {
+			g = &groupCost{Values: values}
+			groups[key] = g
+		}
+		g.Pods++
+		g.CPUCost += pod.CPUCost
+		g.MemCost += pod.MemCost
+		g.TotalCost += pod.TotalCost + pod.idleShare
+		g.WasteCost += pod.WasteCost
+		g.IdleCost += pod.idleShare
+	}
+
+	result := make([]*groupCost, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TotalCost != result[j].TotalCost {
+			return result[i].TotalCost > result[j].TotalCost
+		}
+		return strings.Join(result[i].Values, ",") < strings.Join(result[j].Values, ",")
+	})
+	return result
+}
+
+func writeGroupCosts(w io.Writer, model *pricing.Model, groups []*groupCost, names []string) {
+	var total float64
+	for _, g := range groups {
+		total += g.TotalCost
+	}
+
+	fmt.Fprintf(w, "\n=== ПО ГРУППАМ: %s (за период) ===\n", strings.Join(names, ", "))
+	for _, g := range groups {
+		share := 0.0
+		if total > 0 {
+			share = 100 * g.TotalCost / total
+		}
+		fmt.Fprintf(w, "%-40s: %s (%.1f%%, CPU: %s, Memory: %s, простой: %s",
+			strings.Join(g.Values, " / "), model.Format(g.TotalCost), share,
+			model.Format(g.CPUCost), model.Format(g.MemCost), model.Format(g.WasteCost))
+		if g.IdleCost > 0 {
+			fmt.Fprintf(w, ", доля простаивающих узлов: %s", model.Format(g.IdleCost))
+		}
+		fmt.Fprintf(w, ", подов: %d)\n", g.Pods)
+	}
+}
+
+// groupRecords lays out one row per group for spreadsheets: the dimension
+// values, the costs for the analysed period and the period itself.
+func groupRecords(groups []*groupCost, names []string, currency string, from, to time.Time) [][]string {
+	header := append([]string{}, names...)
+	header = append(header, "pods", "cpu_cost", "memory_cost", "total_cost", "waste_cost", "idle_cost", "currency", "period_start", "period_end")
+	records := [][]string{header}
+
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', 4, 64) }
+	for _, g := range groups {
+		row := append([]string{}, g.Values...)
+		row = append(row,
+			strconv.Itoa(g.Pods),
+			format(g.CPUCost),
+			format(g.MemCost),
+			format(g.TotalCost),
+			format(g.WasteCost),
+			format(g.IdleCost),
+			currency,
+			from.Format(time.RFC3339),
+			to.Format(time.RFC3339),
+		)
+		records = append(records, row)
+	}
+	return records
+}
+
+// exportGroupCosts writes the group breakdown of the result to a CSV file.
+func exportGroupCosts(path string, result *CostResult) error {
+	file, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return fmt.Errorf("ошибка создания файла: %v", err)
+	}
+
+	writer := csv.NewWriter(file)
+	writer.WriteAll(result.Records())
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return fmt.Errorf("ошибка записи в CSV: %v", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/pricing"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+// chargebackUsage records an hour of three namespaces: prod, where only one
+// pod has the team label; dev, without labels; and idle, whose pod used
+// nothing and takes the idle share of its namespace in an equal part.
+func chargebackUsage(t *testing.T) *podUsage {
+	t.Helper()
+	pods := []struct {
+		namespace, pod string
+		cpu            int64
+		labels         map[string]string
+	}{
+		{"prod", "web-1", 1000, map[string]string{"team": "payments"}},
+		{"prod", "web-2", 500, nil},
+		{"dev", "api-1", 250, nil},
+		{"idle", "cron-1", 0, map[string]string{"team": "platform"}},
+	}
+	usage := newPodUsage(15*time.Minute, allocationUsage, coreHour)
+	for i := 0; i < 6; i++ {
+		for _, p := range pods {
+			err := usage.Add(types.PodMetric{
+				Timestamp: testStart.Add(time.Duration(i) * 10 * time.Minute),
+				Namespace: p.namespace, Pod: p.pod, Container: "app", Node: "node-1", Status: "OK",
+				CPU: p.cpu, HasCPU: true, HasMemory: true, Labels: p.labels,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return usage
+}
+
+func TestGroupTotalsMatchNamespaces(t *testing.T) {
+	const nodeCost = 4.0
+	tests := []struct {
+		idleMode string
+		groupBy  string
+	}{
+		{idleNone, "label:team"},
+		{idleProportional, "label:team"},
+		{idleEven, "label:team"},
+		{idleEven, "namespace,label:team"},
+		{idleProportional, "node"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.idleMode+" by "+tt.groupBy, func(t *testing.T) {
+			result, podCosts := calculateCosts(chargebackUsage(t), nodeCost, pricing.Flat(1, 0), false, tt.idleMode)
+			dims, err := parseDimensions(tt.groupBy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			groups := calculateGroupCosts(podCosts, dims)
+
+			namespaces := make(map[string]float64)
+			var nsTotal, nsIdle float64
+			for _, ns := range result.Namespaces {
+				namespaces[ns.Name] = ns.Total
+				nsTotal += ns.Total
+				nsIdle += ns.Idle
+			}
+			var groupTotal, groupIdle float64
+			byNamespace := make(map[string]float64)
+			unallocated := false
+			for _, g := range groups {
+				groupTotal += g.TotalCost
+				groupIdle += g.IdleCost
+				if dims[0].name == dimNamespace {
+					byNamespace[g.Values[0]] += g.TotalCost
+				}
+				unallocated = unallocated || g.Values[len(g.Values)-1] == unallocatedBucket
+			}
+
+			if math.Abs(groupTotal-nsTotal) > 1e-9 || math.Abs(groupTotal-result.Total) > 1e-9 {
+				t.Errorf("groups = %g, namespaces = %g, total = %g", groupTotal, nsTotal, result.Total)
+			}
+			if math.Abs(groupIdle-nsIdle) > 1e-9 {
+				t.Errorf("group idle = %g, namespace idle = %g", groupIdle, nsIdle)
+			}
+			if tt.idleMode != idleNone && math.Abs(groupIdle-result.Cluster.Idle) > 1e-9 {
+				t.Errorf("group idle = %g, want the whole idle capacity %g", groupIdle, result.Cluster.Idle)
+			}
+			for ns, total := range byNamespace {
+				if math.Abs(total-namespaces[ns]) > 1e-9 {
+					t.Errorf("groups of %s = %g, want the namespace total %g", ns, total, namespaces[ns])
+				}
+			}
+			if dims[len(dims)-1].label != "" && !unallocated {
+				t.Errorf("no %s group for the pods without the label", unallocatedBucket)
+			}
+		})
+	}
+}
+
+func TestSpreadIdleToPods(t *testing.T) {
+	result, podCosts := calculateCosts(chargebackUsage(t), 4, pricing.Flat(1, 0), false, idleEven)
+	// Pods cost 1.75 core-hours, so 2.25 is idle: 0.75 per namespace.
+	if math.Abs(result.Cluster.Idle-2.25) > 1e-9 {
+		t.Fatalf("idle = %g, want 2.25", result.Cluster.Idle)
+	}
+	tests := []struct {
+		pod  string
+		want float64
+	}{
+		{"prod/web-1", 0.5},
+		{"prod/web-2", 0.25},
+		{"dev/api-1", 0.75},
+		{"idle/cron-1", 0.75},
+	}
+	for _, tt := range tests {
+		if got := podCosts[tt.pod].idleShare; math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s idle share = %g, want %g", tt.pod, got, tt.want)
+		}
+	}
+}
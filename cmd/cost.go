@@ -2,10 +2,14 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"sort"
+	"time"
 
-	"github.com/nightness333/k8s-monitor/pkg/parser"
+	"github.com/nightness333/k8s-monitor/pkg/output"
+	"github.com/nightness333/k8s-monitor/pkg/pricing"
+	"github.com/nightness333/k8s-monitor/pkg/storage"
 	"github.com/nightness333/k8s-monitor/pkg/types"
 	"github.com/spf13/cobra"
 )
@@ -14,6 +18,16 @@ const (
 	hoursInMonth = 720
 	cpuDivisor   = 1000.0
 	memDivisor   = 1024.0
+
+	defaultMaxGap         = 5 * time.Minute
+	defaultSampleInterval = 10 * time.Second
+)
+
+// Allocation modes decide what a container is charged for.
+const (
+	allocationUsage    = "usage"
+	allocationRequests = "requests"
+	allocationMax      = "max"
 )
 
 var (
@@ -21,7 +35,8 @@ var (
 		Use:   "cost",
 		Short: "Расчёт стоимости ресурсов кластера",
 		Long: `Анализирует стоимость потребления CPU и памяти:
-	- Общая стоимость по кластеру
+	- Фактические затраты за анализируемый период
+	- Прогноз затрат на месяц
 	- Стоимость по неймспейсам
 	- ТОП-5 самых дорогих подов`,
 		Run: runCostCommand,
@@ -32,132 +47,684 @@ var (
 )
 
 type PodCost struct {
-	Name      string
-	Namespace string
-	CPUCost   float64
-	MemCost   float64
-	Lines     int64
-	TotalCost float64
+	Name       string
+	Namespace  string
+	Container  string
+	Workload   types.Workload
+	Owner      types.Workload
+	CPUCost    float64
+	MemCost    float64
+	Lines      int64
+	WasteCost  float64
+	IdleCost   float64
+	Runtime    time.Duration
+	Node       string
+	Labels     map[string]string
+	TotalCost  float64
+	Containers map[string]*PodCost
+
+	// spans are the billed intervals; Runtime is their wall-clock length,
+	// so replicas running side by side are not counted twice.
+	spans timeSpans
+	// idleShare is the pod's part of its namespace's IdleCost, used by
+	// --group-by.
+	idleShare float64
 }
 
 func init() {
 	rootCmd.AddCommand(costCmd)
+	addReadFlags(costCmd)
 	costCmd.Flags().StringP("file", "f", "/data/output.csv", "Файл с метриками (CSV)")
-	costCmd.Flags().Float64("cpu-price", defaultCPUPrice, "Цена за 1 CPU-core/час ($)")
-	costCmd.Flags().Float64("mem-price", defaultMemPrice, "Цена за 1 GiB памяти/час ($)")
+	costCmd.Flags().StringP("last", "l", "", "Анализировать данные за период (1h, 24h, 168h); по умолчанию — вся история")
+	addPricingFlags(costCmd)
+	costCmd.Flags().String("allocation", allocationUsage, "Что оплачивает под: usage — потребление, requests — запрошенные ресурсы, max — максимум из requests и потребления")
+	costCmd.Flags().String("idle", idleNone, "Распределение простаивающей ёмкости узлов по неймспейсам: none, proportional (пропорционально затратам) или even (поровну)")
+	costCmd.Flags().Duration("max-gap", defaultMaxGap, "Максимальный интервал между замерами; более длинные промежутки считаются простоем пода")
+	costCmd.Flags().Bool("per-pod", false, "Группировать по подам, а не по нагрузкам (Deployment, StatefulSet, ...)")
+	costCmd.Flags().String("group-by", "", "Разбивка затрат по измерениям через запятую: namespace, workload, pod, node, label:<ключ> (например label:team,namespace)")
+	costCmd.Flags().String("export-csv", "", "Сохранить разбивку затрат (--group-by, по умолчанию по namespace) в CSV файл")
 }
 
 func runCostCommand(cmd *cobra.Command, args []string) {
-	filePath, _ := cmd.Flags().GetString("file")
+	maxGap, _ := cmd.Flags().GetDuration("max-gap")
+	allocation, _ := cmd.Flags().GetString("allocation")
+	idleMode, _ := cmd.Flags().GetString("idle")
+	perPod, _ := cmd.Flags().GetBool("per-pod")
+	last, _ := cmd.Flags().GetString("last")
+
+	var q storage.Query
+	if last != "" {
+		duration, err := time.ParseDuration(last)
+		if err != nil {
+			exitf(cmd, "Ошибка: неверный формат периода: %v", err)
+		}
+		q.From = time.Now().Add(-duration)
+	}
+	if maxGap <= 0 {
+		exitf(cmd, "Ошибка: --max-gap должен быть положительным: %v", maxGap)
+	}
+	switch allocation {
+	case allocationUsage, allocationRequests, allocationMax:
+	default:
+		exitf(cmd, "Ошибка: неизвестный режим --allocation %q (допустимы usage, requests, max)", allocation)
+	}
+	switch idleMode {
+	case idleNone, idleProportional, idleEven:
+	default:
+		exitf(cmd, "Ошибка: неизвестный режим --idle %q (допустимы none, proportional, even)", idleMode)
+	}
+
+	format, err := outputFormat(cmd)
+	if err != nil {
+		exitf(cmd, "Ошибка: %v", err)
+	}
+
+	model, err := loadPricing(cmd)
+	if err != nil {
+		exitf(cmd, "Ошибка: %v", err)
+	}
+
+	groupBy, _ := cmd.Flags().GetString("group-by")
+	exportPath, _ := cmd.Flags().GetString("export-csv")
+	var dims []costDimension
+	if groupBy != "" || exportPath != "" || format == output.FormatCSV {
+		if groupBy == "" {
+			groupBy = dimNamespace
+		}
+		if dims, err = parseDimensions(groupBy); err != nil {
+			exitf(cmd, "Ошибка: %v", err)
+		}
+	}
+
+	usage, nodes, err := scanNodePricing(cmd, q, model, maxGap, allocation)
+	if err != nil {
+		exitf(cmd, "Ошибка чтения данных узлов: %v", err)
+	}
+	if err := scanMetrics(cmd, q, usage.Add); err != nil {
+		exitf(cmd, "Ошибка чтения метрик: %v", err)
+	}
+	if len(usage.pods) == 0 {
+		fmt.Fprintln(infoWriter(cmd), "Нет данных для расчёта стоимости")
+		return
+	}
+
+	filtered := namespaceFiltered(cmd)
+	if filtered && idleMode != idleNone {
+		fmt.Fprintln(os.Stderr, "Предупреждение: --idle не применяется вместе с -n: узлы общие для всех namespace, и доля остальных в простое неизвестна")
+		idleMode = idleNone
+	}
+	result, podCosts := calculateCosts(usage, coveredNodeCost(usage, nodes, filtered), model, perPod, idleMode)
+	if len(dims) > 0 {
+		result.Groups = calculateGroupCosts(podCosts, dims)
+		result.GroupBy = dimensionNames(dims)
+		result.showGroups = cmd.Flags().Changed("group-by")
+	}
+	if err := render(cmd, result); err != nil {
+		exitf(cmd, "Ошибка: %v", err)
+	}
+
+	if exportPath != "" {
+		if err := exportGroupCosts(exportPath, result); err != nil {
+			exitf(cmd, "Ошибка экспорта: %v", err)
+		}
+		fmt.Fprintf(infoWriter(cmd), "\nРазбивка затрат сохранена в %s\n", exportPath)
+	}
+}
+
+func addPricingFlags(cmd *cobra.Command) {
+	cmd.Flags().Float64("cpu-price", defaultCPUPrice, "Цена за 1 CPU-core/час ($)")
+	cmd.Flags().Float64("mem-price", defaultMemPrice, "Цена за 1 GiB памяти/час ($)")
+	cmd.Flags().String("pricing", "", "Файл цен (YAML/JSON) с ценами по пулам узлов, типам инстансов и неймспейсам; заменяет --cpu-price/--mem-price")
+}
+
+// scanNodePricing reads the node snapshots in q and prepares the pod usage
+// to be fed with samples. Node labels decide the node pool, instance type
+// and spot rate of the pods; the allocatable capacity gives the cost of the
+// whole cluster.
+func scanNodePricing(cmd *cobra.Command, q storage.Query, model *pricing.Model, maxGap time.Duration, allocation string) (*podUsage, *nodeUsage, error) {
+	nodeLabels := make(map[string]map[string]string)
+	nodes := newNodeUsage(maxGap, func(n types.NodeMetric) pricing.Rate {
+		return model.NodeRate(n.Labels)
+	})
+	err := scanNodes(cmd, q, func(n types.NodeMetric) error {
+		nodeLabels[n.Node] = n.Labels
+		return nodes.Add(n)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	usage := newPodUsage(maxGap, allocation, func(m types.PodMetric) pricing.Rate {
+		return model.Rate(m.Namespace, nodeLabels[m.Node])
+	})
+	return usage, nodes, nil
+}
+
+// loadPricing reads --pricing, or builds a flat model from --cpu-price and
+// --mem-price.
+func loadPricing(cmd *cobra.Command) (*pricing.Model, error) {
+	if path, _ := cmd.Flags().GetString("pricing"); path != "" {
+		return pricing.Load(path)
+	}
 	cpuPrice, _ := cmd.Flags().GetFloat64("cpu-price")
 	memPrice, _ := cmd.Flags().GetFloat64("mem-price")
+	return pricing.Flat(cpuPrice, memPrice), nil
+}
 
-	metrics, err := parser.ParseCSV(filePath)
-	if err != nil {
-		fmt.Printf("Ошибка чтения метрик: %v\n", err)
-		os.Exit(1)
+// calculateCosts builds the cost report. nodeCost is the cost of the cluster
+// capacity; whatever the pods were not charged for is idle and is spread
+// across namespaces according to idleMode.
+func calculateCosts(usage *podUsage, nodeCost float64, model *pricing.Model, perPod bool, idleMode string) (*CostResult, map[string]*PodCost) {
+	podCosts := calculatePodCosts(usage)
+	nsCosts := calculateNamespaceCosts(podCosts)
+
+	podCost, totalWaste := calculateTotalCost(podCosts)
+	idle := max(nodeCost-podCost, 0)
+	spreadIdleCost(nsCosts, idle, idleMode)
+	spreadIdleToPods(podCosts, nsCosts)
+
+	totalCost := podCost
+	if idleMode != idleNone && len(nsCosts) > 0 {
+		totalCost += idle
 	}
 
-	calculateAndPrintCosts(metrics, cpuPrice, memPrice)
+	result := &CostResult{
+		Currency:   model.Currency,
+		From:       usage.from,
+		To:         usage.to,
+		Allocation: usage.allocation,
+		IdleMode:   idleMode,
+		PerPod:     perPod,
+		Total:      totalCost,
+		Waste:      totalWaste,
+		Namespaces: costItems(nsCosts),
+		model:      model,
+	}
+	if period := usage.to.Sub(usage.from); period > 0 {
+		result.MonthlyForecast = totalCost / period.Hours() * hoursInMonth
+	}
+	if nodeCost > 0 {
+		result.Cluster = &ClusterCost{Nodes: nodeCost, Pods: podCost, Idle: idle}
+	}
+	if perPod {
+		result.Items = costItems(podCosts)
+	} else {
+		result.Items = costItems(calculateWorkloadCosts(podCosts))
+	}
+	return result, podCosts
 }
 
-func calculateAndPrintCosts(metrics []types.PodMetric, cpuPrice, memPrice float64) {
-	podCosts := calculatePodCosts(metrics, cpuPrice, memPrice)
-	nsCosts := calculateNamespaceCosts(metrics, cpuPrice, memPrice)
+// CostResult is the outcome of the cost command. Amounts are in Currency
+// for the period From-To.
+type CostResult struct {
+	Currency        string       `json:"currency"`
+	From            time.Time    `json:"from"`
+	To              time.Time    `json:"to"`
+	Allocation      string       `json:"allocation"`
+	IdleMode        string       `json:"idleMode"`
+	PerPod          bool         `json:"perPod"`
+	Total           float64      `json:"total"`
+	Waste           float64      `json:"waste"`
+	MonthlyForecast float64      `json:"monthlyForecast"`
+	Cluster         *ClusterCost `json:"cluster,omitempty"`
+	Namespaces      []CostItem   `json:"namespaces"`
+	// Items are the workloads, or the pods with --per-pod, most expensive
+	// first.
+	Items   []CostItem   `json:"items"`
+	GroupBy []string     `json:"groupBy,omitempty"`
+	Groups  []*groupCost `json:"groups,omitempty"`
 
-	totalCost := calculateTotalCost(podCosts)
+	model      *pricing.Model
+	showGroups bool
+}
 
-	printTotalCost(totalCost)
-	printNamespaceCosts(nsCosts)
-	printTopPods(podCosts)
+// ClusterCost compares the cost of the node capacity with what the pods were
+// charged; it is only known when node allocatable was recorded.
+type ClusterCost struct {
+	Nodes float64 `json:"nodes"`
+	Pods  float64 `json:"pods"`
+	Idle  float64 `json:"idle"`
 }
 
-func calculatePodCosts(metrics []types.PodMetric, cpuPrice, memPrice float64) map[string]*PodCost {
-	podCosts := make(map[string]*PodCost)
+type CostItem struct {
+	Name string `json:"name"`
+	// Workload is empty for namespaces.
+	Workload       *types.Workload `json:"workload,omitempty"`
+	CPU            float64         `json:"cpu"`
+	Memory         float64         `json:"memory"`
+	Waste          float64         `json:"waste"`
+	Idle           float64         `json:"idle,omitempty"`
+	Total          float64         `json:"total"`
+	RuntimeSeconds float64         `json:"runtimeSeconds,omitempty"`
+	Containers     []CostItem      `json:"containers,omitempty"`
+}
 
-	for _, m := range metrics {
-		key := m.Namespace + "/" + m.Pod
-		if _, exists := podCosts[key]; !exists {
-			podCosts[key] = &PodCost{
-				Name:      m.Pod,
-				Namespace: m.Namespace,
+// costItems converts costs into items sorted by total, most expensive first.
+// Namespace costs carry no workload.
+func costItems(costs map[string]*PodCost) []CostItem {
+	items := make([]CostItem, 0, len(costs))
+	for _, c := range costs {
+		item := CostItem{
+			Name:           c.Namespace,
+			CPU:            c.CPUCost,
+			Memory:         c.MemCost,
+			Waste:          c.WasteCost,
+			Idle:           c.IdleCost,
+			Total:          c.TotalCost,
+			RuntimeSeconds: c.Runtime.Seconds(),
+		}
+		if c.Workload.Name != "" {
+			workload := c.Workload
+			item.Name = workload.String()
+			item.Workload = &workload
+		}
+		for name, container := range c.Containers {
+			if name == "" {
+				continue
 			}
+			item.Containers = append(item.Containers, CostItem{
+				Name:   name,
+				CPU:    container.CPUCost,
+				Memory: container.MemCost,
+				Waste:  container.WasteCost,
+				Total:  container.TotalCost,
+			})
 		}
+		sortCostItems(item.Containers)
+		items = append(items, item)
+	}
+	sortCostItems(items)
+	return items
+}
+
+func sortCostItems(items []CostItem) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Total != items[j].Total {
+			return items[i].Total > items[j].Total
+		}
+		return items[i].Name < items[j].Name
+	})
+}
+
+func (r *CostResult) Kind() string { return "CostReport" }
+
+func (r *CostResult) WriteTable(w io.Writer) error {
+	model := r.model
+	period := r.To.Sub(r.From)
 
-		podCosts[key].CPUCost += float64(m.CPU)
-		podCosts[key].MemCost += float64(m.Memory)
-		podCosts[key].Lines++
+	fmt.Fprintf(w, "\n=== ОБЩАЯ СТОИМОСТЬ РЕСУРСОВ ===\n")
+	fmt.Fprintf(w, "Период: %s — %s (%s)\n", r.From.Format(time.RFC3339), r.To.Format(time.RFC3339), formatRuntime(period))
+	fmt.Fprintf(w, "Распределение затрат: %s\n", r.Allocation)
+	fmt.Fprintf(w, "Фактически за период: %s\n", model.Format(r.Total))
+	fmt.Fprintf(w, "Простой (запрошено, но не использовано): %s\n", model.Format(r.Waste))
+	if period > 0 {
+		fmt.Fprintf(w, "Прогноз на месяц (при текущем потреблении): %s\n", model.Format(r.MonthlyForecast))
 	}
+	writeIdleCost(w, model, r.Cluster, r.IdleMode)
 
-	for _, cost := range podCosts {
-		cost.CPUCost = (cost.CPUCost / float64(cost.Lines) / cpuDivisor) * cpuPrice
-		cost.MemCost = (cost.MemCost / float64(cost.Lines) / memDivisor) * memPrice
+	fmt.Fprintln(w, "\n=== ПО НЕЙМСПЕЙСАМ (за период) ===")
+	for _, ns := range r.Namespaces {
+		fmt.Fprintf(w, "%-20s: %s (CPU: %s, Memory: %s, простой: %s",
+			ns.Name, model.Format(ns.Total), model.Format(ns.CPU), model.Format(ns.Memory), model.Format(ns.Waste))
+		if ns.Idle > 0 {
+			fmt.Fprintf(w, ", доля простаивающих узлов: %s", model.Format(ns.Idle))
+		}
+		fmt.Fprintln(w, ")")
+	}
+
+	title := "НАГРУЗОК"
+	if r.PerPod {
+		title = "ПОДОВ"
+	}
+	fmt.Fprintf(w, "\n=== ТОП-5 САМЫХ ДОРОГИХ %s (за период) ===\n", title)
+	for i := 0; i < len(r.Items) && i < 5; i++ {
+		p := r.Items[i]
+		fmt.Fprintf(w, "%d. %-40s: %s (CPU: %s, Memory: %s, простой: %s, время работы: %s)\n",
+			i+1, p.Name, model.Format(p.Total), model.Format(p.CPU), model.Format(p.Memory),
+			model.Format(p.Waste), formatRuntime(time.Duration(p.RuntimeSeconds*float64(time.Second))))
+		for _, c := range p.Containers {
+			fmt.Fprintf(w, "     └ %-36s: %s (CPU: %s, Memory: %s, простой: %s)\n",
+				c.Name, model.Format(c.Total), model.Format(c.CPU), model.Format(c.Memory), model.Format(c.Waste))
+		}
+	}
+
+	if r.showGroups {
+		writeGroupCosts(w, model, r.Groups, r.GroupBy)
+	}
+	return nil
+}
+
+// Records is the group breakdown, by namespace unless --group-by is set.
+func (r *CostResult) Records() [][]string {
+	return groupRecords(r.Groups, r.GroupBy, r.Currency, r.From, r.To)
+}
+
+// podUsage integrates per-container usage over time from a stream of samples,
+// so that costs can be computed without keeping the samples.
+//
+// Each sample is billed for the interval until the next sample of the same
+// container. Intervals longer than maxGap mean the container was not running
+// (or not observed), so the sample is only billed for the last regular
+// interval. The last sample of a container is billed the same way.
+//
+// Each interval is priced at the rate of the sample that starts it, so a pod
+// rescheduled onto a different node pool changes price from that point on.
+//
+// The allocation mode decides whether usage, requests or the larger of the
+// two is charged. Requests not covered by usage are tracked as waste in every
+// mode.
+type podUsage struct {
+	maxGap     time.Duration
+	allocation string
+	rate       func(types.PodMetric) pricing.Rate
+	pods       map[string]*PodCost
+	series     map[string]*usageSeries
+	from, to   time.Time
+}
+
+// usageSeries accumulates the priced usage of one container.
+type usageSeries struct {
+	cost     *PodCost
+	pod      *PodCost
+	last     types.PodMetric
+	lastRate pricing.Rate
+	interval time.Duration
+}
+
+func newPodUsage(maxGap time.Duration, allocation string, rate func(types.PodMetric) pricing.Rate) *podUsage {
+	return &podUsage{
+		maxGap:     maxGap,
+		allocation: allocation,
+		rate:       rate,
+		pods:       make(map[string]*PodCost),
+		series:     make(map[string]*usageSeries),
+	}
+}
+
+// Add integrates one sample. Rows without usage still reserve their requests
+// on the node, so under --allocation requests|max they are billed as a
+// series of the whole pod with zero usage; only the usage series skips them.
+func (u *podUsage) Add(m types.PodMetric) error {
+	if !m.HasUsage() && !u.reserves(m) {
+		return nil
+	}
+
+	key := m.Namespace + "/" + m.Pod
+	pod, exists := u.pods[key]
+	if !exists {
+		pod = &PodCost{
+			Name:       m.Pod,
+			Namespace:  m.Namespace,
+			Workload:   types.Workload{Namespace: m.Namespace, Kind: types.WorkloadPod, Name: m.Pod},
+			Owner:      m.Workload(),
+			Containers: make(map[string]*PodCost),
+		}
+		u.pods[key] = pod
+	}
+	if m.Node != "" {
+		pod.Node = m.Node
+	}
+	if m.Labels != nil {
+		pod.Labels = m.Labels
+	}
+
+	series, exists := u.series[key+"/"+m.Container]
+	if !exists {
+		container := &PodCost{
+			Name:      m.Pod,
+			Namespace: m.Namespace,
+			Container: m.Container,
+		}
+		if m.HasUsage() {
+			pod.Containers[m.Container] = container
+		}
+		series = &usageSeries{cost: container, pod: pod, last: m, lastRate: u.rate(m)}
+		u.series[key+"/"+m.Container] = series
+	} else {
+		dt := m.Timestamp.Sub(series.last.Timestamp)
+		if dt <= 0 {
+			// Duplicate or out-of-order sample: nothing to integrate.
+			return nil
+		}
+		if dt <= u.maxGap {
+			series.interval = dt
+		}
+		series.integrate(u.sampleInterval(series), u.allocation)
+		series.last = m
+		series.lastRate = u.rate(m)
+	}
+
+	series.cost.Lines++
+	pod.Lines++
+	if u.from.IsZero() || m.Timestamp.Before(u.from) {
+		u.from = m.Timestamp
+	}
+	return nil
+}
+
+// reserves reports whether a row without usage is billed: it holds requests
+// on a node and the allocation charges requests.
+func (u *podUsage) reserves(m types.PodMetric) bool {
+	if u.allocation == allocationUsage || m.Node == "" || m.Finished() {
+		return false
+	}
+	return m.CPURequest > 0 || m.MemoryRequest > 0
+}
+
+// nodeNames returns the nodes the pods ran on, or nil when some pods were
+// recorded without a node and the set is unknown.
+func (u *podUsage) nodeNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, pod := range u.pods {
+		if pod.Node == "" {
+			return nil
+		}
+		names[pod.Node] = true
+	}
+	return names
+}
+
+// finish bills the last sample of every container and extends the analysed
+// period to the end of the last billed interval.
+func (u *podUsage) finish() {
+	for _, series := range u.series {
+		interval := u.sampleInterval(series)
+		series.integrate(interval, u.allocation)
+		if end := series.last.Timestamp.Add(interval); end.After(u.to) {
+			u.to = end
+		}
+	}
+}
+
+func (u *podUsage) sampleInterval(series *usageSeries) time.Duration {
+	if series.interval > 0 {
+		return series.interval
+	}
+	return min(defaultSampleInterval, u.maxGap)
+}
+
+func (s *usageSeries) integrate(d time.Duration, allocation string) {
+	hours := d.Hours()
+	cpu := allocated(s.last.CPU, s.last.CPURequest, allocation)
+	mem := allocated(s.last.Memory, s.last.MemoryRequest, allocation)
+	s.cost.CPUCost += float64(cpu) / cpuDivisor * hours * s.lastRate.CPU
+	s.cost.MemCost += float64(mem) / memDivisor * hours * s.lastRate.Memory
+
+	idleCPU := max(s.last.CPURequest-s.last.CPU, 0)
+	idleMem := max(s.last.MemoryRequest-s.last.Memory, 0)
+	s.cost.WasteCost += float64(idleCPU)/cpuDivisor*hours*s.lastRate.CPU +
+		float64(idleMem)/memDivisor*hours*s.lastRate.Memory
+
+	start := s.last.Timestamp
+	s.cost.spans.add(start, start.Add(d))
+	s.pod.spans.add(start, start.Add(d))
+}
+
+func allocated(used, requested int64, allocation string) int64 {
+	switch allocation {
+	case allocationRequests:
+		return requested
+	case allocationMax:
+		return max(used, requested)
+	default:
+		return used
+	}
+}
+
+// calculatePodCosts finishes the integration of every container's usage over
+// the time it was observed running and rolls the containers up into a
+// per-pod cost for the analysed period.
+func calculatePodCosts(usage *podUsage) map[string]*PodCost {
+	usage.finish()
+
+	for _, series := range usage.series {
+		cost := series.cost
 		cost.TotalCost = cost.CPUCost + cost.MemCost
+		cost.Runtime = cost.spans.total()
+
+		series.pod.CPUCost += cost.CPUCost
+		series.pod.MemCost += cost.MemCost
+		series.pod.TotalCost += cost.TotalCost
+		series.pod.WasteCost += cost.WasteCost
+		series.pod.Runtime = series.pod.spans.total()
 	}
 
-	return podCosts
+	return usage.pods
 }
 
-func calculateNamespaceCosts(metrics []types.PodMetric, cpuPrice, memPrice float64) map[string]*PodCost {
-	nsCosts := make(map[string]*PodCost)
+// calculateWorkloadCosts sums pod costs into their owning workloads, keeping
+// the per-container breakdown by container name. The runtime of a workload
+// is the time any of its pods ran, not the sum over replicas.
+func calculateWorkloadCosts(podCosts map[string]*PodCost) map[string]*PodCost {
+	workloadCosts := make(map[string]*PodCost)
 
-	for _, m := range metrics {
-		if _, exists := nsCosts[m.Namespace]; !exists {
-			nsCosts[m.Namespace] = &PodCost{
-				Namespace: m.Namespace,
+	for _, pod := range podCosts {
+		key := pod.Owner.String()
+		workload, exists := workloadCosts[key]
+		if !exists {
+			workload = &PodCost{
+				Name:       pod.Owner.Name,
+				Namespace:  pod.Namespace,
+				Workload:   pod.Owner,
+				Owner:      pod.Owner,
+				Containers: make(map[string]*PodCost),
 			}
+			workloadCosts[key] = workload
 		}
 
-		nsCosts[m.Namespace].CPUCost += float64(m.CPU)
-		nsCosts[m.Namespace].MemCost += float64(m.Memory)
-		nsCosts[m.Namespace].Lines++
+		workload.CPUCost += pod.CPUCost
+		workload.MemCost += pod.MemCost
+		workload.TotalCost += pod.TotalCost
+		workload.WasteCost += pod.WasteCost
+		workload.Lines += pod.Lines
+		workload.spans.merge(pod.spans)
+
+		for name, c := range pod.Containers {
+			container, exists := workload.Containers[name]
+			if !exists {
+				container = &PodCost{
+					Name:      workload.Name,
+					Namespace: workload.Namespace,
+					Container: name,
+				}
+				workload.Containers[name] = container
+			}
+			container.CPUCost += c.CPUCost
+			container.MemCost += c.MemCost
+			container.TotalCost += c.TotalCost
+			container.WasteCost += c.WasteCost
+			container.Lines += c.Lines
+			container.spans.merge(c.spans)
+		}
 	}
 
-	for _, cost := range nsCosts {
-		cost.CPUCost = (cost.CPUCost / float64(cost.Lines) / cpuDivisor) * cpuPrice
-		cost.MemCost = (cost.MemCost / float64(cost.Lines) / memDivisor) * memPrice
-		cost.TotalCost = cost.CPUCost + cost.MemCost
+	for _, workload := range workloadCosts {
+		workload.Runtime = workload.spans.total()
+		for _, container := range workload.Containers {
+			container.Runtime = container.spans.total()
+		}
+	}
+	return workloadCosts
+}
+
+func calculateNamespaceCosts(podCosts map[string]*PodCost) map[string]*PodCost {
+	nsCosts := make(map[string]*PodCost)
+
+	for _, pod := range podCosts {
+		if _, exists := nsCosts[pod.Namespace]; !exists {
+			nsCosts[pod.Namespace] = &PodCost{
+				Namespace: pod.Namespace,
+			}
+		}
+
+		nsCosts[pod.Namespace].CPUCost += pod.CPUCost
+		nsCosts[pod.Namespace].MemCost += pod.MemCost
+		nsCosts[pod.Namespace].TotalCost += pod.TotalCost
+		nsCosts[pod.Namespace].WasteCost += pod.WasteCost
+		nsCosts[pod.Namespace].Lines += pod.Lines
 	}
 
 	return nsCosts
 }
 
-func calculateTotalCost(podCosts map[string]*PodCost) float64 {
-	total := 0.0
+func calculateTotalCost(podCosts map[string]*PodCost) (total, waste float64) {
 	for _, cost := range podCosts {
 		total += cost.TotalCost
+		waste += cost.WasteCost
 	}
-	return total
+	return total, waste
 }
 
-func printTotalCost(totalCost float64) {
-	fmt.Printf("\n=== ОБЩАЯ СТОИМОСТЬ РЕСУРСОВ ===\n")
-	fmt.Printf("За месяц: $%.2f\n\n", totalCost*hoursInMonth)
-}
+// timeSpans is a sorted list of disjoint time intervals.
+type timeSpans []timeSpan
 
-func printNamespaceCosts(nsCosts map[string]*PodCost) {
-	fmt.Println("=== ПО НЕЙМСПЕЙСАМ ===")
-	for ns, cost := range nsCosts {
-		fmt.Printf("%-20s: $%.2f (CPU: $%.2f, Memory: $%.2f)\n",
-			ns, cost.TotalCost*hoursInMonth, cost.CPUCost*hoursInMonth, cost.MemCost*hoursInMonth)
-	}
+type timeSpan struct {
+	from, to time.Time
 }
 
-func printTopPods(podCosts map[string]*PodCost) {
-	sortedPods := make([]*PodCost, 0, len(podCosts))
-	for _, cost := range podCosts {
-		sortedPods = append(sortedPods, cost)
+// add inserts [from, to), joining the intervals it overlaps or touches.
+// Samples arrive mostly in order, so the common case extends the last one.
+func (s *timeSpans) add(from, to time.Time) {
+	spans := *s
+	n := len(spans)
+	if n == 0 || spans[n-1].to.Before(from) {
+		*s = append(spans, timeSpan{from, to})
+		return
+	}
+	if last := &spans[n-1]; !from.Before(last.from) {
+		if to.After(last.to) {
+			last.to = to
+		}
+		return
 	}
 
-	sort.Slice(sortedPods, func(i, j int) bool {
-		return sortedPods[i].TotalCost > sortedPods[j].TotalCost
-	})
+	i := sort.Search(len(spans), func(i int) bool { return !spans[i].to.Before(from) })
+	j := i
+	for ; j < len(spans) && !spans[j].from.After(to); j++ {
+		if spans[j].from.Before(from) {
+			from = spans[j].from
+		}
+		if spans[j].to.After(to) {
+			to = spans[j].to
+		}
+	}
+	*s = append(spans[:i], append(timeSpans{{from, to}}, spans[j:]...)...)
+}
 
-	fmt.Println("\n=== ТОП-5 САМЫХ ДОРОГИХ ПОДОВ ===")
-	for i := 0; i < len(sortedPods) && i < 5; i++ {
-		p := sortedPods[i]
+func (s *timeSpans) merge(other timeSpans) {
+	for _, span := range other {
+		s.add(span.from, span.to)
+	}
+}
 
-		fmt.Printf("%d. %-40s: $%.2f (CPU: $%.2f, Memory: $%.2f)\n",
-			i+1, p.Namespace+"/"+p.Name, p.TotalCost*hoursInMonth, p.CPUCost*hoursInMonth, p.MemCost*hoursInMonth)
+func (s timeSpans) total() time.Duration {
+	var d time.Duration
+	for _, span := range s {
+		d += span.to.Sub(span.from)
 	}
+	return d
+}
+
+func formatRuntime(d time.Duration) string {
+	return d.Round(time.Second).String()
 }
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/pricing"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// coreHour prices one core for an hour at 1 and memory at nothing, so the
+// CPU cost of a pod is its billed core-hours.
+func coreHour(types.PodMetric) pricing.Rate { return pricing.Rate{CPU: 1} }
+
+// samples returns n rows of m taken every interval from testStart.
+func samples(m types.PodMetric, n int, interval time.Duration) []types.PodMetric {
+	rows := make([]types.PodMetric, n)
+	for i := range rows {
+		rows[i] = m
+		rows[i].Timestamp = testStart.Add(time.Duration(i) * interval)
+	}
+	return rows
+}
+
+func podCosts(t *testing.T, maxGap time.Duration, allocation string, rows []types.PodMetric) map[string]*PodCost {
+	t.Helper()
+	usage := newPodUsage(maxGap, allocation, coreHour)
+	for _, m := range rows {
+		if err := usage.Add(m); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	return calculatePodCosts(usage)
+}
+
+func TestRequestsOnlyPod(t *testing.T) {
+	reserved := types.PodMetric{
+		Namespace: "prod", Pod: "web-1", Node: "node-1",
+		WorkloadKind: "Deployment", WorkloadName: "web",
+		Status: types.StatusNoMetrics, CPURequest: 1000, MemoryRequest: 512,
+	}
+	pending := reserved
+	pending.Pod, pending.Node, pending.Status = "web-2", "", types.StatusSkipPrefix+"Pending"
+	finished := reserved
+	finished.Pod, finished.Status = "job-1", types.StatusSkipPrefix+"Succeeded"
+
+	var rows []types.PodMetric
+	for _, m := range []types.PodMetric{reserved, pending, finished} {
+		rows = append(rows, samples(m, 6, 10*time.Minute)...)
+	}
+
+	tests := []struct {
+		allocation string
+		pods       int
+		cpuCost    float64
+	}{
+		{allocationUsage, 0, 0},
+		{allocationRequests, 1, 1},
+		{allocationMax, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.allocation, func(t *testing.T) {
+			costs := podCosts(t, 15*time.Minute, tt.allocation, rows)
+			if len(costs) != tt.pods {
+				t.Fatalf("billed %d pods, want %d: pending and finished pods reserve nothing", len(costs), tt.pods)
+			}
+			if tt.pods == 0 {
+				return
+			}
+			pod := costs["prod/web-1"]
+			if pod == nil {
+				t.Fatal("the pod without metrics is not billed")
+			}
+			if math.Abs(pod.CPUCost-tt.cpuCost) > 1e-9 {
+				t.Errorf("CPU cost = %g, want %g", pod.CPUCost, tt.cpuCost)
+			}
+			if math.Abs(pod.WasteCost-pod.CPUCost) > 1e-9 {
+				t.Errorf("waste = %g, want the whole cost %g: nothing was used", pod.WasteCost, pod.CPUCost)
+			}
+			if pod.Runtime != time.Hour {
+				t.Errorf("runtime = %v, want 1h", pod.Runtime)
+			}
+			if pod.Node != "node-1" || pod.Owner.Name != "web" {
+				t.Errorf("pod = %s on %q, want web on node-1", pod.Owner, pod.Node)
+			}
+			if len(pod.Containers) != 0 {
+				t.Errorf("containers = %v, want none: the row has no container", pod.Containers)
+			}
+		})
+	}
+}
+
+// used returns a measured row of container app in pod at offset from
+// testStart.
+func used(pod string, offset time.Duration, cpu int64) types.PodMetric {
+	return types.PodMetric{
+		Timestamp: testStart.Add(offset), Namespace: "prod", Pod: pod, Container: "app",
+		WorkloadKind: "Deployment", WorkloadName: "web", Node: "node-1", Status: "OK",
+		CPU: cpu, HasCPU: true, HasMemory: true,
+	}
+}
+
+func TestPodUsageIntegration(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxGap  time.Duration
+		offsets []time.Duration
+		runtime time.Duration
+		lines   int64
+	}{
+		{"single sample", time.Minute, []time.Duration{0}, defaultSampleInterval, 1},
+		{"single sample, maxGap below the default interval", 5 * time.Second, []time.Duration{0}, 5 * time.Second, 1},
+		{"regular samples", 5 * time.Minute, []time.Duration{0, time.Minute, 2 * time.Minute}, 3 * time.Minute, 3},
+		{"gap within maxGap", 5 * time.Minute, []time.Duration{0, 4 * time.Minute}, 8 * time.Minute, 2},
+		{"gap beyond maxGap", 5 * time.Minute,
+			[]time.Duration{0, time.Minute, 2 * time.Minute, 30 * time.Minute, 31 * time.Minute}, 5 * time.Minute, 5},
+		{"duplicate sample", 5 * time.Minute, []time.Duration{0, time.Minute, time.Minute}, 2 * time.Minute, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rows []types.PodMetric
+			for _, offset := range tt.offsets {
+				rows = append(rows, used("web-1", offset, 500))
+			}
+			pod := podCosts(t, tt.maxGap, allocationUsage, rows)["prod/web-1"]
+			if pod == nil {
+				t.Fatal("pod is not billed")
+			}
+			if pod.Runtime != tt.runtime {
+				t.Errorf("runtime = %v, want %v", pod.Runtime, tt.runtime)
+			}
+			// Half a core at 1 per core-hour.
+			if want := 0.5 * tt.runtime.Hours(); math.Abs(pod.CPUCost-want) > 1e-9 {
+				t.Errorf("CPU cost = %g, want %g", pod.CPUCost, want)
+			}
+			if pod.Lines != tt.lines {
+				t.Errorf("lines = %d, want %d", pod.Lines, tt.lines)
+			}
+		})
+	}
+}
+
+func TestWorkloadRuntime(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas map[string][]time.Duration
+		runtime  time.Duration
+		cpuCost  float64
+	}{
+		{
+			name:     "one replica",
+			replicas: map[string][]time.Duration{"web-1": {0, time.Minute}},
+			runtime:  2 * time.Minute,
+			cpuCost:  2.0 / 60,
+		},
+		{
+			name: "overlapping replicas",
+			replicas: map[string][]time.Duration{
+				"web-1": {0, time.Minute, 2 * time.Minute, 3 * time.Minute},
+				"web-2": {2 * time.Minute, 3 * time.Minute, 4 * time.Minute, 5 * time.Minute},
+			},
+			runtime: 6 * time.Minute,
+			cpuCost: 8.0 / 60,
+		},
+		{
+			name: "replica replaced after a pause",
+			replicas: map[string][]time.Duration{
+				"web-1": {0, time.Minute},
+				"web-2": {10 * time.Minute, 11 * time.Minute},
+			},
+			runtime: 4 * time.Minute,
+			cpuCost: 4.0 / 60,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rows []types.PodMetric
+			for pod, offsets := range tt.replicas {
+				for _, offset := range offsets {
+					rows = append(rows, used(pod, offset, 1000))
+				}
+			}
+			workloads := calculateWorkloadCosts(podCosts(t, 5*time.Minute, allocationUsage, rows))
+			workload := workloads["prod/Deployment/web"]
+			if len(workloads) != 1 || workload == nil {
+				t.Fatalf("workloads = %v, want prod/Deployment/web only", workloads)
+			}
+			if workload.Runtime != tt.runtime {
+				t.Errorf("runtime = %v, want the wall-clock %v", workload.Runtime, tt.runtime)
+			}
+			if math.Abs(workload.CPUCost-tt.cpuCost) > 1e-9 {
+				t.Errorf("CPU cost = %g, want the sum over replicas %g", workload.CPUCost, tt.cpuCost)
+			}
+			container := workload.Containers["app"]
+			if len(workload.Containers) != 1 || container == nil {
+				t.Fatalf("containers = %v, want the replicas merged into app", workload.Containers)
+			}
+			if container.Runtime != tt.runtime || math.Abs(container.CPUCost-tt.cpuCost) > 1e-9 {
+				t.Errorf("app: runtime %v, CPU cost %g, want %v and %g", container.Runtime, container.CPUCost, tt.runtime, tt.cpuCost)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/pricing"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// Idle spreading modes for the node capacity that no pod was charged for.
+const (
+	idleNone         = "none"
+	idleProportional = "proportional"
+	idleEven         = "even"
+)
+
+// nodeUsage integrates the priced allocatable capacity of every node over
+// time, the same way podUsage integrates container usage: each snapshot is
+// billed until the next one, and gaps longer than maxGap are not billed.
+type nodeUsage struct {
+	maxGap time.Duration
+	rate   func(types.NodeMetric) pricing.Rate
+	nodes  map[string]*nodeSeries
+}
+
+type nodeSeries struct {
+	last     types.NodeMetric
+	lastRate pricing.Rate
+	interval time.Duration
+	cost     float64
+}
+
+func newNodeUsage(maxGap time.Duration, rate func(types.NodeMetric) pricing.Rate) *nodeUsage {
+	return &nodeUsage{maxGap: maxGap, rate: rate, nodes: make(map[string]*nodeSeries)}
+}
+
+func (u *nodeUsage) Add(n types.NodeMetric) error {
+	series, exists := u.nodes[n.Node]
+	if !exists {
+		u.nodes[n.Node] = &nodeSeries{last: n, lastRate: u.rate(n)}
+		return nil
+	}
+
+	dt := n.Timestamp.Sub(series.last.Timestamp)
+	if dt <= 0 {
+		return nil
+	}
+	if dt <= u.maxGap {
+		series.interval = dt
+	}
+	series.integrate(u.sampleInterval(series))
+	series.last = n
+	series.lastRate = u.rate(n)
+	return nil
+}
+
+func (u *nodeUsage) sampleInterval(series *nodeSeries) time.Duration {
+	if series.interval > 0 {
+		return series.interval
+	}
+	return min(defaultSampleInterval, u.maxGap)
+}
+
+func (s *nodeSeries) integrate(d time.Duration) {
+	hours := d.Hours()
+	s.cost += float64(s.last.CPUAllocatable)/cpuDivisor*hours*s.lastRate.CPU +
+		float64(s.last.MemoryAllocatable)/memDivisor*hours*s.lastRate.Memory
+}
+
+// Total bills the last snapshot of every node and returns the cost of the
+// capacity of the nodes in covered, or of the whole cluster when covered is
+// nil. It is zero when no allocatable data was recorded.
+func (u *nodeUsage) Total(covered map[string]bool) float64 {
+	var total float64
+	for name, series := range u.nodes {
+		series.integrate(u.sampleInterval(series))
+		if covered == nil || covered[name] {
+			total += series.cost
+		}
+	}
+	return total
+}
+
+// coveredNodeCost returns the cost of the nodes the analysed pods ran on, so
+// that nodes used only by namespaces monitor did not collect are not taken
+// for idle capacity. With a --namespaces filter the other tenants of those
+// nodes are hidden as well, and their share cannot be told from idle
+// capacity: the node cost is then unknown and 0 is returned.
+func coveredNodeCost(usage *podUsage, nodes *nodeUsage, namespaceFiltered bool) float64 {
+	if namespaceFiltered {
+		return 0
+	}
+	return nodes.Total(usage.nodeNames())
+}
+
+// namespaceFiltered reports whether --namespaces limits the analysed data.
+func namespaceFiltered(cmd *cobra.Command) bool {
+	namespaces, _ := cmd.Flags().GetStringSlice("namespaces")
+	return len(namespaces) > 0
+}
+
+// spreadIdleCost adds the idle cluster cost to the namespaces, either in
+// proportion to their own cost or in equal parts.
+func spreadIdleCost(nsCosts map[string]*PodCost, idle float64, mode string) {
+	if idle <= 0 || len(nsCosts) == 0 || mode == idleNone {
+		return
+	}
+
+	var total float64
+	for _, cost := range nsCosts {
+		total += cost.TotalCost
+	}
+
+	for _, cost := range nsCosts {
+		share := idle / float64(len(nsCosts))
+		if mode == idleProportional && total > 0 {
+			share = idle * cost.TotalCost / total
+		}
+		cost.IdleCost += share
+		cost.TotalCost += share
+	}
+}
+
+// spreadIdleToPods passes the idle share of every namespace on to its pods in
+// proportion to their cost, or in equal parts when the namespace cost
+// nothing, so that group totals add up to the namespace totals.
+func spreadIdleToPods(podCosts, nsCosts map[string]*PodCost) {
+	base := make(map[string]float64)
+	pods := make(map[string]int)
+	for _, pod := range podCosts {
+		base[pod.Namespace] += pod.TotalCost
+		pods[pod.Namespace]++
+	}
+
+	for _, pod := range podCosts {
+		idle := nsCosts[pod.Namespace].IdleCost
+		if idle <= 0 {
+			continue
+		}
+		pod.idleShare = idle / float64(pods[pod.Namespace])
+		if total := base[pod.Namespace]; total > 0 {
+			pod.idleShare = idle * pod.TotalCost / total
+		}
+	}
+}
+
+func writeIdleCost(w io.Writer, model *pricing.Model, cluster *ClusterCost, mode string) {
+	if cluster == nil {
+		return
+	}
+	fmt.Fprintf(w, "Стоимость узлов, на которых работали поды: %s (распределено по подам: %s)\n", model.Format(cluster.Nodes), model.Format(cluster.Pods))
+	switch mode {
+	case idleNone:
+		fmt.Fprintf(w, "Простаивающая ёмкость узлов: %s (не распределена)\n", model.Format(cluster.Idle))
+	default:
+		fmt.Fprintf(w, "Простаивающая ёмкость узлов: %s (распределена по неймспейсам: %s)\n", model.Format(cluster.Idle), mode)
+	}
+}
@@ -2,20 +2,26 @@ package cmd
 
 import (
 	"context"
-	"encoding/csv"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	metrics "k8s.io/metrics/pkg/client/clientset/versioned"
 
+	"github.com/nightness333/k8s-monitor/pkg/alert"
+	"github.com/nightness333/k8s-monitor/pkg/collector"
+	"github.com/nightness333/k8s-monitor/pkg/exporter"
+	"github.com/nightness333/k8s-monitor/pkg/notify"
+	"github.com/nightness333/k8s-monitor/pkg/output"
+	"github.com/nightness333/k8s-monitor/pkg/storage"
+	"github.com/nightness333/k8s-monitor/pkg/types"
 	"github.com/spf13/cobra"
 )
 
@@ -23,169 +29,273 @@ var monitorCmd = &cobra.Command{
 	Use:   "monitor",
 	Short: "Собирает информацию о подах в кластере Kubernetes с фильтрацией",
 	Run: func(cmd *cobra.Command, args []string) {
-		interval, _ := cmd.Flags().GetInt("interval")
-		output, _ := cmd.Flags().GetString("output")
-		namespaces, _ := cmd.Flags().GetStringSlice("namespaces")
-		labelSelector, _ := cmd.Flags().GetStringToString("labels")
-
-		fmt.Printf("Запуск мониторинга (интервал: %d сек, файл: %s)...\n", interval, output)
-		fmt.Printf("Фильтры: namespaces=%v, labels=%v\n", namespaces, labelSelector)
-		startMonitoring(interval, output, namespaces, labelSelector)
+		opts := monitorOptions{}
+		opts.interval, _ = cmd.Flags().GetInt("interval")
+		store, err := monitorStore(cmd)
+		if err != nil {
+			fmt.Printf("Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+		opts.store = store
+		opts.namespaces, _ = cmd.Flags().GetStringSlice("namespaces")
+		opts.labelSelector, _ = cmd.Flags().GetStringToString("labels")
+		opts.maxDuration, _ = cmd.Flags().GetDuration("max-duration")
+		opts.iterations, _ = cmd.Flags().GetInt("iterations")
+		opts.captureLabels, _ = cmd.Flags().GetStringSlice("capture-labels")
+		opts.serve, _ = cmd.Flags().GetString("serve")
+		if path, _ := cmd.Flags().GetString("alert-rules"); path != "" {
+			rules, err := alert.Load(path)
+			if err != nil {
+				fmt.Printf("Ошибка: %v\n", err)
+				os.Exit(1)
+			}
+			opts.alerts = alert.NewEngine(rules)
+		}
+		if path, _ := cmd.Flags().GetString("notify"); path != "" {
+			if opts.alerts == nil {
+				fmt.Println("Ошибка: --notify требует --alert-rules")
+				os.Exit(1)
+			}
+			config, err := notify.Load(path)
+			if err != nil {
+				fmt.Printf("Ошибка: %v\n", err)
+				os.Exit(1)
+			}
+			opts.notifier = notify.NewDispatcher(config)
+		}
+
+		fmt.Printf("Запуск мониторинга (интервал: %d сек, хранилище: %s)...\n", opts.interval, opts.store)
+		fmt.Printf("Фильтры: namespaces=%v, labels=%v\n", opts.namespaces, opts.labelSelector)
+		err = startMonitoring(cmd.Context(), opts)
+		// os.Exit skips deferred calls, so queued notifications are sent first.
+		if opts.notifier != nil {
+			closeNotifier(opts.notifier)
+		}
+		if err != nil {
+			fmt.Printf("Ошибка: %v\n", err)
+			os.Exit(1)
+		}
 	},
 }
 
+type monitorOptions struct {
+	interval      int
+	store         string
+	namespaces    []string
+	labelSelector map[string]string
+	maxDuration   time.Duration
+	iterations    int
+	captureLabels []string
+	alerts        *alert.Engine
+	notifier      *notify.Dispatcher
+	serve         string
+}
+
 func init() {
 	rootCmd.AddCommand(monitorCmd)
 
 	monitorCmd.Flags().IntP("interval", "i", 10, "Интервал сбора данных в секундах")
-	monitorCmd.Flags().StringP("output", "o", "/data/output.csv", "Файл для сохранения данных")
+	monitorCmd.Flags().StringP("file", "f", "/data/output.csv", "Файл для сохранения данных")
 	monitorCmd.Flags().StringSliceP("namespaces", "n", []string{}, "Фильтр по namespace (через запятую)")
 	monitorCmd.Flags().StringToStringP("labels", "l", map[string]string{}, "Фильтр по labels (key=value)")
+	monitorCmd.Flags().Duration("max-duration", 0, "Остановить мониторинг через указанное время (0 — без ограничения)")
+	monitorCmd.Flags().Int("iterations", 0, "Остановить мониторинг после N замеров (0 — без ограничения)")
+	monitorCmd.Flags().StringSlice("capture-labels", []string{}, "Метки пода или его namespace, сохраняемые с каждым замером (через запятую), например team,cost-center")
+	monitorCmd.Flags().String("alert-rules", "", "Файл правил алертинга (YAML/JSON), проверяемых на каждом замере")
+	monitorCmd.Flags().String("serve", "", "Адрес HTTP-сервера с метриками в формате Prometheus (/metrics), например :9090")
+	monitorCmd.Flags().String("notify", "", "Файл получателей уведомлений об алертах (webhook, Alertmanager, Slack)")
 }
 
-func startMonitoring(interval int, output string, namespaces []string, labelSelector map[string]string) {
+// startMonitoring runs the collector until ctx is cancelled (SIGINT/SIGTERM),
+// --max-duration elapses or --iterations ticks are written. The output is
+// flushed and fsynced before returning in every case.
+func startMonitoring(ctx context.Context, opts monitorOptions) (err error) {
+	if opts.maxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.maxDuration)
+		defer cancel()
+	}
+
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		kubeconfig := filepath.Join(os.Getenv("HOME"), ".kube", "config")
 		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
 		if err != nil {
-			fmt.Printf("Ошибка подключения к Kubernetes: %v\n", err)
-			return
+			return fmt.Errorf("ошибка подключения к Kubernetes: %v", err)
 		}
 	}
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		fmt.Printf("Ошибка создания клиента Kubernetes: %v\n", err)
-		return
+		return fmt.Errorf("ошибка создания клиента Kubernetes: %v", err)
 	}
 
 	metricsClient, err := metrics.NewForConfig(config)
 	if err != nil {
-		fmt.Printf("Ошибка создания клиента метрик: %v\n", err)
-		return
+		return fmt.Errorf("ошибка создания клиента метрик: %v", err)
 	}
 
-	if err := checkMetricsServerAvailable(metricsClient); err != nil {
-		fmt.Printf("Metrics Server недоступен: %v\n", err)
-		return
+	c := collector.New(clientset, metricsClient, opts.namespaces, opts.labelSelector, opts.captureLabels)
+	if err := c.CheckMetricsServer(ctx); err != nil {
+		return fmt.Errorf("Metrics Server недоступен: %v", err)
 	}
 
-	file, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	writer, err := storage.OpenWriter(opts.store)
 	if err != nil {
-		fmt.Printf("Ошибка открытия файла: %v\n", err)
-		return
+		return err
 	}
-	defer file.Close()
+	defer func() {
+		if closeErr := writer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	if err := c.Start(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("ошибка запуска informer: %v", err)
+	}
+	for _, warning := range c.Warnings() {
+		fmt.Printf("Предупреждение: %s\n", warning)
+	}
 
-	if stat, _ := file.Stat(); stat.Size() == 0 {
-		writer.Write([]string{"Timestamp", "Namespace", "Pod", "CPU", "Memory", "Status"})
+	var metricsExporter *exporter.Exporter
+	if opts.serve != "" {
+		metricsExporter = exporter.New()
+		stop, err := serveMetrics(opts.serve, metricsExporter)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		fmt.Printf("Метрики Prometheus: http://%s/metrics\n", opts.serve)
 	}
 
-	for {
-		var pods *corev1.PodList
-		var totalPods, successPods, errorPods int
+	ticker := time.NewTicker(time.Duration(opts.interval) * time.Second)
+	defer ticker.Stop()
 
-		listOptions := metav1.ListOptions{
-			LabelSelector: labels.Set(labelSelector).String(),
+	for iteration := 1; ; iteration++ {
+		now := time.Now()
+		tick, err := c.Collect(ctx, now)
+		if ctx.Err() != nil {
+			break
 		}
-
-		if len(namespaces) == 0 {
-			pods, err = clientset.CoreV1().Pods("").List(context.TODO(), listOptions)
-			if err != nil {
-				fmt.Printf("Ошибка получения подов: %v\n", err)
-				continue
+		if metricsExporter != nil {
+			metricsExporter.Observe(now, tick, time.Since(now), err)
+		}
+		if err != nil {
+			fmt.Printf("%v\n", err)
+		}
+		if tick != nil && tick.NodesErr != nil {
+			fmt.Printf("%v\n", tick.NodesErr)
+		}
+		if tick != nil {
+			if err := writer.Append(tick.Metrics...); err != nil {
+				fmt.Printf("Ошибка записи: %v\n", err)
 			}
-		} else {
-			pods = &corev1.PodList{}
-			for _, ns := range namespaces {
-				nsPods, err := clientset.CoreV1().Pods(ns).List(context.TODO(), listOptions)
-				if err != nil {
-					fmt.Printf("Ошибка получения подов в ns %s: %v\n", ns, err)
-					continue
-				}
-				pods.Items = append(pods.Items, nsPods.Items...)
+			if err := writer.AppendNodes(tick.Nodes...); err != nil {
+				fmt.Printf("Ошибка записи: %v\n", err)
 			}
-		}
-
-		totalPods = len(pods.Items)
-
-		for _, pod := range pods.Items {
-			record := []string{
-				time.Now().Format(time.RFC3339),
-				pod.Namespace,
-				pod.Name,
-				"N/A", // CPU
-				"N/A", // Memory
-				"OK",  // Status
+			for _, m := range tick.Metrics {
+				printSample(m)
 			}
+			fmt.Printf("[Итог] Обработано: %d, Успешно: %d, Ошибки: %d\n\n",
+				tick.Pods, tick.Success, tick.Errors)
 
-			if pod.Status.Phase == corev1.PodRunning {
-				cpu, mem, err := getPodMetricsWithRetry(metricsClient, pod.Namespace, pod.Name)
-				if err != nil {
-					record[5] = fmt.Sprintf("ERROR: %v", err)
-					errorPods++
-					fmt.Printf("Ошибка для пода %s/%s: %v\n", pod.Namespace, pod.Name, err)
-				} else {
-					record[3] = cpu
-					record[4] = mem
-					successPods++
-					fmt.Printf("Под %s/%s: CPU=%s, Memory=%s\n", pod.Namespace, pod.Name, cpu, mem)
-				}
-			} else {
-				record[5] = fmt.Sprintf("SKIP: status=%s", pod.Status.Phase)
+			if opts.alerts != nil {
+				evaluateAlerts(opts.alerts, opts.notifier, now, tick.Metrics, tick.Nodes)
 			}
-
-			writer.Write(record)
 		}
+		flushRecords(writer)
 
-		writer.Flush()
-		if err := writer.Error(); err != nil {
-			fmt.Printf("Ошибка записи в CSV: %v\n", err)
+		if opts.iterations > 0 && iteration >= opts.iterations {
+			break
+		}
+		if !waitNextTick(ctx, c, writer, ticker) {
+			break
 		}
+	}
 
-		fmt.Printf("[Итог] Обработано: %d, Успешно: %d, Ошибки: %d\n\n",
-			totalPods, successPods, errorPods)
+	fmt.Println("Мониторинг остановлен")
+	return nil
+}
 
-		time.Sleep(time.Duration(interval) * time.Second)
+// monitorStore returns the store monitor writes to. Before --output became
+// the global format flag, monitor -o/--output took the data file; a value
+// that is not a format is still accepted as one, with a warning.
+func monitorStore(cmd *cobra.Command) (string, error) {
+	if !cmd.Flags().Changed("output") {
+		return storeURI(cmd, "file"), nil
 	}
+	value, _ := cmd.Flags().GetString("output")
+	if output.Validate(value) == nil {
+		return "", fmt.Errorf("monitor не выводит отчёт, --output %s не применяется; файл данных задаёт -f/--file", value)
+	}
+	fmt.Fprintf(os.Stderr, "Предупреждение: -o/--output для файла данных устарел, используйте -f/--file %s\n", value)
+	if store, _ := cmd.Flags().GetString("store"); store != "" || cmd.Flags().Changed("file") {
+		return storeURI(cmd, "file"), nil
+	}
+	return value, nil
 }
 
-func checkMetricsServerAvailable(metricsClient *metrics.Clientset) error {
-	_, err := metricsClient.MetricsV1beta1().PodMetricses("").List(context.TODO(), metav1.ListOptions{Limit: 1})
+const serverShutdownTimeout = 5 * time.Second
+
+// serveMetrics starts the /metrics endpoint in the background and returns a
+// function that shuts it down.
+func serveMetrics(addr string, handler http.Handler) (func(), error) {
+	listener, err := net.Listen("tcp", addr)
 	if err != nil {
-		return fmt.Errorf("не удалось получить метрики: %v", err)
+		return nil, fmt.Errorf("ошибка запуска HTTP-сервера: %v", err)
 	}
-	return nil
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("Ошибка HTTP-сервера: %v\n", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
 }
 
-func getPodMetricsWithRetry(metricsClient *metrics.Clientset, namespace, name string) (string, string, error) {
-	var lastErr error
-	for i := 0; i < 2; i++ {
-		cpu, mem, err := getPodMetrics(metricsClient, namespace, name)
-		if err == nil {
-			return cpu, mem, nil
+// waitNextTick records lifecycle events until the next tick. It returns false
+// once ctx is done.
+func waitNextTick(ctx context.Context, c *collector.Collector, writer storage.Writer, ticker *time.Ticker) bool {
+	for {
+		select {
+		case event := <-c.Events():
+			if err := writer.Append(event); err != nil {
+				fmt.Printf("Ошибка записи: %v\n", err)
+			}
+			fmt.Printf("Событие %s/%s: %s\n", event.Namespace, event.Pod, strings.TrimPrefix(event.Status, types.EventPrefix))
+			flushRecords(writer)
+		case <-ticker.C:
+			return true
+		case <-ctx.Done():
+			return false
 		}
-		lastErr = err
-		time.Sleep(1 * time.Second)
 	}
-	return "", "", lastErr
 }
 
-func getPodMetrics(metricsClient *metrics.Clientset, namespace, name string) (string, string, error) {
-	podMetrics, err := metricsClient.MetricsV1beta1().PodMetricses(namespace).Get(context.TODO(), name, metav1.GetOptions{})
-	if err != nil {
-		return "", "", err
+func flushRecords(writer storage.Writer) {
+	if err := writer.Flush(); err != nil {
+		fmt.Printf("%v\n", err)
 	}
+}
 
-	var totalCPU, totalMem int64
-	for _, container := range podMetrics.Containers {
-		totalCPU += container.Usage.Cpu().MilliValue()
-		totalMem += container.Usage.Memory().Value()
+func printSample(m types.PodMetric) {
+	switch {
+	case m.Status == types.StatusOK:
+		fmt.Printf("Под %s/%s [%s]: CPU=%dm, Memory=%dMi\n", m.Namespace, m.Pod, m.Container, m.CPU, m.Memory)
+	case m.Status == types.StatusNoMetrics:
+		fmt.Printf("Нет метрик для пода %s/%s\n", m.Namespace, m.Pod)
+	case strings.HasPrefix(m.Status, "ERROR:"):
+		fmt.Printf("Ошибка для пода %s/%s: %s\n", m.Namespace, m.Pod, m.Status)
 	}
-
-	return fmt.Sprintf("%dm", totalCPU), fmt.Sprintf("%dMi", totalMem/1024/1024), nil
 }
@@ -1,21 +1,36 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 
-	"github.com/nightness333/k8s-monitor/pkg/parser"
+	"github.com/nightness333/k8s-monitor/pkg/confidence"
+	"github.com/nightness333/k8s-monitor/pkg/manifest"
+	"github.com/nightness333/k8s-monitor/pkg/output"
+	"github.com/nightness333/k8s-monitor/pkg/policy"
+	"github.com/nightness333/k8s-monitor/pkg/storage"
 	"github.com/nightness333/k8s-monitor/pkg/types"
 	"github.com/nightness333/k8s-monitor/pkg/utils"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
 const (
-	defaultMargin = 20
+	defaultMargin            = 20
+	defaultRequestPercentile = 90
+	defaultLimitPercentile   = 99
+	defaultMinSamples        = 20
+	defaultMinSpan           = time.Hour
 )
 
 var optimizeCmd = &cobra.Command{
@@ -24,40 +39,337 @@ var optimizeCmd = &cobra.Command{
 	Run:   runOptimizeCommand,
 }
 
+type recommendOptions struct {
+	margin            int64
+	requestPercentile float64
+	limitPercentile   float64
+
+	// policy is nil without --policy; namespaceLabels caches the labels of
+	// namespaces its selectors are matched against.
+	policy          *policy.Config
+	namespaceLabels map[string]map[string]string
+
+	confidence           confidence.Thresholds
+	includeLowConfidence bool
+}
+
+// OptimizeResult is the outcome of the optimize command. CPU is in
+// millicores, memory in MiB.
+type OptimizeResult struct {
+	RequestPercentile float64                   `json:"requestPercentile"`
+	LimitPercentile   float64                   `json:"limitPercentile"`
+	Margin            int64                     `json:"margin"`
+	Workloads         []*workloadRecommendation `json:"workloads"`
+	Skipped           []SkippedWorkload         `json:"skipped,omitempty"`
+	LowConfidence     []LowConfidenceWorkload   `json:"lowConfidence,omitempty"`
+}
+
+// workloadRecommendation is the outcome for one workload: observed usage,
+// the current and the recommended resources in total and per container.
+// Data recorded without containers only has the totals.
+type workloadRecommendation struct {
+	Key         string                    `json:"key"`
+	Workload    types.Workload            `json:"workload"`
+	Confidence  confidence.Score          `json:"confidence"`
+	CPU         ResourceUsage             `json:"cpu"`
+	Memory      ResourceUsage             `json:"memory"`
+	Current     types.ContainerResources  `json:"current"`
+	Recommended types.ContainerResources  `json:"recommended"`
+	Changes     []policy.Change           `json:"changes,omitempty"`
+	Containers  []ContainerRecommendation `json:"containers,omitempty"`
+
+	// Per-container resources of the containers in the live spec, for
+	// manifests and apply; empty when there is nothing to change.
+	current     map[string]types.ContainerResources
+	recommended map[string]types.ContainerResources
+}
+
+type ContainerRecommendation struct {
+	Name        string                   `json:"name"`
+	CPU         ResourceUsage            `json:"cpu"`
+	Memory      ResourceUsage            `json:"memory"`
+	Current     types.ContainerResources `json:"current"`
+	Recommended types.ContainerResources `json:"recommended"`
+	Changes     []policy.Change          `json:"changes,omitempty"`
+}
+
+// ResourceUsage summarizes observed usage at the percentiles recommendations
+// are sized from.
+type ResourceUsage struct {
+	Avg               int64   `json:"avg"`
+	Median            int64   `json:"median"`
+	RequestPercentile int64   `json:"requestPercentile"`
+	LimitPercentile   int64   `json:"limitPercentile"`
+	Max               int64   `json:"max"`
+	StdDev            float64 `json:"stdDev"`
+}
+
+// SkippedWorkload has no recommendation because of a policy rule or because
+// its configuration could not be read.
+type SkippedWorkload struct {
+	Key      string         `json:"key"`
+	Workload types.Workload `json:"workload"`
+	Rule     string         `json:"rule,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+type LowConfidenceWorkload struct {
+	Key         string         `json:"key"`
+	Workload    types.Workload `json:"workload"`
+	Samples     int64          `json:"samples"`
+	SpanSeconds float64        `json:"spanSeconds"`
+	Reasons     []string       `json:"reasons"`
+}
+
 func init() {
 	rootCmd.AddCommand(optimizeCmd)
+	addReadFlags(optimizeCmd)
+	addPercentileFlags(optimizeCmd)
 	optimizeCmd.Flags().StringP("file", "f", "/data/output.csv", "Файл с метриками (CSV)")
 	optimizeCmd.Flags().IntP("margin", "m", defaultMargin, "Запас прочности (%)")
+	optimizeCmd.Flags().Bool("per-pod", false, "Группировать по подам, а не по нагрузкам (Deployment, StatefulSet, ...)")
+	optimizeCmd.Flags().Float64("request-percentile", defaultRequestPercentile, "Перцентиль потребления для расчёта requests (0-100)")
+	optimizeCmd.Flags().Float64("limit-percentile", defaultLimitPercentile, "Перцентиль потребления для расчёта limits (0-100, 100 — максимум)")
+	optimizeCmd.Flags().String("manifests", "", "Сохранить рекомендации как манифесты: patch (strategic-merge патчи), yaml (полные манифесты), kustomize (патчи и kustomization.yaml) или vpa (VerticalPodAutoscaler)")
+	optimizeCmd.Flags().String("manifests-dir", "recommendations", "Каталог для --manifests (по файлу на нагрузку)")
+	optimizeCmd.Flags().Int64("min-samples", defaultMinSamples, "Минимум замеров для рекомендации; с меньшим числом уверенность низкая")
+	optimizeCmd.Flags().Duration("min-span", defaultMinSpan, "Минимальный период наблюдений для рекомендации; с меньшим уверенность низкая")
+	optimizeCmd.Flags().Bool("include-low-confidence", false, "Анализировать, сохранять и применять рекомендации с низкой уверенностью")
+	optimizeCmd.Flags().String("policy", "", "Файл политик рекомендаций (YAML/JSON): границы, округление, соотношение limit/request, исключения")
+	optimizeCmd.Flags().String("vpa-update-mode", manifest.UpdateModeOff, "updateMode для --manifests vpa: Off, Initial, Recreate или Auto")
 }
 
 func runOptimizeCommand(cmd *cobra.Command, args []string) {
-	filePath, _ := cmd.Flags().GetString("file")
-	margin, _ := cmd.Flags().GetInt64("margin")
+	margin, _ := cmd.Flags().GetInt("margin")
+	perPod, _ := cmd.Flags().GetBool("per-pod")
+	opts := recommendOptions{margin: int64(margin)}
+	opts.requestPercentile, _ = cmd.Flags().GetFloat64("request-percentile")
+	opts.limitPercentile, _ = cmd.Flags().GetFloat64("limit-percentile")
+	opts.confidence.MinSamples, _ = cmd.Flags().GetInt64("min-samples")
+	opts.confidence.MinSpan, _ = cmd.Flags().GetDuration("min-span")
+	opts.includeLowConfidence, _ = cmd.Flags().GetBool("include-low-confidence")
 
-	metrics, err := parser.ParseCSV(filePath)
+	for _, p := range []float64{opts.requestPercentile, opts.limitPercentile} {
+		if p < 0 || p > 100 {
+			exitf(cmd, "Ошибка: перцентиль должен быть в диапазоне 0-100: %v", p)
+		}
+	}
+	var manifests manifestOptions
+	manifests.format, _ = cmd.Flags().GetString("manifests")
+	// Before --manifests, optimize -o/--output took the manifest format.
+	// Those values are still accepted, except yaml, which is now the
+	// document format: it is rendered as such, with a warning.
+	switch format, _ := cmd.Flags().GetString("output"); {
+	case isLegacyManifestFormat(format):
+		fmt.Fprintf(os.Stderr, "Предупреждение: --output %s устарел, используйте --manifests %s\n", format, format)
+		if manifests.format == "" {
+			manifests.format = format
+		}
+		cmd.Flags().Set("output", output.FormatTable)
+	case format == output.FormatYAML && manifests.format == "":
+		fmt.Fprintln(os.Stderr, "Предупреждение: -o yaml выводит отчёт в YAML; полные манифесты, которые раньше сохранял -o yaml, теперь сохраняет --manifests yaml")
+	}
+	if _, err := outputFormat(cmd); err != nil {
+		exitf(cmd, "Ошибка: %v", err)
+	}
+	manifests.dir, _ = cmd.Flags().GetString("manifests-dir")
+	manifests.vpaUpdateMode, _ = cmd.Flags().GetString("vpa-update-mode")
+	switch manifests.format {
+	case "", manifestPatch, manifestYAML, manifestKustomize, manifestVPA:
+	default:
+		exitf(cmd, "Ошибка: неизвестный формат --manifests %q (допустимы patch, yaml, kustomize, vpa)", manifests.format)
+	}
+	if !manifest.ValidUpdateMode(manifests.vpaUpdateMode) {
+		exitf(cmd, "Ошибка: неизвестный --vpa-update-mode %q (допустимы Off, Initial, Recreate, Auto)", manifests.vpaUpdateMode)
+	}
+
+	if path, _ := cmd.Flags().GetString("policy"); path != "" {
+		cfg, err := policy.Load(path)
+		if err != nil {
+			exitf(cmd, "Ошибка: %v", err)
+		}
+		opts.policy = cfg
+		opts.namespaceLabels = make(map[string]map[string]string)
+	}
+
+	doApply, _ := cmd.Flags().GetBool("apply")
+	applyOpts, confirmed, err := applyOptions(cmd)
 	if err != nil {
-		fmt.Printf("Ошибка чтения метрик: %v\n", err)
-		os.Exit(1)
+		exitf(cmd, "Ошибка: %v", err)
 	}
 
-	optimizeClusterResources(metrics, margin)
-}
+	podStats, err := aggregateMetrics(cmd, storage.Query{}, perPod)
+	if err != nil {
+		exitf(cmd, "Ошибка чтения метрик: %v", err)
+	}
 
-func optimizeClusterResources(metrics []types.PodMetric, margin int64) {
 	clientset, err := createKubernetesClient()
 	if err != nil {
-		fmt.Printf("Ошибка подключения к Kubernetes: %v\n", err)
+		exitf(cmd, "Ошибка подключения к Kubernetes: %v", err)
+	}
+
+	result := optimizeClusterResources(cmd.Context(), clientset, podStats, opts)
+	if err := render(cmd, result); err != nil {
+		exitf(cmd, "Ошибка: %v", err)
+	}
+
+	info := infoWriter(cmd)
+	if manifests.format != "" {
+		if err := writeManifests(cmd.Context(), info, clientset, result.Workloads, manifests); err != nil {
+			exitf(cmd, "Ошибка сохранения манифестов: %v", err)
+		}
+	}
+	if doApply && applyRecommendations(cmd.Context(), info, clientset, result.Workloads, applyOpts, confirmed) > 0 {
+		os.Exit(1)
+	}
+}
+
+// optimizeClusterResources analyzes every workload. Low-confidence
+// workloads are only listed unless opts.includeLowConfidence is set.
+func optimizeClusterResources(ctx context.Context, clientset kubernetes.Interface, podStats map[string]*types.PodStats, opts recommendOptions) *OptimizeResult {
+	result := &OptimizeResult{
+		RequestPercentile: opts.requestPercentile,
+		LimitPercentile:   opts.limitPercentile,
+		Margin:            opts.margin,
+		Workloads:         []*workloadRecommendation{},
+	}
+
+	keys := make([]string, 0, len(podStats))
+	for key := range podStats {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return result
+		}
+		stats := podStats[key]
+		score := confidence.Evaluate(stats, opts.confidence)
+		if score.Level == confidence.Low && !opts.includeLowConfidence {
+			result.LowConfidence = append(result.LowConfidence, LowConfidenceWorkload{
+				Key:         key,
+				Workload:    stats.Workload,
+				Samples:     stats.CPU.Count,
+				SpanSeconds: stats.Span().Round(time.Second).Seconds(),
+				Reasons:     score.Reasons,
+			})
+			continue
+		}
+		rec, skipped := recommendWorkload(ctx, clientset, stats, score, opts)
+		if skipped != nil {
+			result.Skipped = append(result.Skipped, *skipped)
+			continue
+		}
+		result.Workloads = append(result.Workloads, rec)
+	}
+	return result
+}
+
+func (r *OptimizeResult) Kind() string { return "OptimizeReport" }
+
+func (r *OptimizeResult) WriteTable(w io.Writer) error {
+	fmt.Fprint(w, "=== ОПТИМИЗАЦИЯ РЕСУРСОВ ===\n")
+	fmt.Fprintf(w, "requests по %s, limits по %s, запас %d%%\n\n",
+		percentileLabel(r.RequestPercentile), percentileLabel(r.LimitPercentile), r.Margin)
+
+	for _, rec := range r.Workloads {
+		r.writeWorkload(w, rec)
+	}
+	for _, s := range r.Skipped {
+		if s.Rule != "" {
+			fmt.Fprintf(w, "[%s %-20s]: пропущено по правилу %s\n\n", workloadTitle(s.Workload.Kind), s.Key, s.Rule)
+		} else {
+			fmt.Fprintf(w, "Ошибка получения конфигурации для %-20s: %s\n", s.Key, s.Error)
+		}
+	}
+
+	if len(r.LowConfidence) > 0 {
+		fmt.Fprintln(w, "=== НИЗКАЯ УВЕРЕННОСТЬ (без рекомендаций, см. --include-low-confidence) ===")
+		for _, l := range r.LowConfidence {
+			fmt.Fprintf(w, "[%s %s]: замеров %d за %s\n", workloadTitle(l.Workload.Kind), l.Key,
+				l.Samples, time.Duration(l.SpanSeconds*float64(time.Second)))
+			for _, reason := range l.Reasons {
+				fmt.Fprintf(w, "  - %s\n", reason)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func (r *OptimizeResult) writeWorkload(w io.Writer, rec *workloadRecommendation) {
+	reqLabel, limLabel := percentileLabel(r.RequestPercentile), percentileLabel(r.LimitPercentile)
+
+	fmt.Fprintf(w, "[%s %-20s]:\n", workloadTitle(rec.Workload.Kind), rec.Key)
+	fmt.Fprintf(w, "• Уверенность: %s\n", rec.Confidence.Level)
+	for _, reason := range rec.Confidence.Reasons {
+		fmt.Fprintf(w, "  - %s\n", reason)
+	}
+
+	cpu, memory := rec.CPU, rec.Memory
+	fmt.Fprintln(w, "• Текущие значения:")
+	fmt.Fprintf(w, "  Средние:      CPU=%4dm, Mem=%4dMi\n", cpu.Avg, memory.Avg)
+	fmt.Fprintf(w, "  Медиана:      CPU=%4dm, Mem=%4dMi\n", cpu.Median, memory.Median)
+	fmt.Fprintf(w, "  %-13s CPU=%4dm, Mem=%4dMi\n", reqLabel+":", cpu.RequestPercentile, memory.RequestPercentile)
+	fmt.Fprintf(w, "  %-13s CPU=%4dm, Mem=%4dMi\n", limLabel+":", cpu.LimitPercentile, memory.LimitPercentile)
+	fmt.Fprintf(w, "  Максимальные: CPU=%4dm, Mem=%4dMi\n", cpu.Max, memory.Max)
+	fmt.Fprintf(w, "  Отклонение:   CPU=%4.0fm, Mem=%4.0fMi\n", cpu.StdDev, memory.StdDev)
+	fmt.Fprintf(w, "  CPU: requests=%4dm, limit=%4dm\n", rec.Current.Requests.CPU, rec.Current.Limits.CPU)
+	fmt.Fprintf(w, "  Память: requests=%4dMi, limit=%4dMi\n\n", rec.Current.Requests.Memory, rec.Current.Limits.Memory)
+
+	total := rec.Recommended
+	if len(rec.Containers) == 0 {
+		fmt.Fprintln(w, "• Рекомендации:")
+		fmt.Fprintf(w, "  CPU: requests=%4dm, limit=%4dm\n", total.Requests.CPU, total.Limits.CPU)
+		fmt.Fprintf(w, "  Память: requests=%4dMi, limit=%4dMi\n", total.Requests.Memory, total.Limits.Memory)
+		writePolicyChanges(w, "  ", rec.Changes)
+		fmt.Fprintln(w)
 		return
 	}
 
-	fmt.Print("=== ОПТИМИЗАЦИЯ РЕСУРСОВ ===\n\n")
+	for _, c := range rec.Containers {
+		fmt.Fprintf(w, "  [Контейнер %s]:\n", c.Name)
+		fmt.Fprintf(w, "  • Средние: CPU=%4dm, Mem=%4dMi | %s: CPU=%4dm, Mem=%4dMi | %s: CPU=%4dm, Mem=%4dMi | Максимальные: CPU=%4dm, Mem=%4dMi\n",
+			c.CPU.Avg, c.Memory.Avg,
+			reqLabel, c.CPU.RequestPercentile, c.Memory.RequestPercentile,
+			limLabel, c.CPU.LimitPercentile, c.Memory.LimitPercentile,
+			c.CPU.Max, c.Memory.Max)
+		fmt.Fprintf(w, "  • Текущие:      CPU: requests=%4dm, limit=%4dm | Память: requests=%4dMi, limit=%4dMi\n",
+			c.Current.Requests.CPU, c.Current.Limits.CPU, c.Current.Requests.Memory, c.Current.Limits.Memory)
+		fmt.Fprintf(w, "  • Рекомендации: CPU: requests=%4dm, limit=%4dm | Память: requests=%4dMi, limit=%4dMi\n",
+			c.Recommended.Requests.CPU, c.Recommended.Limits.CPU, c.Recommended.Requests.Memory, c.Recommended.Limits.Memory)
+		writePolicyChanges(w, "    ", c.Changes)
+	}
 
-	podStats := aggregatePodMetrics(metrics)
+	fmt.Fprintln(w, "• Рекомендации (итого по поду):")
+	fmt.Fprintf(w, "  CPU: requests=%4dm, limit=%4dm\n", total.Requests.CPU, total.Limits.CPU)
+	fmt.Fprintf(w, "  Память: requests=%4dMi, limit=%4dMi\n\n", total.Requests.Memory, total.Limits.Memory)
+}
 
-	for key, stats := range podStats {
-		ns, name := utils.SplitPodKey(key)
-		printPodOptimization(clientset, ns, name, stats, margin)
+// Records lists the recommendations per container, or per workload for data
+// recorded without containers.
+func (r *OptimizeResult) Records() [][]string {
+	records := [][]string{{"namespace", "kind", "name", "container", "confidence",
+		"cpu_request", "cpu_limit", "memory_request", "memory_limit",
+		"recommended_cpu_request", "recommended_cpu_limit", "recommended_memory_request", "recommended_memory_limit"}}
+	row := func(rec *workloadRecommendation, container string, current, recommended types.ContainerResources) []string {
+		level, _ := rec.Confidence.Level.MarshalText()
+		return []string{rec.Workload.Namespace, rec.Workload.Kind, rec.Workload.Name, container, string(level),
+			formatInt(current.Requests.CPU), formatInt(current.Limits.CPU),
+			formatInt(current.Requests.Memory), formatInt(current.Limits.Memory),
+			formatInt(recommended.Requests.CPU), formatInt(recommended.Limits.CPU),
+			formatInt(recommended.Requests.Memory), formatInt(recommended.Limits.Memory)}
 	}
+	for _, rec := range r.Workloads {
+		if len(rec.Containers) == 0 {
+			records = append(records, row(rec, "", rec.Current, rec.Recommended))
+		}
+		for _, c := range rec.Containers {
+			records = append(records, row(rec, c.Name, c.Current, c.Recommended))
+		}
+	}
+	return records
 }
 
 func createKubernetesClient() (*kubernetes.Clientset, error) {
@@ -72,69 +384,137 @@ func createKubernetesClient() (*kubernetes.Clientset, error) {
 	return kubernetes.NewForConfig(config)
 }
 
-func aggregatePodMetrics(metrics []types.PodMetric) map[string]*types.PodStats {
-	podStats := make(map[string]*types.PodStats)
+// recommendWorkload sizes one workload. It returns a skipped entry instead
+// when the configuration cannot be read or a policy rule excludes it.
+func recommendWorkload(ctx context.Context, clientset kubernetes.Interface, stats *types.PodStats, score confidence.Score, opts recommendOptions) (*workloadRecommendation, *SkippedWorkload) {
+	key := stats.Workload.String()
+	skipped := &SkippedWorkload{Key: key, Workload: stats.Workload}
 
-	for _, m := range metrics {
-		key := m.Namespace + "/" + m.Pod
+	obj, spec, err := utils.GetWorkloadObject(ctx, clientset, stats.Workload)
+	if err != nil {
+		skipped.Error = err.Error()
+		return nil, skipped
+	}
+	containers := utils.ContainerResourcesFromSpec(*spec)
 
-		if _, exists := podStats[key]; !exists {
-			podStats[key] = &types.PodStats{
-				Status: "OK",
-			}
-		}
+	pol, err := workloadPolicy(ctx, clientset, obj, stats.Workload, opts)
+	if err != nil {
+		skipped.Error = fmt.Sprintf("политика: %v", err)
+		return nil, skipped
+	}
+	if pol.Skip != "" {
+		skipped.Rule = pol.Skip
+		return nil, skipped
+	}
+
+	result := &workloadRecommendation{
+		Key:        key,
+		Workload:   stats.Workload,
+		Confidence: score,
+		CPU:        resourceUsage(stats.CPU, opts),
+		Memory:     resourceUsage(stats.Memory, opts),
+	}
+	for _, c := range containers {
+		addResources(&result.Current, c)
+	}
 
-		podStats[key].CPU = append(podStats[key].CPU, m.CPU)
-		podStats[key].Memory = append(podStats[key].Memory, m.Memory)
+	if len(stats.Containers) == 0 {
+		result.Recommended, result.Changes = pol.Apply(recommendResources(stats.CPU, stats.Memory, opts), stats.Memory.Max)
+		return result, nil
 	}
 
-	return podStats
+	result.current = containers
+	result.recommended = make(map[string]types.ContainerResources)
+	for _, cname := range containerNames(stats) {
+		c := stats.Containers[cname]
+		rec, changes := pol.Apply(recommendResources(c.CPU, c.Memory, opts), c.Memory.Max)
+		if _, ok := containers[cname]; ok {
+			result.recommended[cname] = rec
+		}
+		result.Containers = append(result.Containers, ContainerRecommendation{
+			Name:        cname,
+			CPU:         resourceUsage(c.CPU, opts),
+			Memory:      resourceUsage(c.Memory, opts),
+			Current:     containers[cname],
+			Recommended: rec,
+			Changes:     changes,
+		})
+		addResources(&result.Recommended, rec)
+	}
+	return result, nil
 }
 
-func printPodOptimization(clientset *kubernetes.Clientset, ns, name string, stats *types.PodStats, margin int64) {
-	key := ns + "/" + name
-	cpuAvg := utils.Avg(stats.CPU)
-	cpuMax := utils.Max(stats.CPU)
-	memAvg := utils.Avg(stats.Memory)
-	memMax := utils.Max(stats.Memory)
+func addResources(total *types.ContainerResources, c types.ContainerResources) {
+	total.Requests.CPU += c.Requests.CPU
+	total.Requests.Memory += c.Requests.Memory
+	total.Limits.CPU += c.Limits.CPU
+	total.Limits.Memory += c.Limits.Memory
+}
 
-	limits, err := utils.GetPodLimits(clientset, ns, name)
-	if err != nil {
-		fmt.Printf("Ошибка получения конфигурации для %-20s: %v\n", key, err)
-		return
+func resourceUsage(s types.Series, opts recommendOptions) ResourceUsage {
+	return ResourceUsage{
+		Avg:               s.Avg(),
+		Median:            s.Median(),
+		RequestPercentile: s.Percentile(opts.requestPercentile),
+		LimitPercentile:   s.Percentile(opts.limitPercentile),
+		Max:               s.Max,
+		StdDev:            s.StdDev(),
 	}
+}
 
-	requests, err := utils.GetPodRequests(clientset, ns, name)
-	if err != nil {
-		fmt.Printf("Ошибка получения конфигурации для %-20s: %v\n", key, err)
-		return
+func workloadTitle(kind string) string {
+	if kind == types.WorkloadPod {
+		return "Под"
 	}
+	return kind
+}
 
-	fmt.Printf("[Под %-20s]:\n", key)
-	printCurrentMetrics(cpuAvg, cpuMax, memAvg, memMax, limits, requests)
-	printRecommendations(cpuAvg, cpuMax, memAvg, memMax, margin)
+func writePolicyChanges(w io.Writer, indent string, changes []policy.Change) {
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s↳ правило %s\n", indent, c)
+	}
 }
 
-func printCurrentMetrics(cpuAvg, cpuMax, memAvg, memMax int64, limits, requests *types.PodConfiguration) {
-	fmt.Println("• Текущие значения:")
-	fmt.Printf("  Средние:      CPU=%4dm, Mem=%4dMi\n", cpuAvg, memAvg)
-	fmt.Printf("  Максимальные: CPU=%4dm, Mem=%4dMi\n", cpuMax, memMax)
+// workloadPolicy resolves the --policy rules for a workload, matching
+// selectors against the labels of the live object and of its namespace.
+func workloadPolicy(ctx context.Context, clientset kubernetes.Interface, obj runtime.Object, w types.Workload, opts recommendOptions) (*policy.Policy, error) {
+	if opts.policy == nil {
+		return &policy.Policy{}, nil
+	}
 
-	if limits != nil && requests != nil {
-		fmt.Printf("  CPU: requests=%4dm, limit=%4dm\n", requests.CPU, limits.CPU)
-		fmt.Printf("  Память: requests=%4dMi, limit=%4dMi\n\n", requests.Memory, limits.Memory)
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
 	}
+	nsLabels, ok := opts.namespaceLabels[w.Namespace]
+	if !ok {
+		ns, err := clientset.CoreV1().Namespaces().Get(ctx, w.Namespace, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		nsLabels = ns.Labels
+		opts.namespaceLabels[w.Namespace] = nsLabels
+	}
+	return opts.policy.For(policy.Target{
+		Namespace:       w.Namespace,
+		Labels:          accessor.GetLabels(),
+		NamespaceLabels: nsLabels,
+	}), nil
 }
 
-func printRecommendations(cpuAvg, cpuMax, memAvg, memMax int64, margin int64) {
-	cpuReqRec := calculateWithMargin(cpuAvg, margin)
-	cpuLimRec := calculateWithMargin(cpuMax, margin)
-	memReqRec := calculateWithMargin(memAvg, margin)
-	memLimRec := calculateWithMargin(memMax, margin)
-
-	fmt.Println("• Рекомендации:")
-	fmt.Printf("  CPU: requests=%4dm, limit=%4dm\n", cpuReqRec, cpuLimRec)
-	fmt.Printf("  Память: requests=%4dMi, limit=%4dMi\n\n", memReqRec, memLimRec)
+// recommendResources sizes requests from the request percentile and limits
+// from the limit percentile of observed usage, plus the safety margin.
+func recommendResources(cpu, memory types.Series, opts recommendOptions) types.ContainerResources {
+	return types.ContainerResources{
+		Requests: types.PodConfiguration{
+			CPU:    calculateWithMargin(cpu.Percentile(opts.requestPercentile), opts.margin),
+			Memory: calculateWithMargin(memory.Percentile(opts.requestPercentile), opts.margin),
+		},
+		Limits: types.PodConfiguration{
+			CPU:    calculateWithMargin(cpu.Percentile(opts.limitPercentile), opts.margin),
+			Memory: calculateWithMargin(memory.Percentile(opts.limitPercentile), opts.margin),
+		},
+	}
 }
 
 func calculateWithMargin(value int64, margin int64) int64 {
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/nightness333/k8s-monitor/pkg/apply"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	dryRunNone   = "none"
+	dryRunServer = "server"
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [namespace/kind/name ...]",
+	Short: "Возвращает ресурсы, изменённые optimize --apply",
+	Long: `Восстанавливает requests и limits, сохранённые в аннотации
+k8s-monitor/previous-resources при последнем optimize --apply.
+Без аргументов откатывает все нагрузки с этой аннотацией.`,
+	Run: runRollbackCommand,
+}
+
+func init() {
+	optimizeCmd.AddCommand(rollbackCmd)
+	addApplyFlags(optimizeCmd)
+	addApplyFlags(rollbackCmd)
+	optimizeCmd.Flags().Bool("apply", false, "Применить рекомендации к Deployment, StatefulSet и DaemonSet в кластере")
+	rollbackCmd.Flags().StringSliceP("namespaces", "n", []string{}, "Искать изменённые нагрузки только в указанных namespace (через запятую)")
+}
+
+func addApplyFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("yes", false, "Не запрашивать подтверждение")
+	cmd.Flags().String("dry-run", dryRunNone, "none или server (проверить изменения на API-сервере, не сохраняя их)")
+}
+
+// applyOptions reads --dry-run. Confirmation is not needed for a dry run.
+func applyOptions(cmd *cobra.Command) (apply.Options, bool, error) {
+	dryRun, _ := cmd.Flags().GetString("dry-run")
+	yes, _ := cmd.Flags().GetBool("yes")
+	switch dryRun {
+	case dryRunNone:
+		return apply.Options{}, yes, nil
+	case dryRunServer:
+		return apply.Options{DryRun: true}, true, nil
+	default:
+		return apply.Options{}, false, fmt.Errorf("неизвестное значение --dry-run %q (допустимы none, server)", dryRun)
+	}
+}
+
+func confirm(w io.Writer, question string) bool {
+	fmt.Fprintf(w, "%s [y/N]: ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes", "д", "да":
+		return true
+	}
+	return false
+}
+
+func dryRunSuffix(opts apply.Options) string {
+	if opts.DryRun {
+		return " (dry-run)"
+	}
+	return ""
+}
+
+// applyRecommendations patches the supported workloads with the
+// recommendations after confirmation and returns the number of failures.
+// Progress and the prompt go to w.
+func applyRecommendations(ctx context.Context, w io.Writer, clientset kubernetes.Interface, recs []*workloadRecommendation, opts apply.Options, confirmed bool) int {
+	var targets []*workloadRecommendation
+	for _, rec := range recs {
+		if len(rec.recommended) == 0 {
+			continue
+		}
+		if !apply.Supported(rec.Workload.Kind) {
+			fmt.Fprintf(w, "Пропуск %s: применяются только Deployment, StatefulSet и DaemonSet\n", rec.Workload)
+			continue
+		}
+		targets = append(targets, rec)
+	}
+	if len(targets) == 0 {
+		fmt.Fprintln(w, "Нет нагрузок для применения рекомендаций")
+		return 0
+	}
+
+	fmt.Fprintln(w, "\n=== ПРИМЕНЕНИЕ РЕКОМЕНДАЦИЙ ===")
+	for _, rec := range targets {
+		fmt.Fprintf(w, "%s:\n", rec.Workload)
+		names := make([]string, 0, len(rec.recommended))
+		for name := range rec.recommended {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			r, cur := rec.recommended[name], rec.current[name]
+			fmt.Fprintf(w, "  %-20s CPU: %dm/%dm → %dm/%dm | Память: %dMi/%dMi → %dMi/%dMi\n", name,
+				cur.Requests.CPU, cur.Limits.CPU, r.Requests.CPU, r.Limits.CPU,
+				cur.Requests.Memory, cur.Limits.Memory, r.Requests.Memory, r.Limits.Memory)
+		}
+	}
+	if !confirmed && !confirm(w, fmt.Sprintf("Применить изменения к %d нагрузкам?", len(targets))) {
+		fmt.Fprintln(w, "Отменено")
+		return 0
+	}
+
+	failed := 0
+	for _, rec := range targets {
+		if err := apply.Apply(ctx, clientset, rec.Workload, rec.recommended, opts); err != nil {
+			fmt.Fprintf(w, "Ошибка применения %s: %v\n", rec.Workload, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(w, "Применено%s: %s\n", dryRunSuffix(opts), rec.Workload)
+	}
+	return failed
+}
+
+func runRollbackCommand(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	opts, confirmed, err := applyOptions(cmd)
+	if err != nil {
+		fmt.Printf("Ошибка: %v\n", err)
+		os.Exit(1)
+	}
+
+	clientset, err := createKubernetesClient()
+	if err != nil {
+		fmt.Printf("Ошибка подключения к Kubernetes: %v\n", err)
+		os.Exit(1)
+	}
+
+	var workloads []types.Workload
+	for _, arg := range args {
+		parts := strings.Split(arg, "/")
+		if len(parts) != 3 {
+			fmt.Printf("Ошибка: ожидается namespace/kind/name, получено %q\n", arg)
+			os.Exit(1)
+		}
+		workloads = append(workloads, types.Workload{Namespace: parts[0], Kind: parts[1], Name: parts[2]})
+	}
+	if len(args) == 0 {
+		namespaces, _ := cmd.Flags().GetStringSlice("namespaces")
+		workloads, err = apply.Applied(ctx, clientset, namespaces)
+		if err != nil {
+			fmt.Printf("Ошибка поиска изменённых нагрузок: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if len(workloads) == 0 {
+		fmt.Println("Нет нагрузок для отката")
+		return
+	}
+
+	for _, w := range workloads {
+		fmt.Printf("  %s\n", w)
+	}
+	if !confirmed && !confirm(os.Stdout, fmt.Sprintf("Откатить %d нагрузок?", len(workloads))) {
+		fmt.Println("Отменено")
+		return
+	}
+
+	failed := 0
+	for _, w := range workloads {
+		skipped, err := apply.Rollback(ctx, clientset, w, opts)
+		switch {
+		case errors.Is(err, apply.ErrNoRollback):
+			fmt.Printf("Пропуск %s: %v\n", w, err)
+		case err != nil:
+			fmt.Printf("Ошибка отката %s: %v\n", w, err)
+			failed++
+		default:
+			fmt.Printf("Откачено%s: %s\n", dryRunSuffix(opts), w)
+		}
+		if err == nil && len(skipped) > 0 {
+			fmt.Printf("  контейнеров %s больше нет в шаблоне пода, их значения не восстановлены\n", strings.Join(skipped, ", "))
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nightness333/k8s-monitor/pkg/manifest"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	"github.com/nightness333/k8s-monitor/pkg/utils"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	manifestPatch     = "patch"
+	manifestYAML      = "yaml"
+	manifestKustomize = "kustomize"
+	manifestVPA       = "vpa"
+)
+
+// isLegacyManifestFormat reports the manifest formats optimize -o/--output
+// took before --manifests replaced it.
+func isLegacyManifestFormat(format string) bool {
+	switch format {
+	case manifestPatch, manifestKustomize, manifestVPA:
+		return true
+	}
+	return false
+}
+
+type manifestOptions struct {
+	format        string
+	dir           string
+	vpaUpdateMode string
+}
+
+// writeManifests writes one file per workload into dir: a strategic-merge
+// patch (patch, kustomize), the full live manifest with the recommended
+// resources (yaml) or a VerticalPodAutoscaler seeded with them (vpa).
+// kustomize also writes a kustomization.yaml listing the patches. Progress
+// goes to w.
+func writeManifests(ctx context.Context, w io.Writer, clientset kubernetes.Interface, recs []*workloadRecommendation, opts manifestOptions) error {
+	format, dir := opts.format, opts.dir
+	if err := os.MkdirAll(filepath.Clean(dir), 0755); err != nil {
+		return fmt.Errorf("ошибка создания каталога: %v", err)
+	}
+
+	var files []string
+	for _, rec := range recs {
+		if len(rec.recommended) == 0 {
+			continue
+		}
+
+		var data []byte
+		var err error
+		switch format {
+		case manifestYAML:
+			obj, spec, getErr := utils.GetWorkloadObject(ctx, clientset, rec.Workload)
+			if getErr != nil {
+				fmt.Fprintf(w, "Пропуск %s: %v\n", rec.Workload, getErr)
+				continue
+			}
+			manifest.SetResources(spec, rec.recommended)
+			data, err = manifest.Manifest(obj)
+		case manifestVPA:
+			if rec.Workload.Kind == types.WorkloadPod {
+				fmt.Fprintf(w, "Пропуск %s: VPA не поддерживает отдельные поды\n", rec.Workload)
+				continue
+			}
+			data, err = manifest.VPA(rec.Workload, rec.recommended, opts.vpaUpdateMode)
+		default:
+			data, err = manifest.Patch(rec.Workload, rec.recommended)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", rec.Workload, err)
+		}
+
+		name := manifest.FileName(rec.Workload)
+		if format == manifestVPA {
+			name = strings.TrimSuffix(name, ".yaml") + "-vpa.yaml"
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return fmt.Errorf("ошибка записи %s: %v", name, err)
+		}
+		files = append(files, name)
+	}
+
+	if format == manifestKustomize {
+		data, err := manifest.Kustomization(files)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), data, 0644); err != nil {
+			return fmt.Errorf("ошибка записи kustomization.yaml: %v", err)
+		}
+	}
+
+	fmt.Fprintf(w, "Сохранено манифестов: %d в %s\n", len(files), dir)
+	return nil
+}
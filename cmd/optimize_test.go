@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/aggregate"
+	"github.com/nightness333/k8s-monitor/pkg/manifest"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+)
+
+func appTemplate() corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+		Name:  "app",
+		Image: "web:1",
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m"), corev1.ResourceMemory: resource.MustParse("512Mi")},
+		},
+	}}}}
+}
+
+// TestSameNameDifferentKinds checks that a Deployment and a StatefulSet
+// named alike get separate recommendations and manifests.
+func TestSameNameDifferentKinds(t *testing.T) {
+	meta := metav1.ObjectMeta{Namespace: "prod", Name: "web"}
+	clientset := fake.NewSimpleClientset(
+		&appsv1.Deployment{ObjectMeta: meta, Spec: appsv1.DeploymentSpec{Template: appTemplate()}},
+		&appsv1.StatefulSet{ObjectMeta: meta, Spec: appsv1.StatefulSetSpec{Template: appTemplate()}},
+	)
+
+	agg := aggregate.NewAggregator(false, true)
+	for i := 0; i < 10; i++ {
+		for _, kind := range []string{"Deployment", "StatefulSet"} {
+			agg.Add(types.PodMetric{
+				Timestamp: testStart.Add(time.Duration(i) * time.Minute),
+				Namespace: "prod", Pod: "web-" + kind, Container: "app",
+				WorkloadKind: kind, WorkloadName: "web", Status: "OK",
+				CPU: 100, Memory: 128, HasCPU: true, HasMemory: true,
+			})
+		}
+	}
+
+	ctx := context.Background()
+	result := optimizeClusterResources(ctx, clientset, agg.Result(), recommendOptions{
+		margin: 10, requestPercentile: 95, limitPercentile: 99, includeLowConfidence: true,
+	})
+	if len(result.Skipped) != 0 {
+		t.Fatalf("skipped: %+v", result.Skipped)
+	}
+	var keys []string
+	for _, rec := range result.Workloads {
+		keys = append(keys, rec.Key)
+	}
+	if want := []string{"prod/Deployment/web", "prod/StatefulSet/web"}; len(keys) != 2 || keys[0] != want[0] || keys[1] != want[1] {
+		t.Fatalf("keys = %v, want %v", keys, want)
+	}
+
+	for _, format := range []string{manifestPatch, manifestVPA} {
+		dir := t.TempDir()
+		err := writeManifests(ctx, io.Discard, clientset, result.Workloads, manifestOptions{format: format, dir: dir, vpaUpdateMode: manifest.UpdateModeOff})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 {
+			t.Errorf("%s: %d files, want one per workload", format, len(entries))
+		}
+		if format != manifestVPA {
+			continue
+		}
+		var names []string
+		for _, e := range entries {
+			data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var vpa manifest.VerticalPodAutoscaler
+			if err := yaml.Unmarshal(data, &vpa); err != nil {
+				t.Fatalf("%s: %v", e.Name(), err)
+			}
+			names = append(names, vpa.Metadata.Name+" -> "+vpa.Spec.TargetRef.Kind)
+		}
+		sort.Strings(names)
+		if want := []string{"web-deployment -> Deployment", "web-statefulset -> StatefulSet"}; len(names) != 2 || names[0] != want[0] || names[1] != want[1] {
+			t.Errorf("VPAs = %v, want %v", names, want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/confidence"
+	"github.com/nightness333/k8s-monitor/pkg/output"
+	"github.com/nightness333/k8s-monitor/pkg/policy"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var generatedAt = regexp.MustCompile(`"generatedAt": "[^"]*"`)
+
+var (
+	testFrom = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	testTo   = testFrom.Add(24 * time.Hour)
+	testWeb  = types.Workload{Namespace: "prod", Kind: "Deployment", Name: "web"}
+)
+
+// TestDocuments pins the JSON schema of every result kind: a field that is
+// renamed or removed fails here and needs a new output.APIVersion. Run with
+// -update after adding fields.
+func TestDocuments(t *testing.T) {
+	usage := Usage{Avg: 120, Percentile: 250, Max: 300, StdDev: 40.5, Samples: 1440}
+	resources := types.ContainerResources{
+		Requests: types.PodConfiguration{CPU: 100, Memory: 128},
+		Limits:   types.PodConfiguration{CPU: 500, Memory: 256},
+	}
+	resourceUsage := ResourceUsage{Avg: 120, Median: 110, RequestPercentile: 250, LimitPercentile: 290, Max: 300, StdDev: 40.5}
+	change := policy.Change{Rule: "min-cpu", Field: "cpu.requests", From: 50, To: 100}
+
+	results := []output.Result{
+		&ReportResult{
+			From: testFrom, To: testTo, Percentile: 95, PerPod: false,
+			Summary:    ReportSummary{Workloads: 1, Pods: 2, AvgCPU: 120, AvgMemory: 200, PercentileCPU: 250, PercentileMemory: 220},
+			Namespaces: []NamespaceUsage{{Namespace: "prod", Workloads: 1, AvgCPU: 120, AvgMemory: 200, PercentileCPU: 250, PercentileMemory: 220}},
+			Workloads: []WorkloadUsage{{Key: "prod/Deployment/web", Workload: testWeb, Pods: 2, CPU: usage, Memory: usage,
+				Containers: []ContainerUsage{{Name: "app", CPU: usage, Memory: usage}}}},
+			TopCPU: []TopConsumer{{Key: "prod/Deployment/web", Value: 250, Max: 300, StdDev: 40.5, Limit: 500,
+				Containers: []ContainerTop{{Name: "app", Value: 250, Limit: 500}}}},
+			TopMemory: []TopConsumer{{Key: "prod/Deployment/web", Value: 220, Max: 240, StdDev: 10, Limit: 256}},
+			Anomalies: []Anomaly{{Key: "prod/Deployment/web", Container: "app", Resource: "cpu", Avg: 120, Max: 600, Factor: 5}},
+		},
+		&NodesResult{
+			Percentile: 95,
+			Nodes: []NodeReport{{
+				Name: "node-1", InstanceType: "m5.large", Spot: true, Problems: []string{"MemoryPressure"},
+				Allocatable: types.PodConfiguration{CPU: 1900, Memory: 7000},
+				Capacity:    types.PodConfiguration{CPU: 2000, Memory: 7680},
+				Usage: &NodeUsage{
+					Avg:        types.PodConfiguration{CPU: 800, Memory: 4000},
+					Percentile: types.PodConfiguration{CPU: 1200, Memory: 5000},
+				},
+				Requests:     &types.PodConfiguration{CPU: 1000, Memory: 3000},
+				Pods:         5,
+				PodsInPeriod: 7,
+			}},
+			Cluster: NodeTotals{
+				Nodes:       1,
+				Allocatable: types.PodConfiguration{CPU: 1900, Memory: 7000},
+				Usage:       types.PodConfiguration{CPU: 800, Memory: 4000},
+				Requests:    types.PodConfiguration{CPU: 1000, Memory: 3000},
+			},
+		},
+		&CostResult{
+			Currency: "USD", From: testFrom, To: testTo, Allocation: allocationMax, IdleMode: idleProportional,
+			PerPod: false, Total: 12.5, Waste: 2.25, MonthlyForecast: 380.21,
+			Cluster:    &ClusterCost{Nodes: 12.5, Pods: 10, Idle: 2.5},
+			Namespaces: []CostItem{{Name: "prod", CPU: 6, Memory: 4, Waste: 2.25, Idle: 2.5, Total: 12.5}},
+			Items: []CostItem{{Name: "prod/Deployment/web", Workload: &testWeb, CPU: 6, Memory: 4, Waste: 2.25, Total: 10, RuntimeSeconds: 86400,
+				Containers: []CostItem{{Name: "app", CPU: 6, Memory: 4, Waste: 2.25, Total: 10}}}},
+			GroupBy: []string{"label:team"},
+			Groups:  []*groupCost{{Values: []string{"payments"}, Pods: 2, CPUCost: 6, MemCost: 4, WasteCost: 2.25, IdleCost: 2.5, TotalCost: 12.5}},
+		},
+		&OptimizeResult{
+			RequestPercentile: 95, LimitPercentile: 99.9, Margin: 15,
+			Workloads: []*workloadRecommendation{{
+				Key: "prod/Deployment/web", Workload: testWeb,
+				Confidence: confidence.Score{Level: confidence.Medium, Reasons: []string{"данные за 12h0m0s"}},
+				CPU:        resourceUsage, Memory: resourceUsage,
+				Current: resources, Recommended: resources,
+				Changes: []policy.Change{change},
+				Containers: []ContainerRecommendation{{Name: "app", CPU: resourceUsage, Memory: resourceUsage,
+					Current: resources, Recommended: resources, Changes: []policy.Change{change}}},
+			}},
+			Skipped: []SkippedWorkload{{Key: "prod/StatefulSet/db", Workload: types.Workload{Namespace: "prod", Kind: "StatefulSet", Name: "db"}, Rule: "exclude-db"}},
+			LowConfidence: []LowConfidenceWorkload{{Key: "dev/Deployment/api", Workload: types.Workload{Namespace: "dev", Kind: "Deployment", Name: "api"},
+				Samples: 12, SpanSeconds: 3600, Reasons: []string{"мало замеров: 12"}}},
+		},
+	}
+
+	for _, result := range results {
+		t.Run(result.Kind(), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := output.Render(&buf, output.FormatJSON, result); err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			got := generatedAt.ReplaceAll(buf.Bytes(), []byte(`"generatedAt": "2024-01-02T00:00:00Z"`))
+
+			path := filepath.Join("testdata", result.Kind()+".json")
+			if *update {
+				if err := os.WriteFile(path, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("golden file: %v (run with -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s document changed:\n%s\nwant:\n%s", result.Kind(), got, want)
+			}
+		})
+	}
+}
@@ -1,14 +1,17 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
+	"strconv"
 	"time"
 
-	"github.com/nightness333/k8s-monitor/pkg/parser"
+	"github.com/nightness333/k8s-monitor/pkg/aggregate"
+	"github.com/nightness333/k8s-monitor/pkg/storage"
 	"github.com/nightness333/k8s-monitor/pkg/types"
 	"github.com/nightness333/k8s-monitor/pkg/utils"
 	"k8s.io/client-go/kubernetes"
@@ -25,25 +28,54 @@ var reportCmd = &cobra.Command{
 		- Общая статистика по CPU/памяти
 		- ТОП-5 подов по потреблению
 		- Анализ по неймспейсам
-		- Выявление аномалий`,
+		- Выявление аномалий
+
+С --format html сохраняет автономный HTML-файл с графиками потребления
+по неймспейсам и ТОП нагрузкам, утилизацией относительно лимитов,
+аномалиями и разбивкой затрат.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		file, _ := cmd.Flags().GetString("file")
 		last, _ := cmd.Flags().GetString("last")
+		perPod, _ := cmd.Flags().GetBool("per-pod")
+		percentile, _ := cmd.Flags().GetFloat64("percentile")
 
-		if err := analyzeClusterResources(file, last); err != nil {
-			fmt.Printf("Ошибка: %v\n", err)
-			os.Exit(1)
+		if err := analyzeClusterResources(cmd, last, perPod, percentile); err != nil {
+			exitf(cmd, "Ошибка: %v", err)
 		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(reportCmd)
+	addReadFlags(reportCmd)
 	reportCmd.Flags().StringP("file", "f", "data.csv", "Файл с метриками")
 	reportCmd.Flags().StringP("last", "l", "24h", "Анализировать данные за период (1h, 24h, 7d)")
+	reportCmd.Flags().Bool("per-pod", false, "Группировать по подам, а не по нагрузкам (Deployment, StatefulSet, ...)")
+	reportCmd.Flags().Float64P("percentile", "p", 95, "Перцентиль для ранжирования и утилизации (0-100)")
+	reportCmd.Flags().String("format", reportText, "Вид отчёта: text (в stdout в формате --output) или html (автономный HTML-файл с графиками)")
+	reportCmd.Flags().String("html-file", "report.html", "Файл для --format html")
+	addPercentileFlags(reportCmd)
+	addPricingFlags(reportCmd)
 }
 
-func analyzeClusterResources(filePath, timeRange string) error {
+func analyzeClusterResources(cmd *cobra.Command, timeRange string, perPod bool, percentile float64) error {
+	ctx := cmd.Context()
+
+	if percentile < 0 || percentile > 100 {
+		return fmt.Errorf("перцентиль должен быть в диапазоне 0-100: %v", percentile)
+	}
+	if _, err := outputFormat(cmd); err != nil {
+		return err
+	}
+	format, _ := cmd.Flags().GetString("format")
+	switch format {
+	case reportText, reportHTML:
+	default:
+		return fmt.Errorf("неизвестный формат отчёта %q (допустимы text, html)", format)
+	}
+	if format == reportHTML && cmd.Flags().Changed("output") {
+		return fmt.Errorf("--format html нельзя совмещать с --output")
+	}
+
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		kubeconfig := filepath.Join(os.Getenv("HOME"), ".kube", "config")
@@ -58,153 +90,432 @@ func analyzeClusterResources(filePath, timeRange string) error {
 		return fmt.Errorf("ошибка создания клиента Kubernetes: %v", err)
 	}
 
-	metrics, err := parser.ParseCSV(filePath)
-	if err != nil {
-		return err
-	}
-
 	duration, err := time.ParseDuration(timeRange)
 	if err != nil {
 		return fmt.Errorf("неверный формат периода: %v", err)
 	}
-	timeThreshold := time.Now().Add(-duration)
 
-	metricsMap := make(map[string]*types.PodStats)
-	for _, m := range metrics {
-		if m.Timestamp.Before(timeThreshold) {
-			continue
+	to := time.Now()
+	from := to.Add(-duration)
+	q := storage.Query{From: from}
+
+	var charts *reportCharts
+	if format == reportHTML {
+		if charts, err = newReportCharts(cmd, q, to, perPod); err != nil {
+			return err
+		}
+	}
+	exact, _ := cmd.Flags().GetBool("exact-percentiles")
+	aggregator := aggregate.NewAggregator(perPod, exact)
+	err = scanMetrics(cmd, q, func(m types.PodMetric) error {
+		aggregator.Add(m)
+		if charts != nil {
+			return charts.Add(m)
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	metricsMap := aggregator.Result()
+	if len(metricsMap) == 0 {
+		return fmt.Errorf("нет данных за период %s", timeRange)
+	}
 
-		key := m.Namespace + "/" + m.Pod
-		if _, exists := metricsMap[key]; !exists {
-			metricsMap[key] = &types.PodStats{
-				Status: m.Status,
-			}
+	result := &ReportResult{
+		From:       from,
+		To:         to,
+		Percentile: percentile,
+		PerPod:     perPod,
+		Workloads:  workloadUsages(metricsMap, percentile),
+		Anomalies:  findAnomalies(metricsMap),
+	}
+	result.Summary = summarize(result.Workloads)
+	result.Namespaces = namespaceUsages(result.Workloads)
+	result.TopCPU, result.TopMemory = topConsumers(ctx, metricsMap, clientset, percentile)
+
+	if charts != nil {
+		path, _ := cmd.Flags().GetString("html-file")
+		if err := writeHTMLReport(path, result, charts); err != nil {
+			return err
 		}
-		metricsMap[key].CPU = append(metricsMap[key].CPU, m.CPU)
-		metricsMap[key].Memory = append(metricsMap[key].Memory, m.Memory)
+		fmt.Printf("Отчёт сохранён в %s\n", path)
+		return nil
 	}
+	return render(cmd, result)
+}
 
-	printSummary(metricsMap)
-	printNamespaceStats(metricsMap)
-	printTopConsumers(metricsMap, clientset)
-	printAnomalies(metricsMap)
+// ReportResult is the outcome of the report command. CPU is in millicores,
+// memory in MiB.
+type ReportResult struct {
+	From       time.Time        `json:"from"`
+	To         time.Time        `json:"to"`
+	Percentile float64          `json:"percentile"`
+	PerPod     bool             `json:"perPod"`
+	Summary    ReportSummary    `json:"summary"`
+	Namespaces []NamespaceUsage `json:"namespaces"`
+	Workloads  []WorkloadUsage  `json:"workloads"`
+	TopCPU     []TopConsumer    `json:"topCPU"`
+	TopMemory  []TopConsumer    `json:"topMemory"`
+	Anomalies  []Anomaly        `json:"anomalies"`
+}
 
-	return nil
+// ReportSummary averages usage over the analyzed workloads.
+type ReportSummary struct {
+	Workloads        int   `json:"workloads"`
+	Pods             int   `json:"pods"`
+	AvgCPU           int64 `json:"avgCPU"`
+	AvgMemory        int64 `json:"avgMemory"`
+	PercentileCPU    int64 `json:"percentileCPU"`
+	PercentileMemory int64 `json:"percentileMemory"`
+}
+
+// NamespaceUsage averages usage over the workloads of a namespace.
+type NamespaceUsage struct {
+	Namespace        string `json:"namespace"`
+	Workloads        int    `json:"workloads"`
+	AvgCPU           int64  `json:"avgCPU"`
+	AvgMemory        int64  `json:"avgMemory"`
+	PercentileCPU    int64  `json:"percentileCPU"`
+	PercentileMemory int64  `json:"percentileMemory"`
 }
 
-func printSummary(data map[string]*types.PodStats) {
-	fmt.Println("\n=== ОБЩАЯ СТАТИСТИКА ===")
-	fmt.Printf("Анализируется %d подов\n", len(data))
+// Usage summarizes a series of samples.
+type Usage struct {
+	Avg        int64   `json:"avg"`
+	Percentile int64   `json:"percentile"`
+	Max        int64   `json:"max"`
+	StdDev     float64 `json:"stdDev"`
+	Samples    int64   `json:"samples"`
+}
 
-	var totalCPU, totalMem int64
-	for _, m := range data {
-		totalCPU += utils.Avg(m.CPU)
-		totalMem += utils.Avg(m.Memory)
-	}
+type WorkloadUsage struct {
+	Key        string           `json:"key"`
+	Workload   types.Workload   `json:"workload"`
+	Pods       int              `json:"pods"`
+	CPU        Usage            `json:"cpu"`
+	Memory     Usage            `json:"memory"`
+	Containers []ContainerUsage `json:"containers,omitempty"`
+}
+
+type ContainerUsage struct {
+	Name   string `json:"name"`
+	CPU    Usage  `json:"cpu"`
+	Memory Usage  `json:"memory"`
+}
 
-	fmt.Printf("Среднее по кластеру:\nCPU: %dm | Память: %dMi\n",
-		totalCPU/int64(len(data)),
-		totalMem/int64(len(data)))
+// TopConsumer is a workload ranked by one resource at the percentile, with
+// the configured limits when the cluster reports them (0 otherwise).
+type TopConsumer struct {
+	Key        string         `json:"key"`
+	Value      int64          `json:"value"`
+	Max        int64          `json:"max"`
+	StdDev     float64        `json:"stdDev"`
+	Limit      int64          `json:"limit"`
+	Containers []ContainerTop `json:"containers,omitempty"`
 }
 
-func printNamespaceStats(data map[string]*types.PodStats) {
-	nsStats := make(map[string]*struct{ cpu, mem, count int64 })
+type ContainerTop struct {
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+	Limit int64  `json:"limit"`
+}
+
+// Anomaly is a spike of max usage over the average.
+type Anomaly struct {
+	Key       string  `json:"key"`
+	Container string  `json:"container,omitempty"`
+	Resource  string  `json:"resource"`
+	Avg       int64   `json:"avg"`
+	Max       int64   `json:"max"`
+	Factor    float64 `json:"factor"`
+}
 
-	for key, m := range data {
-		ns := strings.Split(key, "/")[0]
-		if _, ok := nsStats[ns]; !ok {
-			nsStats[ns] = &struct{ cpu, mem, count int64 }{}
+func (r *ReportResult) Kind() string { return "Report" }
+
+func (r *ReportResult) WriteTable(w io.Writer) error {
+	label := percentileLabel(r.Percentile)
+
+	fmt.Fprintln(w, "\n=== ОБЩАЯ СТАТИСТИКА ===")
+	fmt.Fprintf(w, "Анализируется %d нагрузок (%d подов)\n", r.Summary.Workloads, r.Summary.Pods)
+	fmt.Fprintf(w, "Среднее по кластеру:\nCPU: %dm | Память: %dMi\n", r.Summary.AvgCPU, r.Summary.AvgMemory)
+	fmt.Fprintf(w, "%s по кластеру (среднее по нагрузкам):\nCPU: %dm | Память: %dMi\n",
+		label, r.Summary.PercentileCPU, r.Summary.PercentileMemory)
+
+	fmt.Fprintln(w, "\n=== ПО НЕЙМСПЕЙСАМ ===")
+	for _, ns := range r.Namespaces {
+		fmt.Fprintf(w, "%-15s: %3d нагрузок | CPU: %4dm (%s %4dm) | Память: %4dMi (%s %4dMi)\n",
+			ns.Namespace, ns.Workloads,
+			ns.AvgCPU, label, ns.PercentileCPU,
+			ns.AvgMemory, label, ns.PercentileMemory)
+	}
+
+	fmt.Fprintf(w, "\n=== ТОП-5 ПО CPU (%s) ===\n", label)
+	writeTopConsumers(w, r.TopCPU, "m")
+	fmt.Fprintf(w, "\n=== ТОП-5 ПО ПАМЯТИ (%s) ===\n", label)
+	writeTopConsumers(w, r.TopMemory, "Mi")
+
+	fmt.Fprintln(w, "\n=== АНОМАЛИИ ===")
+	if len(r.Anomalies) == 0 {
+		fmt.Fprintln(w, "Критических аномалий не обнаружено")
+	}
+	for i, a := range r.Anomalies {
+		if i == 0 || a.Key != r.Anomalies[i-1].Key || a.Container != r.Anomalies[i-1].Container {
+			title := a.Key
+			if a.Container != "" {
+				title = fmt.Sprintf("%s, контейнер %s", a.Key, a.Container)
+			}
+			fmt.Fprintf(w, "%s:\n", title)
+		}
+		if a.Resource == "cpu" {
+			fmt.Fprintf(w, "  - CPU: скачок с %dm до %dm (x%.1f)\n", a.Avg, a.Max, a.Factor)
+		} else {
+			fmt.Fprintf(w, "  - Память: скачок с %dMi до %dMi (x%.1f)\n", a.Avg, a.Max, a.Factor)
 		}
-		nsStats[ns].cpu += utils.Avg(m.CPU)
-		nsStats[ns].mem += utils.Avg(m.Memory)
-		nsStats[ns].count++
 	}
+	return nil
+}
+
+// Records lists the workloads.
+func (r *ReportResult) Records() [][]string {
+	records := [][]string{{"namespace", "kind", "name", "pods",
+		"cpu_avg", "cpu_percentile", "cpu_max", "memory_avg", "memory_percentile", "memory_max"}}
+	for _, u := range r.Workloads {
+		records = append(records, []string{u.Workload.Namespace, u.Workload.Kind, u.Workload.Name, strconv.Itoa(u.Pods),
+			formatInt(u.CPU.Avg), formatInt(u.CPU.Percentile), formatInt(u.CPU.Max),
+			formatInt(u.Memory.Avg), formatInt(u.Memory.Percentile), formatInt(u.Memory.Max)})
+	}
+	return records
+}
+
+func formatInt(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+func seriesUsage(s types.Series, percentile float64) Usage {
+	return Usage{Avg: s.Avg(), Percentile: s.Percentile(percentile), Max: s.Max, StdDev: s.StdDev(), Samples: s.Count}
+}
 
-	fmt.Println("\n=== ПО НЕЙМСПЕЙСАМ ===")
-	for ns, stats := range nsStats {
-		fmt.Printf("%-15s: %3d подов | CPU: %4dm | Память: %4dMi\n",
-			ns, stats.count, stats.cpu/stats.count, stats.mem/stats.count)
+// workloadUsages lists the workloads sorted by key.
+func workloadUsages(data map[string]*types.PodStats, percentile float64) []WorkloadUsage {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	usages := make([]WorkloadUsage, 0, len(keys))
+	for _, key := range keys {
+		m := data[key]
+		u := WorkloadUsage{
+			Key:      key,
+			Workload: m.Workload,
+			Pods:     len(m.Pods),
+			CPU:      seriesUsage(m.CPU, percentile),
+			Memory:   seriesUsage(m.Memory, percentile),
+		}
+		for _, name := range containerNames(m) {
+			c := m.Containers[name]
+			u.Containers = append(u.Containers, ContainerUsage{
+				Name:   name,
+				CPU:    seriesUsage(c.CPU, percentile),
+				Memory: seriesUsage(c.Memory, percentile),
+			})
+		}
+		usages = append(usages, u)
 	}
+	return usages
 }
 
-func printTopConsumers(data map[string]*types.PodStats, clientset *kubernetes.Clientset) {
-	type rankedPod struct {
-		Name   string
-		CPU    int64
-		Memory int64
+func summarize(usages []WorkloadUsage) ReportSummary {
+	var s ReportSummary
+	for _, u := range usages {
+		s.Pods += u.Pods
+		s.AvgCPU += u.CPU.Avg
+		s.AvgMemory += u.Memory.Avg
+		s.PercentileCPU += u.CPU.Percentile
+		s.PercentileMemory += u.Memory.Percentile
+	}
+	s.Workloads = len(usages)
+	if n := int64(len(usages)); n > 0 {
+		s.AvgCPU /= n
+		s.AvgMemory /= n
+		s.PercentileCPU /= n
+		s.PercentileMemory /= n
 	}
+	return s
+}
 
-	pods := make([]rankedPod, 0, len(data))
-	for key, m := range data {
-		pods = append(pods, rankedPod{
-			Name:   key,
-			CPU:    utils.Max(m.CPU),
-			Memory: utils.Max(m.Memory),
-		})
+func namespaceUsages(usages []WorkloadUsage) []NamespaceUsage {
+	index := make(map[string]int)
+	var namespaces []NamespaceUsage
+	for _, u := range usages {
+		ns := u.Workload.Namespace
+		i, ok := index[ns]
+		if !ok {
+			i = len(namespaces)
+			index[ns] = i
+			namespaces = append(namespaces, NamespaceUsage{Namespace: ns})
+		}
+		n := &namespaces[i]
+		n.Workloads++
+		n.AvgCPU += u.CPU.Avg
+		n.AvgMemory += u.Memory.Avg
+		n.PercentileCPU += u.CPU.Percentile
+		n.PercentileMemory += u.Memory.Percentile
+	}
+	for i := range namespaces {
+		n := &namespaces[i]
+		count := int64(n.Workloads)
+		n.AvgCPU /= count
+		n.AvgMemory /= count
+		n.PercentileCPU /= count
+		n.PercentileMemory /= count
 	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Namespace < namespaces[j].Namespace })
+	return namespaces
+}
 
-	sort.Slice(pods, func(i, j int) bool { return pods[i].CPU > pods[j].CPU })
-	fmt.Println("\n=== ТОП-5 ПО CPU ===")
-	for i := 0; i < len(pods) && i < 5; i++ {
-		ns, name := utils.SplitPodKey(pods[i].Name)
-		limits, _ := utils.GetPodLimits(clientset, ns, name)
+func percentileLabel(percentile float64) string {
+	return "p" + strconv.FormatFloat(percentile, 'f', -1, 64)
+}
 
-		fmt.Printf("%d. %-40s: %4dm", i+1, pods[i].Name, pods[i].CPU)
-		if limits != nil && limits.CPU > 0 {
-			utilization := 100 * pods[i].CPU / limits.CPU
-			fmt.Printf(" (Лимит: %dm, Использование: %d%%)", limits.CPU, utilization)
+// topConsumers ranks by the given percentile rather than by the single
+// highest sample, so one spike does not put a workload on top.
+func topConsumers(ctx context.Context, data map[string]*types.PodStats, clientset kubernetes.Interface, percentile float64) (topCPU, topMemory []TopConsumer) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	resources := make(map[string]map[string]types.ContainerResources)
+	containerResources := func(key string) map[string]types.ContainerResources {
+		if r, ok := resources[key]; ok {
+			return r
 		}
-		fmt.Println()
+		r, _ := utils.GetWorkloadContainerResources(ctx, clientset, data[key].Workload)
+		resources[key] = r
+		return r
 	}
 
-	sort.Slice(pods, func(i, j int) bool { return pods[i].Memory > pods[j].Memory })
-	fmt.Println("\n=== ТОП-5 ПО ПАМЯТИ ===")
-	for i := 0; i < len(pods) && i < 5; i++ {
-		ns, name := utils.SplitPodKey(pods[i].Name)
-		limits, _ := utils.GetPodLimits(clientset, ns, name)
+	top := func(memory bool) []TopConsumer {
+		pick := func(cpu, mem types.Series) types.Series {
+			if memory {
+				return mem
+			}
+			return cpu
+		}
+		limit := func(r types.ContainerResources) int64 {
+			if memory {
+				return r.Limits.Memory
+			}
+			return r.Limits.CPU
+		}
 
-		fmt.Printf("%d. %-40s: %4dMi", i+1, pods[i].Name, pods[i].Memory)
-		if limits != nil && limits.Memory > 0 {
-			utilization := 100 * pods[i].Memory / limits.Memory
-			fmt.Printf(" (Лимит: %dMi, Использование: %d%%)", limits.Memory, utilization)
+		sort.SliceStable(keys, func(i, j int) bool {
+			a, b := data[keys[i]], data[keys[j]]
+			return pick(a.CPU, a.Memory).Percentile(percentile) > pick(b.CPU, b.Memory).Percentile(percentile)
+		})
+		var consumers []TopConsumer
+		for i := 0; i < len(keys) && i < 5; i++ {
+			m := data[keys[i]]
+			s := pick(m.CPU, m.Memory)
+			containers := containerResources(keys[i])
+			c := TopConsumer{Key: keys[i], Value: s.Percentile(percentile), Max: s.Max, StdDev: s.StdDev()}
+			for _, r := range containers {
+				c.Limit += limit(r)
+			}
+			for _, name := range containerNames(m) {
+				stats := m.Containers[name]
+				c.Containers = append(c.Containers, ContainerTop{
+					Name:  name,
+					Value: pick(stats.CPU, stats.Memory).Percentile(percentile),
+					Limit: limit(containers[name]),
+				})
+			}
+			consumers = append(consumers, c)
 		}
-		fmt.Println()
+		return consumers
 	}
+	return top(false), top(true)
 }
 
-func printAnomalies(data map[string]*types.PodStats) {
-	fmt.Println("\n=== АНОМАЛИИ ===")
-	found := false
+func writeTopConsumers(w io.Writer, consumers []TopConsumer, unit string) {
+	for i, c := range consumers {
+		fmt.Fprintf(w, "%d. %-40s: %4d%s (макс %d%s, σ %.0f%s)", i+1, c.Key, c.Value, unit, c.Max, unit, c.StdDev, unit)
+		writeUtilization(w, c.Value, c.Limit, unit)
+		fmt.Fprintln(w)
 
-	for key, m := range data {
-		if len(m.CPU) < 10 {
-			continue
+		for _, container := range c.Containers {
+			fmt.Fprintf(w, "     └ %-36s: %4d%s", container.Name, container.Value, unit)
+			writeUtilization(w, container.Value, container.Limit, unit)
+			fmt.Fprintln(w)
 		}
+	}
+}
 
-		avgCPU := utils.Avg(m.CPU)
-		maxCPU := utils.Max(m.CPU)
-		cpuSpike := float64(maxCPU)/float64(avgCPU) > 3 && maxCPU > 500
+func writeUtilization(w io.Writer, value, limit int64, unit string) {
+	if limit > 0 {
+		fmt.Fprintf(w, " (Лимит: %d%s, Использование: %d%%)", limit, unit, 100*value/limit)
+	}
+}
 
-		avgMem := utils.Avg(m.Memory)
-		maxMem := utils.Max(m.Memory)
-		memSpike := float64(maxMem)/float64(avgMem) > 3 && maxMem > 1024
+func containerNames(stats *types.PodStats) []string {
+	names := make([]string, 0, len(stats.Containers))
+	for name := range stats.Containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
 
-		if cpuSpike || memSpike {
-			found = true
-			fmt.Printf("Под %s:\n", key)
-			if cpuSpike {
-				fmt.Printf("  - CPU: скачок с %dm до %dm (x%.1f)\n",
-					avgCPU, maxCPU, float64(maxCPU)/float64(avgCPU))
-			}
-			if memSpike {
-				fmt.Printf("  - Память: скачок с %dMi до %dMi (x%.1f)\n",
-					avgMem, maxMem, float64(maxMem)/float64(avgMem))
-			}
+// findAnomalies lists usage spikes per container, or per workload for data
+// recorded without containers.
+func findAnomalies(data map[string]*types.PodStats) []Anomaly {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	anomalies := []Anomaly{}
+	for _, key := range keys {
+		m := data[key]
+		if len(m.Containers) == 0 {
+			anomalies = append(anomalies, seriesAnomalies(key, "", m.CPU, m.Memory)...)
+			continue
+		}
+		for _, name := range containerNames(m) {
+			c := m.Containers[name]
+			anomalies = append(anomalies, seriesAnomalies(key, name, c.CPU, c.Memory)...)
 		}
 	}
+	return anomalies
+}
+
+func seriesAnomalies(key, container string, cpu, memory types.Series) []Anomaly {
+	if cpu.Count < 10 {
+		return nil
+	}
+
+	var anomalies []Anomaly
+	if avg, max := cpu.Avg(), cpu.Max; spikeFactor(avg, max) > 3 && max > 500 {
+		anomalies = append(anomalies, Anomaly{Key: key, Container: container, Resource: "cpu",
+			Avg: avg, Max: max, Factor: spikeFactor(avg, max)})
+	}
+	if avg, max := memory.Avg(), memory.Max; spikeFactor(avg, max) > 3 && max > 1024 {
+		anomalies = append(anomalies, Anomaly{Key: key, Container: container, Resource: "memory",
+			Avg: avg, Max: max, Factor: spikeFactor(avg, max)})
+	}
+	return anomalies
+}
 
-	if !found {
-		fmt.Println("Критических аномалий не обнаружено")
+// spikeFactor is max over avg; a zero average counts as one unit so the
+// factor stays finite.
+func spikeFactor(avg, max int64) float64 {
+	if avg < 1 {
+		avg = 1
 	}
+	return float64(max) / float64(avg)
 }
@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/aggregate"
+	"github.com/nightness333/k8s-monitor/pkg/chart"
+	"github.com/nightness333/k8s-monitor/pkg/pricing"
+	"github.com/nightness333/k8s-monitor/pkg/storage"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	reportText = "text"
+	reportHTML = "html"
+
+	// htmlChartBuckets is the number of points of a chart line over the
+	// analysed period.
+	htmlChartBuckets = 120
+	htmlTopCosts     = 10
+)
+
+// reportCharts collects what the HTML report adds to the text one while the
+// samples are streamed: usage over time per namespace and per workload, and
+// the cost of the period.
+type reportCharts struct {
+	groupBy    func(types.PodMetric) types.Workload
+	namespaces *aggregate.Timeline
+	workloads  *aggregate.Timeline
+	usage      *podUsage
+	nodes      *nodeUsage
+	filtered   bool
+	model      *pricing.Model
+	perPod     bool
+}
+
+func newReportCharts(cmd *cobra.Command, q storage.Query, to time.Time, perPod bool) (*reportCharts, error) {
+	model, err := loadPricing(cmd)
+	if err != nil {
+		return nil, err
+	}
+	usage, nodes, err := scanNodePricing(cmd, q, model, defaultMaxGap, allocationUsage)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения данных узлов: %v", err)
+	}
+	return &reportCharts{
+		groupBy:    aggregate.GroupBy(perPod),
+		namespaces: aggregate.NewTimeline(q.From, to, htmlChartBuckets),
+		workloads:  aggregate.NewTimeline(q.From, to, htmlChartBuckets),
+		usage:      usage,
+		nodes:      nodes,
+		filtered:   namespaceFiltered(cmd),
+		model:      model,
+		perPod:     perPod,
+	}, nil
+}
+
+func (c *reportCharts) Add(m types.PodMetric) error {
+	c.namespaces.Add(m.Namespace, m)
+	c.workloads.Add(c.groupBy(m).String(), m)
+	return c.usage.Add(m)
+}
+
+// htmlView is the data of the HTML template.
+type htmlView struct {
+	Report      *ReportResult
+	Label       string
+	GeneratedAt time.Time
+	Namespaces  []htmlNamespace
+	TopCPU      template.HTML
+	TopMemory   template.HTML
+	Utilization []htmlUtilization
+	Cost        *CostResult
+	CostShares  []htmlCostShare
+	CostItems   []CostItem
+}
+
+type htmlNamespace struct {
+	Usage  NamespaceUsage
+	CPU    template.HTML
+	Memory template.HTML
+}
+
+type htmlUtilization struct {
+	Name     string
+	Resource string
+	Unit     string
+	Value    int64
+	Limit    int64
+	Percent  int64
+	Bar      template.HTML
+}
+
+type htmlCostShare struct {
+	Item    CostItem
+	Percent float64
+	Bar     template.HTML
+}
+
+// writeHTMLReport renders the report as a single HTML file with inline SVG
+// charts and no external resources.
+func writeHTMLReport(path string, r *ReportResult, c *reportCharts) error {
+	view := htmlView{
+		Report:      r,
+		Label:       percentileLabel(r.Percentile),
+		GeneratedAt: time.Now(),
+	}
+
+	gap := 2 * c.namespaces.Step
+	for _, ns := range r.Namespaces {
+		cpu, memory := timelineSeries(c.namespaces, []string{ns.Namespace})
+		view.Namespaces = append(view.Namespaces, htmlNamespace{
+			Usage:  ns,
+			CPU:    chart.Line(cpu, "m", gap),
+			Memory: chart.Line(memory, "Mi", gap),
+		})
+	}
+
+	gap = 2 * c.workloads.Step
+	cpu, _ := timelineSeries(c.workloads, topKeys(r.TopCPU))
+	_, memory := timelineSeries(c.workloads, topKeys(r.TopMemory))
+	view.TopCPU = chart.Line(cpu, "m", gap)
+	view.TopMemory = chart.Line(memory, "Mi", gap)
+
+	view.Utilization = append(utilizationRows(r.TopCPU, "CPU", "m"), utilizationRows(r.TopMemory, "Память", "Mi")...)
+
+	if len(c.usage.pods) > 0 {
+		view.Cost, _ = calculateCosts(c.usage, coveredNodeCost(c.usage, c.nodes, c.filtered), c.model, c.perPod, idleNone)
+		for _, ns := range view.Cost.Namespaces {
+			share := htmlCostShare{Item: ns, Bar: chart.Share(ns.Total, view.Cost.Total)}
+			if view.Cost.Total > 0 {
+				share.Percent = 100 * ns.Total / view.Cost.Total
+			}
+			view.CostShares = append(view.CostShares, share)
+		}
+		view.CostItems = view.Cost.Items[:min(len(view.Cost.Items), htmlTopCosts)]
+	}
+
+	funcs := template.FuncMap{
+		"date": func(t time.Time) string { return t.Format("02.01.2006 15:04 MST") },
+		"money": func(v float64) string {
+			return c.model.Format(v)
+		},
+		"unit": func(resource string) string {
+			if resource == "memory" {
+				return "Mi"
+			}
+			return "m"
+		},
+	}
+	tmpl, err := template.New("report").Funcs(funcs).Parse(htmlTemplate)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, view); err != nil {
+		return fmt.Errorf("ошибка формирования отчёта: %v", err)
+	}
+	if err := os.WriteFile(filepath.Clean(path), buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("ошибка записи отчёта: %v", err)
+	}
+	return nil
+}
+
+// timelineSeries returns the CPU and memory series of the keys that have
+// data.
+func timelineSeries(t *aggregate.Timeline, keys []string) (cpu, memory []chart.Series) {
+	for _, key := range keys {
+		points := t.Points(key)
+		if len(points) == 0 {
+			continue
+		}
+		c := chart.Series{Name: key}
+		m := chart.Series{Name: key}
+		for _, p := range points {
+			c.Points = append(c.Points, chart.Point{Time: p.Time, Value: float64(p.CPU)})
+			m.Points = append(m.Points, chart.Point{Time: p.Time, Value: float64(p.Memory)})
+		}
+		cpu = append(cpu, c)
+		memory = append(memory, m)
+	}
+	return cpu, memory
+}
+
+func topKeys(consumers []TopConsumer) []string {
+	keys := make([]string, 0, len(consumers))
+	for _, c := range consumers {
+		keys = append(keys, c.Key)
+	}
+	return keys
+}
+
+// utilizationRows lists the top consumers that have a limit, and their
+// containers when there are several.
+func utilizationRows(consumers []TopConsumer, resource, unit string) []htmlUtilization {
+	var rows []htmlUtilization
+	add := func(name string, value, limit int64) {
+		if limit <= 0 {
+			return
+		}
+		rows = append(rows, htmlUtilization{
+			Name:     name,
+			Resource: resource,
+			Unit:     unit,
+			Value:    value,
+			Limit:    limit,
+			Percent:  100 * value / limit,
+			Bar:      chart.Bar(float64(value), float64(limit)),
+		})
+	}
+	for _, c := range consumers {
+		add(c.Key, c.Value, c.Limit)
+		if len(c.Containers) < 2 {
+			continue
+		}
+		for _, container := range c.Containers {
+			add(c.Key+" / "+container.Name, container.Value, container.Limit)
+		}
+	}
+	return rows
+}
+
+const htmlTemplate = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<title>Отчёт k8s-monitor: {{date .Report.From}} — {{date .Report.To}}</title>
+<style>
+body{font-family:sans-serif;color:#222;max-width:1500px;margin:24px auto;padding:0 16px}
+h1{font-size:22px}
+h2{font-size:18px;margin-top:32px;border-bottom:1px solid #ddd;padding-bottom:4px}
+h3{font-size:14px;margin:12px 0 4px}
+table{border-collapse:collapse;font-size:13px;margin:8px 0}
+th,td{padding:4px 10px;text-align:left;border-bottom:1px solid #eee;vertical-align:middle}
+.num{text-align:right;white-space:nowrap}
+.grid{display:grid;grid-template-columns:repeat(auto-fill,minmax(520px,1fr));gap:16px}
+.cards{display:flex;flex-wrap:wrap;gap:12px}
+.card{border:1px solid #ddd;border-radius:6px;padding:8px 16px}
+.card b{display:block;font-size:20px;margin-top:4px}
+.muted{color:#777}
+svg{max-width:100%;height:auto}
+</style>
+</head>
+<body>
+<h1>Отчёт по ресурсам кластера</h1>
+<p class="muted">Период: {{date .Report.From}} — {{date .Report.To}}. Сформирован {{date .GeneratedAt}}. CPU в миллиядрах (m), память в Mi.</p>
+
+<div class="cards">
+<div class="card">Нагрузок<b>{{.Report.Summary.Workloads}}</b></div>
+<div class="card">Подов<b>{{.Report.Summary.Pods}}</b></div>
+<div class="card">CPU, среднее по нагрузкам<b>{{.Report.Summary.AvgCPU}}m</b></div>
+<div class="card">Память, среднее по нагрузкам<b>{{.Report.Summary.AvgMemory}}Mi</b></div>
+<div class="card">Аномалий<b>{{len .Report.Anomalies}}</b></div>
+{{with .Cost}}<div class="card">Стоимость за период<b>{{money .Total}}</b></div>{{end}}
+</div>
+
+<h2>Потребление по неймспейсам</h2>
+<table>
+<tr><th>Namespace</th><th class="num">Нагрузок</th><th class="num">CPU, среднее</th><th class="num">CPU, {{.Label}}</th><th class="num">Память, среднее</th><th class="num">Память, {{.Label}}</th></tr>
+{{range .Report.Namespaces}}<tr><td>{{.Namespace}}</td><td class="num">{{.Workloads}}</td><td class="num">{{.AvgCPU}}m</td><td class="num">{{.PercentileCPU}}m</td><td class="num">{{.AvgMemory}}Mi</td><td class="num">{{.PercentileMemory}}Mi</td></tr>
+{{end}}</table>
+<p class="muted">Графики показывают суммарное потребление всех подов неймспейса.</p>
+<div class="grid">
+{{range .Namespaces}}<div><h3>{{.Usage.Namespace}}: CPU</h3>{{.CPU}}</div>
+<div><h3>{{.Usage.Namespace}}: память</h3>{{.Memory}}</div>
+{{end}}</div>
+
+<h2>ТОП нагрузок по потреблению ({{.Label}})</h2>
+<div class="grid">
+<div><h3>CPU</h3>{{.TopCPU}}</div>
+<div><h3>Память</h3>{{.TopMemory}}</div>
+</div>
+
+<h2>Утилизация относительно лимитов ({{.Label}})</h2>
+{{if .Utilization}}<table>
+<tr><th>Нагрузка / контейнер</th><th>Ресурс</th><th class="num">Потребление</th><th class="num">Лимит</th><th>Утилизация</th><th class="num"></th></tr>
+{{range .Utilization}}<tr><td>{{.Name}}</td><td>{{.Resource}}</td><td class="num">{{.Value}}{{.Unit}}</td><td class="num">{{.Limit}}{{.Unit}}</td><td>{{.Bar}}</td><td class="num">{{.Percent}}%</td></tr>
+{{end}}</table>
+{{else}}<p>У ТОП нагрузок не заданы лимиты.</p>
+{{end}}
+<h2>Аномалии</h2>
+{{if .Report.Anomalies}}<table>
+<tr><th>Нагрузка</th><th>Контейнер</th><th>Ресурс</th><th class="num">Среднее</th><th class="num">Максимум</th><th class="num">Рост</th></tr>
+{{range .Report.Anomalies}}<tr><td>{{.Key}}</td><td>{{.Container}}</td><td>{{if eq .Resource "memory"}}Память{{else}}CPU{{end}}</td><td class="num">{{.Avg}}{{unit .Resource}}</td><td class="num">{{.Max}}{{unit .Resource}}</td><td class="num">x{{printf "%.1f" .Factor}}</td></tr>
+{{end}}</table>
+{{else}}<p>Критических аномалий не обнаружено.</p>
+{{end}}
+<h2>Затраты</h2>
+{{with .Cost}}<p>Фактически за период: <b>{{money .Total}}</b>. Простой (запрошено, но не использовано): {{money .Waste}}. Прогноз на месяц: {{money .MonthlyForecast}}.</p>
+{{with .Cluster}}<p>Стоимость узлов, на которых работали поды: {{money .Nodes}}, распределено по подам: {{money .Pods}}, простаивающая ёмкость: {{money .Idle}}.</p>
+{{end}}<h3>По неймспейсам</h3>
+<table>
+<tr><th>Namespace</th><th class="num">Итого</th><th>Доля</th><th class="num"></th><th class="num">CPU</th><th class="num">Память</th><th class="num">Простой</th></tr>
+{{range $.CostShares}}<tr><td>{{.Item.Name}}</td><td class="num">{{money .Item.Total}}</td><td>{{.Bar}}</td><td class="num">{{printf "%.1f" .Percent}}%</td><td class="num">{{money .Item.CPU}}</td><td class="num">{{money .Item.Memory}}</td><td class="num">{{money .Item.Waste}}</td></tr>
+{{end}}</table>
+<h3>Самые дорогие {{if .PerPod}}поды{{else}}нагрузки{{end}}</h3>
+<table>
+<tr><th>{{if .PerPod}}Под{{else}}Нагрузка{{end}}</th><th class="num">Итого</th><th class="num">CPU</th><th class="num">Память</th><th class="num">Простой</th></tr>
+{{range $.CostItems}}<tr><td>{{.Name}}</td><td class="num">{{money .Total}}</td><td class="num">{{money .CPU}}</td><td class="num">{{money .Memory}}</td><td class="num">{{money .Waste}}</td></tr>
+{{end}}</table>
+{{else}}<p>Нет данных для расчёта стоимости.</p>
+{{end}}</body>
+</html>
+`
@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/aggregate"
+	"github.com/nightness333/k8s-monitor/pkg/pricing"
+	"github.com/nightness333/k8s-monitor/pkg/storage"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+var reportNodesCmd = &cobra.Command{
+	Use:   "nodes",
+	Short: "Отчёт по узлам кластера",
+	Long: `Показывает по каждому узлу:
+	- Потребление CPU/памяти относительно allocatable
+	- Запрошенные подами ресурсы относительно allocatable
+	- Количество подов
+	- Проблемные состояния (NotReady, MemoryPressure, ...)`,
+	Run: func(cmd *cobra.Command, args []string) {
+		last, _ := cmd.Flags().GetString("last")
+		percentile, _ := cmd.Flags().GetFloat64("percentile")
+
+		if err := analyzeNodes(cmd, last, percentile); err != nil {
+			exitf(cmd, "Ошибка: %v", err)
+		}
+	},
+}
+
+func init() {
+	reportCmd.AddCommand(reportNodesCmd)
+	addReadFlags(reportNodesCmd)
+	addPercentileFlags(reportNodesCmd)
+	reportNodesCmd.Flags().StringP("file", "f", "data.csv", "Файл с метриками")
+	reportNodesCmd.Flags().StringP("last", "l", "24h", "Анализировать данные за период (1h, 24h, 7d)")
+	reportNodesCmd.Flags().Float64P("percentile", "p", 95, "Перцентиль потребления (0-100)")
+}
+
+func analyzeNodes(cmd *cobra.Command, timeRange string, percentile float64) error {
+	if percentile < 0 || percentile > 100 {
+		return fmt.Errorf("перцентиль должен быть в диапазоне 0-100: %v", percentile)
+	}
+	if _, err := outputFormat(cmd); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(timeRange)
+	if err != nil {
+		return fmt.Errorf("неверный формат периода: %v", err)
+	}
+	q := storage.Query{From: time.Now().Add(-duration)}
+
+	exact, _ := cmd.Flags().GetBool("exact-percentiles")
+	aggregator := aggregate.NewNodeAggregator(exact)
+	err = scanNodes(cmd, q, func(n types.NodeMetric) error {
+		aggregator.AddNode(n)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = scanMetrics(cmd, q, func(m types.PodMetric) error {
+		aggregator.AddPod(m)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	nodes := aggregator.Result()
+	if len(nodes) == 0 {
+		return fmt.Errorf("нет данных об узлах за период %s", timeRange)
+	}
+	return render(cmd, nodesResult(nodes, percentile))
+}
+
+// NodesResult is the outcome of report nodes. CPU is in millicores, memory
+// in MiB; usage and requests are averages over the period.
+type NodesResult struct {
+	Percentile float64      `json:"percentile"`
+	Nodes      []NodeReport `json:"nodes"`
+	Cluster    NodeTotals   `json:"cluster"`
+}
+
+type NodeReport struct {
+	Name         string                 `json:"name"`
+	InstanceType string                 `json:"instanceType,omitempty"`
+	Spot         bool                   `json:"spot"`
+	Problems     []string               `json:"problems,omitempty"`
+	Allocatable  types.PodConfiguration `json:"allocatable"`
+	Capacity     types.PodConfiguration `json:"capacity"`
+	// Usage is nil without NodeMetrics data.
+	Usage        *NodeUsage              `json:"usage,omitempty"`
+	Requests     *types.PodConfiguration `json:"requests,omitempty"`
+	Pods         int                     `json:"pods"`
+	PodsInPeriod int                     `json:"podsInPeriod"`
+}
+
+type NodeUsage struct {
+	Avg        types.PodConfiguration `json:"avg"`
+	Percentile types.PodConfiguration `json:"percentile"`
+}
+
+type NodeTotals struct {
+	Nodes       int                    `json:"nodes"`
+	Allocatable types.PodConfiguration `json:"allocatable"`
+	Usage       types.PodConfiguration `json:"usage"`
+	Requests    types.PodConfiguration `json:"requests"`
+}
+
+func nodesResult(nodes map[string]*aggregate.NodeStats, percentile float64) *NodesResult {
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := &NodesResult{Percentile: percentile, Cluster: NodeTotals{Nodes: len(nodes)}}
+	for _, name := range names {
+		n := nodes[name]
+		latest := n.Latest
+		report := NodeReport{
+			Name:         name,
+			InstanceType: nodeInstanceType(latest.Labels),
+			Spot:         pricing.IsSpot(latest.Labels),
+			Problems:     latest.Problems(),
+			Allocatable:  types.PodConfiguration{CPU: latest.CPUAllocatable, Memory: latest.MemoryAllocatable},
+			Capacity:     types.PodConfiguration{CPU: latest.CPUCapacity, Memory: latest.MemoryCapacity},
+			Pods:         len(n.LatestPods),
+			PodsInPeriod: len(n.Pods),
+		}
+		if n.CPU.Count > 0 {
+			report.Usage = &NodeUsage{
+				Avg:        types.PodConfiguration{CPU: n.CPU.Avg(), Memory: n.Memory.Avg()},
+				Percentile: types.PodConfiguration{CPU: n.CPU.Percentile(percentile), Memory: n.Memory.Percentile(percentile)},
+			}
+		}
+		if n.RequestsCPU.Count > 0 {
+			report.Requests = &types.PodConfiguration{CPU: n.RequestsCPU.Avg(), Memory: n.RequestsMemory.Avg()}
+		}
+		result.Nodes = append(result.Nodes, report)
+
+		totals := &result.Cluster
+		totals.Allocatable.CPU += latest.CPUAllocatable
+		totals.Allocatable.Memory += latest.MemoryAllocatable
+		totals.Usage.CPU += n.CPU.Avg()
+		totals.Usage.Memory += n.Memory.Avg()
+		totals.Requests.CPU += n.RequestsCPU.Avg()
+		totals.Requests.Memory += n.RequestsMemory.Avg()
+	}
+	return result
+}
+
+func (r *NodesResult) Kind() string { return "NodeReport" }
+
+func (r *NodesResult) WriteTable(w io.Writer) error {
+	label := percentileLabel(r.Percentile)
+
+	fmt.Fprintln(w, "\n=== УЗЛЫ ===")
+	for _, n := range r.Nodes {
+		fmt.Fprintf(w, "%s", n.Name)
+		if n.InstanceType != "" {
+			fmt.Fprintf(w, " (%s", n.InstanceType)
+			if n.Spot {
+				fmt.Fprint(w, ", spot")
+			}
+			fmt.Fprint(w, ")")
+		}
+		if len(n.Problems) > 0 {
+			fmt.Fprintf(w, " [%s]", strings.Join(n.Problems, ", "))
+		}
+		fmt.Fprintln(w)
+
+		fmt.Fprintf(w, "  Allocatable: CPU=%dm, Mem=%dMi (ёмкость: CPU=%dm, Mem=%dMi)\n",
+			n.Allocatable.CPU, n.Allocatable.Memory, n.Capacity.CPU, n.Capacity.Memory)
+		if u := n.Usage; u != nil {
+			fmt.Fprintf(w, "  Потребление: CPU=%dm%s, %s %dm | Mem=%dMi%s, %s %dMi\n",
+				u.Avg.CPU, utilization(u.Avg.CPU, n.Allocatable.CPU), label, u.Percentile.CPU,
+				u.Avg.Memory, utilization(u.Avg.Memory, n.Allocatable.Memory), label, u.Percentile.Memory)
+		} else {
+			fmt.Fprintln(w, "  Потребление: нет данных NodeMetrics")
+		}
+		if req := n.Requests; req != nil {
+			fmt.Fprintf(w, "  Запрошено подами: CPU=%dm%s | Mem=%dMi%s\n",
+				req.CPU, utilization(req.CPU, n.Allocatable.CPU),
+				req.Memory, utilization(req.Memory, n.Allocatable.Memory))
+		}
+		fmt.Fprintf(w, "  Подов: %d (за период: %d)\n", n.Pods, n.PodsInPeriod)
+	}
+
+	c := r.Cluster
+	fmt.Fprintln(w, "\n=== ИТОГО ПО КЛАСТЕРУ ===")
+	fmt.Fprintf(w, "Узлов: %d, allocatable: CPU=%dm, Mem=%dMi\n", c.Nodes, c.Allocatable.CPU, c.Allocatable.Memory)
+	fmt.Fprintf(w, "Потребление (среднее): CPU=%dm%s | Mem=%dMi%s\n",
+		c.Usage.CPU, utilization(c.Usage.CPU, c.Allocatable.CPU), c.Usage.Memory, utilization(c.Usage.Memory, c.Allocatable.Memory))
+	fmt.Fprintf(w, "Запрошено подами (среднее): CPU=%dm%s | Mem=%dMi%s\n",
+		c.Requests.CPU, utilization(c.Requests.CPU, c.Allocatable.CPU), c.Requests.Memory, utilization(c.Requests.Memory, c.Allocatable.Memory))
+	return nil
+}
+
+// Records lists the nodes; usage and requests are empty when unknown.
+func (r *NodesResult) Records() [][]string {
+	records := [][]string{{"node", "instance_type", "spot", "problems",
+		"cpu_allocatable", "memory_allocatable", "cpu_avg", "cpu_percentile", "memory_avg", "memory_percentile",
+		"cpu_requests", "memory_requests", "pods"}}
+	for _, n := range r.Nodes {
+		usage := []string{"", "", "", ""}
+		if u := n.Usage; u != nil {
+			usage = []string{formatInt(u.Avg.CPU), formatInt(u.Percentile.CPU), formatInt(u.Avg.Memory), formatInt(u.Percentile.Memory)}
+		}
+		requests := []string{"", ""}
+		if req := n.Requests; req != nil {
+			requests = []string{formatInt(req.CPU), formatInt(req.Memory)}
+		}
+		record := []string{n.Name, n.InstanceType, strconv.FormatBool(n.Spot), strings.Join(n.Problems, ";"),
+			formatInt(n.Allocatable.CPU), formatInt(n.Allocatable.Memory)}
+		record = append(record, usage...)
+		record = append(record, requests...)
+		records = append(records, append(record, strconv.Itoa(n.Pods)))
+	}
+	return records
+}
+
+// utilization formats value as a share of total, or nothing when total is
+// unknown.
+func utilization(value, total int64) string {
+	if total <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d%%)", 100*value/total)
+}
+
+func nodeInstanceType(labels map[string]string) string {
+	for _, label := range pricing.InstanceTypeLabels {
+		if v := labels[label]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
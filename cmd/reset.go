@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
+	"github.com/nightness333/k8s-monitor/pkg/storage"
 	"github.com/spf13/cobra"
 )
 
@@ -11,18 +13,14 @@ var resetCmd = &cobra.Command{
 	Use:   "reset",
 	Short: "Очищает накопленные данные мониторинга",
 	Run: func(cmd *cobra.Command, args []string) {
-		file, _ := cmd.Flags().GetString("file")
-
-		data, err := os.OpenFile(file, os.O_TRUNC|os.O_WRONLY, 0644)
-		if err != nil {
-			if os.IsNotExist(err) {
+		if err := storage.Reset(storeURI(cmd, "file")); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
 				fmt.Println("Файл данных не найден, нечего очищать.")
 			} else {
 				fmt.Println("Ошибка при очистке файла данных:", err)
 			}
 			return
 		}
-		defer data.Close()
 
 		fmt.Println("Данные успешно очищены.")
 	},
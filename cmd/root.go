@@ -4,8 +4,18 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/nightness333/k8s-monitor/pkg/aggregate"
+	"github.com/nightness333/k8s-monitor/pkg/output"
+	"github.com/nightness333/k8s-monitor/pkg/parser"
+	"github.com/nightness333/k8s-monitor/pkg/storage"
+	"github.com/nightness333/k8s-monitor/pkg/types"
 	"github.com/spf13/cobra"
 )
 
@@ -26,8 +36,11 @@ to quickly create a Cobra application.`,
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// The command context is cancelled on SIGINT/SIGTERM.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
 	if err != nil {
 		os.Exit(1)
 	}
@@ -40,7 +53,141 @@ func init() {
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.k8s-monitor.yaml)")
 
+	rootCmd.PersistentFlags().String("store", "", "URI хранилища метрик: csv:///path, jsonl:///path или путь к файлу (по умолчанию — файл из --file)")
+	addOutputFlag(rootCmd)
+
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
+
+// storeURI returns --store when set and falls back to the command's own
+// file flag otherwise.
+func storeURI(cmd *cobra.Command, fileFlag string) string {
+	if store, _ := cmd.Flags().GetString("store"); store != "" {
+		return store
+	}
+	file, _ := cmd.Flags().GetString(fileFlag)
+	return file
+}
+
+// addOutputFlag registers the global report format flag on cmd and its
+// subcommands.
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringP("output", "o", output.FormatTable, "Формат вывода report, cost и optimize: table, json, yaml или csv")
+}
+
+// outputFormat returns the validated --output format.
+func outputFormat(cmd *cobra.Command) (string, error) {
+	format, _ := cmd.Flags().GetString("output")
+	if err := output.Validate(format); err != nil {
+		return "", err
+	}
+	return format, nil
+}
+
+// render writes the result to stdout in the --output format.
+func render(cmd *cobra.Command, result output.Result) error {
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	return output.Render(os.Stdout, format, result)
+}
+
+// infoWriter is where a command writes progress and diagnostics: stdout for
+// tables and commands without --output, stderr for machine-readable output
+// so that stdout stays parseable.
+func infoWriter(cmd *cobra.Command) io.Writer {
+	if format, err := cmd.Flags().GetString("output"); err != nil || output.IsTable(format) {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+// exitf reports a fatal error where infoWriter sends diagnostics and exits.
+func exitf(cmd *cobra.Command, format string, args ...interface{}) {
+	fmt.Fprintf(infoWriter(cmd), format+"\n", args...)
+	os.Exit(1)
+}
+
+// scanMetrics streams the samples of the command's store that match q and
+// the --namespaces filter to fn, then reports skipped rows. With --strict the
+// first invalid row is an error.
+func scanMetrics(cmd *cobra.Command, q storage.Query, fn func(types.PodMetric) error) error {
+	strict, _ := cmd.Flags().GetBool("strict")
+	if namespaces, _ := cmd.Flags().GetStringSlice("namespaces"); len(namespaces) > 0 {
+		q.Namespaces = namespaces
+	}
+
+	reader, err := storage.OpenReader(storeURI(cmd, "file"), parser.Options{Strict: strict})
+	if err != nil {
+		return err
+	}
+
+	summary, err := reader.Scan(q, fn)
+	if err != nil {
+		return err
+	}
+	printParseSummary(summary)
+	return nil
+}
+
+// scanNodes streams the node snapshots of the command's store in q's time
+// range to fn.
+func scanNodes(cmd *cobra.Command, q storage.Query, fn func(types.NodeMetric) error) error {
+	strict, _ := cmd.Flags().GetBool("strict")
+	reader, err := storage.OpenReader(storeURI(cmd, "file"), parser.Options{Strict: strict})
+	if err != nil {
+		return err
+	}
+
+	summary, err := reader.ScanNodes(q, fn)
+	if err != nil {
+		return err
+	}
+	printParseSummary(summary)
+	return nil
+}
+
+// aggregateMetrics streams the store into an Aggregator. With
+// --exact-percentiles every sample is kept in memory.
+func aggregateMetrics(cmd *cobra.Command, q storage.Query, perPod bool) (map[string]*types.PodStats, error) {
+	exact, _ := cmd.Flags().GetBool("exact-percentiles")
+	aggregator := aggregate.NewAggregator(perPod, exact)
+	err := scanMetrics(cmd, q, func(m types.PodMetric) error {
+		aggregator.Add(m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return aggregator.Result(), nil
+}
+
+const maxReportedIssues = 10
+
+func printParseSummary(summary *parser.Summary) {
+	if summary == nil || (summary.Skipped() == 0 && summary.Missing == 0) {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Прочитано строк: %d, без данных (N/A, ERROR, SKIP): %d, пропущено некорректных: %d\n",
+		summary.Rows, summary.Missing, summary.Skipped())
+	for i, issue := range summary.Issues {
+		if i == maxReportedIssues {
+			fmt.Fprintf(os.Stderr, "  ... и ещё %d\n", summary.Skipped()-maxReportedIssues)
+			break
+		}
+		fmt.Fprintf(os.Stderr, "  %s\n", issue)
+	}
+}
+
+func addPercentileFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("exact-percentiles", false, "Считать точные перцентили (хранит все значения в памяти) вместо потоковой оценки с погрешностью ~1%")
+}
+
+func addReadFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("strict", false, "Прерывать чтение на первой некорректной строке вместо её пропуска")
+	cmd.Flags().StringSliceP("namespaces", "n", []string{}, "Анализировать только указанные namespace (через запятую)")
+}
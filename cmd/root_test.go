@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// executeChild runs a subcommand of a root carrying the global --output flag
+// and returns the subcommand after flag parsing.
+func executeChild(t *testing.T, child *cobra.Command, args ...string) *cobra.Command {
+	t.Helper()
+	root := &cobra.Command{Use: "root"}
+	addOutputFlag(root)
+	root.AddCommand(child)
+	root.SetArgs(append([]string{child.Use}, args...))
+	if err := root.Execute(); err != nil {
+		t.Fatalf("execute %v: %v", args, err)
+	}
+	return child
+}
+
+func TestOutputFormat(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{args: nil, want: "table"},
+		{args: []string{"-o", "json"}, want: "json"},
+		{args: []string{"--output=yaml"}, want: "yaml"},
+		{args: []string{"-o", "csv"}, want: "csv"},
+		{args: []string{"-o", "xml"}, wantErr: true},
+		{args: []string{"-o", "patch"}, wantErr: true},
+		{args: []string{"-o", "JSON"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		cmd := executeChild(t, &cobra.Command{Use: "child", Run: func(*cobra.Command, []string) {}}, tt.args...)
+		got, err := outputFormat(cmd)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("outputFormat(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("outputFormat(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestOutputFlagIsGlobal(t *testing.T) {
+	if rootCmd.PersistentFlags().Lookup("output") == nil {
+		t.Fatal("--output is not a persistent flag of the root command")
+	}
+	for _, cmd := range []*cobra.Command{reportCmd, reportNodesCmd, costCmd, optimizeCmd, monitorCmd} {
+		if cmd.LocalNonPersistentFlags().Lookup("output") != nil {
+			t.Errorf("%s shadows the global --output with a local flag", cmd.CommandPath())
+		}
+		if flag := cmd.InheritedFlags().Lookup("output"); flag == nil || flag.Shorthand != "o" {
+			t.Errorf("%s does not inherit -o/--output", cmd.CommandPath())
+		}
+	}
+}
+
+func TestMonitorStore(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{args: nil, want: "/data/output.csv"},
+		{args: []string{"-f", "metrics.csv"}, want: "metrics.csv"},
+		{args: []string{"-o", "legacy.csv"}, want: "legacy.csv"},
+		{args: []string{"-o", "legacy.csv", "-f", "metrics.csv"}, want: "metrics.csv"},
+		{args: []string{"-o", "json"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		var got string
+		var err error
+		cmd := &cobra.Command{Use: "monitor", Run: func(cmd *cobra.Command, _ []string) { got, err = monitorStore(cmd) }}
+		cmd.Flags().StringP("file", "f", "/data/output.csv", "")
+		cmd.Flags().String("store", "", "")
+		executeChild(t, cmd, tt.args...)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("monitorStore(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("monitorStore(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
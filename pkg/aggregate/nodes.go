@@ -0,0 +1,119 @@
+package aggregate
+
+import (
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+// NodeStats summarises one node over the analysed period. Latest is the last
+// snapshot (capacity, allocatable, labels, conditions). Requests series hold
+// the sum of container requests of the pods on the node, one value per tick.
+type NodeStats struct {
+	Node           string
+	Latest         types.NodeMetric
+	CPU            types.Series
+	Memory         types.Series
+	RequestsCPU    types.Series
+	RequestsMemory types.Series
+	Pods           map[string]struct{}
+	LatestPods     map[string]struct{}
+	latestPodTick  time.Time
+}
+
+// NodeAggregator builds per-node statistics from node snapshots and pod
+// samples, which must arrive in timestamp order per node.
+type NodeAggregator struct {
+	exact   bool
+	nodes   map[string]*NodeStats
+	pending map[string]*nodeTick
+}
+
+type nodeTick struct {
+	timestamp time.Time
+	stats     *NodeStats
+	cpu       int64
+	memory    int64
+}
+
+func NewNodeAggregator(exact bool) *NodeAggregator {
+	return &NodeAggregator{
+		exact:   exact,
+		nodes:   make(map[string]*NodeStats),
+		pending: make(map[string]*nodeTick),
+	}
+}
+
+func (a *NodeAggregator) node(name string) *NodeStats {
+	stats, exists := a.nodes[name]
+	if !exists {
+		stats = &NodeStats{
+			Node:           name,
+			CPU:            types.NewSeries(a.exact),
+			Memory:         types.NewSeries(a.exact),
+			RequestsCPU:    types.NewSeries(a.exact),
+			RequestsMemory: types.NewSeries(a.exact),
+			Pods:           make(map[string]struct{}),
+			LatestPods:     make(map[string]struct{}),
+		}
+		a.nodes[name] = stats
+	}
+	return stats
+}
+
+// AddNode accounts a node snapshot.
+func (a *NodeAggregator) AddNode(n types.NodeMetric) {
+	stats := a.node(n.Node)
+	if !n.Timestamp.Before(stats.Latest.Timestamp) {
+		stats.Latest = n
+	}
+	if n.HasUsage {
+		stats.CPU.Add(n.CPU)
+		stats.Memory.Add(n.Memory)
+	}
+}
+
+// AddPod accounts a pod sample on its node, whether or not its usage was
+// measured. Samples recorded without a node and samples of finished pods
+// are ignored.
+func (a *NodeAggregator) AddPod(m types.PodMetric) {
+	if m.Node == "" || m.Finished() {
+		return
+	}
+	stats := a.node(m.Node)
+
+	podKey := m.Namespace + "/" + m.Pod
+	stats.Pods[podKey] = struct{}{}
+	switch {
+	case m.Timestamp.After(stats.latestPodTick):
+		stats.latestPodTick = m.Timestamp
+		stats.LatestPods = map[string]struct{}{podKey: {}}
+	case m.Timestamp.Equal(stats.latestPodTick):
+		stats.LatestPods[podKey] = struct{}{}
+	}
+
+	tick, ok := a.pending[m.Node]
+	if !ok || !tick.timestamp.Equal(m.Timestamp) {
+		if ok {
+			tick.flush()
+		}
+		tick = &nodeTick{timestamp: m.Timestamp, stats: stats}
+		a.pending[m.Node] = tick
+	}
+	tick.cpu += m.CPURequest
+	tick.memory += m.MemoryRequest
+}
+
+// Result flushes the last tick of every node and returns the nodes by name.
+func (a *NodeAggregator) Result() map[string]*NodeStats {
+	for key, tick := range a.pending {
+		tick.flush()
+		delete(a.pending, key)
+	}
+	return a.nodes
+}
+
+func (t *nodeTick) flush() {
+	t.stats.RequestsCPU.Add(t.cpu)
+	t.stats.RequestsMemory.Add(t.memory)
+}
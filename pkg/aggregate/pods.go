@@ -0,0 +1,123 @@
+package aggregate
+
+import (
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+// Aggregator builds per-group statistics from a stream of samples without
+// keeping the samples. Container rows of one pod and tick are summed into one
+// pod-level sample, so the group's CPU/Memory series holds one value per pod
+// per tick, and each named container also keeps its own series.
+//
+// Rows of one pod must arrive in timestamp order, which is how the monitor
+// writes them.
+type Aggregator struct {
+	groupBy func(types.PodMetric) types.Workload
+	exact   bool
+	groups  map[string]*types.PodStats
+	pending map[string]*podTick
+}
+
+type podTick struct {
+	timestamp time.Time
+	stats     *types.PodStats
+	cpu       int64
+	memory    int64
+}
+
+// NewAggregator groups by workload, or by pod when perPod is set. With exact
+// set the series keep every sample for exact percentiles instead of using a
+// streaming sketch.
+func NewAggregator(perPod, exact bool) *Aggregator {
+	return &Aggregator{
+		groupBy: GroupBy(perPod),
+		exact:   exact,
+		groups:  make(map[string]*types.PodStats),
+		pending: make(map[string]*podTick),
+	}
+}
+
+// GroupBy returns the group of a sample: its workload, or its pod when
+// perPod is set.
+func GroupBy(perPod bool) func(types.PodMetric) types.Workload {
+	if perPod {
+		return func(m types.PodMetric) types.Workload {
+			return types.Workload{Namespace: m.Namespace, Kind: types.WorkloadPod, Name: m.Pod}
+		}
+	}
+	return types.PodMetric.Workload
+}
+
+// Add accounts one sample. Rows without measured usage are ignored.
+func (a *Aggregator) Add(m types.PodMetric) {
+	if !m.HasUsage() {
+		return
+	}
+
+	workload := a.groupBy(m)
+	key := workload.String()
+
+	stats, exists := a.groups[key]
+	if !exists {
+		stats = &types.PodStats{
+			Workload:   workload,
+			CPU:        types.NewSeries(a.exact),
+			Memory:     types.NewSeries(a.exact),
+			Status:     m.Status,
+			Pods:       make(map[string]struct{}),
+			Containers: make(map[string]*types.ContainerStats),
+			First:      m.Timestamp,
+			Last:       m.Timestamp,
+			Intervals:  types.NewSeries(a.exact),
+		}
+		a.groups[key] = stats
+	}
+	stats.Pods[m.Pod] = struct{}{}
+	if m.Timestamp.After(stats.Last) {
+		stats.Intervals.Add(int64(m.Timestamp.Sub(stats.Last).Seconds()))
+		stats.Last = m.Timestamp
+	}
+
+	podKey := m.Namespace + "/" + m.Pod
+	tick, ok := a.pending[podKey]
+	if !ok || !tick.timestamp.Equal(m.Timestamp) {
+		if ok {
+			tick.flush()
+		}
+		tick = &podTick{timestamp: m.Timestamp, stats: stats}
+		a.pending[podKey] = tick
+	}
+	tick.cpu += m.CPU
+	tick.memory += m.Memory
+
+	if m.Container == "" {
+		return
+	}
+	container, exists := stats.Containers[m.Container]
+	if !exists {
+		container = &types.ContainerStats{
+			CPU:    types.NewSeries(a.exact),
+			Memory: types.NewSeries(a.exact),
+		}
+		stats.Containers[m.Container] = container
+	}
+	container.CPU.Add(m.CPU)
+	container.Memory.Add(m.Memory)
+}
+
+// Result flushes the last tick of every pod and returns the groups keyed by
+// Workload.String().
+func (a *Aggregator) Result() map[string]*types.PodStats {
+	for key, tick := range a.pending {
+		tick.flush()
+		delete(a.pending, key)
+	}
+	return a.groups
+}
+
+func (t *podTick) flush() {
+	t.stats.CPU.Add(t.cpu)
+	t.stats.Memory.Add(t.memory)
+}
@@ -0,0 +1,97 @@
+package aggregate
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+// Timeline buckets the usage of keys (namespaces, workloads, ...) into fixed
+// steps for charts. Rows of one key and tick are summed, and a bucket holds
+// the average of these tick totals, so a namespace bucket is the usage of
+// the whole namespace rather than of an average pod.
+//
+// Rows of one key and tick must arrive together, which is how the monitor
+// writes them.
+type Timeline struct {
+	From time.Time
+	Step time.Duration
+	keys map[string][]timelineBucket
+	n    int
+}
+
+type timelineBucket struct {
+	cpu, memory int64
+	ticks       int64
+	last        time.Time
+}
+
+// Point is the average usage of a bucket starting at Time.
+type Point struct {
+	Time   time.Time
+	CPU    int64
+	Memory int64
+}
+
+// NewTimeline splits [from, to) into n buckets of at least a second.
+func NewTimeline(from, to time.Time, n int) *Timeline {
+	step := max(to.Sub(from)/time.Duration(n), time.Second)
+	return &Timeline{
+		From: from,
+		Step: step,
+		keys: make(map[string][]timelineBucket),
+		n:    int(to.Sub(from)/step) + 1,
+	}
+}
+
+// Add accounts one sample of key. Rows without measured usage or outside
+// the range are ignored.
+func (t *Timeline) Add(key string, m types.PodMetric) {
+	if !m.HasUsage() || m.Timestamp.Before(t.From) {
+		return
+	}
+	i := int(m.Timestamp.Sub(t.From) / t.Step)
+	if i >= t.n {
+		return
+	}
+
+	buckets, ok := t.keys[key]
+	if !ok {
+		buckets = make([]timelineBucket, t.n)
+		t.keys[key] = buckets
+	}
+	b := &buckets[i]
+	if !b.last.Equal(m.Timestamp) {
+		b.ticks++
+		b.last = m.Timestamp
+	}
+	b.cpu += m.CPU
+	b.memory += m.Memory
+}
+
+// Keys lists the keys with data, sorted.
+func (t *Timeline) Keys() []string {
+	keys := make([]string, 0, len(t.keys))
+	for key := range t.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Points returns the buckets of key that have data, in time order.
+func (t *Timeline) Points(key string) []Point {
+	var points []Point
+	for i, b := range t.keys[key] {
+		if b.ticks == 0 {
+			continue
+		}
+		points = append(points, Point{
+			Time:   t.From.Add(time.Duration(i) * t.Step),
+			CPU:    b.cpu / b.ticks,
+			Memory: b.memory / b.ticks,
+		})
+	}
+	return points
+}
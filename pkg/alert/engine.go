@@ -0,0 +1,322 @@
+package alert
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+type State string
+
+const (
+	StatePending  State = "pending"
+	StateFiring   State = "firing"
+	StateResolved State = "resolved"
+)
+
+// Alert is one instance of a rule: the rule applied to one container, pod,
+// namespace or node, identified by Labels.
+type Alert struct {
+	Rule      string
+	Severity  string
+	Summary   string
+	Labels    map[string]string
+	Value     float64
+	Op        string
+	Threshold float64
+	State     State
+
+	// ActiveAt is when the condition started to hold, LastSeen the last
+	// evaluation it held at.
+	ActiveAt   time.Time
+	LastSeen   time.Time
+	FiredAt    time.Time
+	ResolvedAt time.Time
+}
+
+// Key identifies the alert across evaluations.
+func (a Alert) Key() string {
+	return a.Rule + "{" + types.FormatLabels(a.Labels) + "}"
+}
+
+// Subject names what the alert is about: "prod/web-1/app", "prod" or a node.
+func (a Alert) Subject() string {
+	if node := a.Labels["node"]; node != "" {
+		return node
+	}
+	parts := []string{a.Labels["namespace"]}
+	for _, key := range []string{"pod", "container"} {
+		if v := a.Labels[key]; v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("[%s] %s %s: %.1f %s %g", strings.ToUpper(string(a.State)), a.Rule, a.Subject(),
+		a.Value, a.Op, a.Threshold)
+}
+
+// Engine evaluates rules against consecutive ticks and tracks alert state.
+// An alert is pending while its condition holds for less than the rule's
+// For, firing afterwards, and resolved once the condition has not held for
+// KeepFiringFor. A pending alert whose condition clears is dropped.
+//
+// A tick without any measured sample for a rule (metrics-server errors,
+// only NO_METRICS rows, nodes without usage) is treated as missing data:
+// the rule's alerts keep their state instead of resolving.
+type Engine struct {
+	rules  []Rule
+	alerts map[string]*Alert
+}
+
+func NewEngine(rules []Rule) *Engine {
+	return &Engine{rules: rules, alerts: make(map[string]*Alert)}
+}
+
+// UsesNodes reports whether any rule needs node snapshots.
+func (e *Engine) UsesNodes() bool {
+	for _, r := range e.rules {
+		if r.Scope == ScopeNode {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate applies the rules to the samples of one tick taken at now and
+// returns the alerts that changed state: became pending, started firing or
+// resolved. Alerts that stay in their state are not returned again, so every
+// transition is reported once.
+func (e *Engine) Evaluate(now time.Time, pods []types.PodMetric, nodes []types.NodeMetric) []Alert {
+	seen := make(map[string]bool)
+	noData := make(map[string]bool)
+	var changed []Alert
+
+	for i := range e.rules {
+		r := &e.rules[i]
+		vals, ok := values(r, pods, nodes)
+		if !ok {
+			noData[r.Name] = true
+			continue
+		}
+		for _, v := range vals {
+			if !r.compare(v.value) {
+				continue
+			}
+			labels := map[string]string{"alertname": r.Name, "severity": r.Severity}
+			for k, val := range r.Labels {
+				labels[k] = val
+			}
+			for k, val := range v.labels {
+				labels[k] = val
+			}
+
+			candidate := Alert{Rule: r.Name, Labels: labels}
+			key := candidate.Key()
+			seen[key] = true
+
+			a, ok := e.alerts[key]
+			if !ok {
+				a = &Alert{
+					Rule:      r.Name,
+					Severity:  r.Severity,
+					Summary:   r.Summary,
+					Labels:    labels,
+					Op:        r.Op,
+					Threshold: r.Threshold,
+					State:     StatePending,
+					ActiveAt:  now,
+				}
+				e.alerts[key] = a
+			}
+			a.Value = v.value
+			a.LastSeen = now
+
+			if !ok && r.For.Duration > 0 {
+				changed = append(changed, *a)
+			}
+			if a.State == StatePending && now.Sub(a.ActiveAt) >= r.For.Duration {
+				a.State = StateFiring
+				a.FiredAt = now
+				changed = append(changed, *a)
+			}
+		}
+	}
+
+	keepFiringFor := make(map[string]time.Duration, len(e.rules))
+	for _, r := range e.rules {
+		keepFiringFor[r.Name] = r.KeepFiringFor.Duration
+	}
+	for key, a := range e.alerts {
+		if seen[key] || noData[a.Rule] {
+			continue
+		}
+		switch {
+		case a.State == StatePending:
+			delete(e.alerts, key)
+		case now.Sub(a.LastSeen) >= keepFiringFor[a.Rule]:
+			a.State = StateResolved
+			a.ResolvedAt = now
+			changed = append(changed, *a)
+			delete(e.alerts, key)
+		}
+	}
+
+	sortAlerts(changed)
+	return changed
+}
+
+// Active returns the pending and firing alerts.
+func (e *Engine) Active() []Alert {
+	active := make([]Alert, 0, len(e.alerts))
+	for _, a := range e.alerts {
+		active = append(active, *a)
+	}
+	sortAlerts(active)
+	return active
+}
+
+func sortAlerts(alerts []Alert) {
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Key() < alerts[j].Key() })
+}
+
+type value struct {
+	labels map[string]string
+	value  float64
+}
+
+// usage sums the usage of a group of containers together with the requests
+// and limits of the containers that set them, so a ratio is taken over the
+// containers it is defined for.
+type usage struct {
+	labels map[string]string
+
+	cpu, memory                    int64
+	cpuRequest, cpuRequestUsage    int64
+	cpuLimit, cpuLimitUsage        int64
+	memoryRequest, memRequestUsage int64
+	memoryLimit, memLimitUsage     int64
+}
+
+func (u *usage) add(m types.PodMetric) {
+	u.cpu += m.CPU
+	u.memory += m.Memory
+	if m.CPURequest > 0 {
+		u.cpuRequest += m.CPURequest
+		u.cpuRequestUsage += m.CPU
+	}
+	if m.CPULimit > 0 {
+		u.cpuLimit += m.CPULimit
+		u.cpuLimitUsage += m.CPU
+	}
+	if m.MemoryRequest > 0 {
+		u.memoryRequest += m.MemoryRequest
+		u.memRequestUsage += m.Memory
+	}
+	if m.MemoryLimit > 0 {
+		u.memoryLimit += m.MemoryLimit
+		u.memLimitUsage += m.Memory
+	}
+}
+
+func (u *usage) metric(name string) (float64, bool) {
+	switch name {
+	case MetricCPU:
+		return float64(u.cpu), true
+	case MetricMemory:
+		return float64(u.memory), true
+	case MetricCPURequestPct:
+		return percent(u.cpuRequestUsage, u.cpuRequest)
+	case MetricCPULimitPct:
+		return percent(u.cpuLimitUsage, u.cpuLimit)
+	case MetricMemoryRequestPct:
+		return percent(u.memRequestUsage, u.memoryRequest)
+	case MetricMemoryLimitPct:
+		return percent(u.memLimitUsage, u.memoryLimit)
+	}
+	return 0, false
+}
+
+func percent(value, total int64) (float64, bool) {
+	if total <= 0 {
+		return 0, false
+	}
+	return 100 * float64(value) / float64(total), true
+}
+
+// values computes the rule's metric for every container, pod, namespace or
+// node in the tick. Samples without measured usage are left out, as are
+// groups for which a ratio is not defined. The second result is false when
+// the tick has no measured sample the rule applies to.
+func values(r *Rule, pods []types.PodMetric, nodes []types.NodeMetric) ([]value, bool) {
+	if r.Scope == ScopeNode {
+		var result []value
+		measured := false
+		for _, n := range nodes {
+			if !n.HasUsage {
+				continue
+			}
+			measured = true
+			v, ok := nodeMetric(r.Metric, n)
+			if ok {
+				result = append(result, value{labels: map[string]string{"node": n.Node}, value: v})
+			}
+		}
+		return result, measured
+	}
+
+	groups := make(map[string]*usage)
+	var order []string
+	for _, m := range pods {
+		if !m.HasUsage() || (len(r.Namespaces) > 0 && !contains(r.Namespaces, m.Namespace)) {
+			continue
+		}
+		labels := map[string]string{"namespace": m.Namespace}
+		if r.Scope != ScopeNamespace {
+			labels["pod"] = m.Pod
+			if m.WorkloadKind != "" {
+				labels["workload"] = m.Workload().String()
+			}
+		}
+		if r.Scope == ScopeContainer && m.Container != "" {
+			labels["container"] = m.Container
+		}
+
+		key := types.FormatLabels(labels)
+		u, ok := groups[key]
+		if !ok {
+			u = &usage{labels: labels}
+			groups[key] = u
+			order = append(order, key)
+		}
+		u.add(m)
+	}
+
+	result := make([]value, 0, len(order))
+	for _, key := range order {
+		u := groups[key]
+		if v, ok := u.metric(r.Metric); ok {
+			result = append(result, value{labels: u.labels, value: v})
+		}
+	}
+	return result, len(order) > 0
+}
+
+func nodeMetric(name string, n types.NodeMetric) (float64, bool) {
+	switch name {
+	case MetricCPU:
+		return float64(n.CPU), true
+	case MetricMemory:
+		return float64(n.Memory), true
+	case MetricCPUAllocatablePct:
+		return percent(n.CPU, n.CPUAllocatable)
+	case MetricMemoryAllocatablePct:
+		return percent(n.Memory, n.MemoryAllocatable)
+	}
+	return 0, false
+}
@@ -0,0 +1,190 @@
+package alert
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/parser"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const recordedHeader = "Timestamp,Namespace,Pod,Container,CPU,Memory,Status,WorkloadKind,WorkloadName,Node,Labels,CPURequest,CPULimit,MemoryRequest,MemoryLimit\n"
+
+// recordedTicks parses rows as monitor writes them and groups them by
+// timestamp, the way the alerts command replays a history.
+func recordedTicks(t *testing.T, rows string) [][]types.PodMetric {
+	t.Helper()
+	metrics, summary, err := parser.Parse(strings.NewReader(recordedHeader+rows), parser.Options{Strict: true})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if summary.Skipped() > 0 {
+		t.Fatalf("skipped rows: %v", summary.Issues)
+	}
+	var ticks [][]types.PodMetric
+	for _, m := range metrics {
+		if n := len(ticks); n > 0 && ticks[n-1][0].Timestamp.Equal(m.Timestamp) {
+			ticks[n-1] = append(ticks[n-1], m)
+			continue
+		}
+		ticks = append(ticks, []types.PodMetric{m})
+	}
+	return ticks
+}
+
+func okRow(minute int, cpu int) string {
+	ts := time.Date(2024, 1, 1, 0, minute, 0, 0, time.UTC).Format(time.RFC3339)
+	return ts + ",prod,web-1,app," + strconv.Itoa(cpu) + "m,100Mi,OK,Deployment,web,node-1,,100m,,,\n"
+}
+
+func statusRow(minute int, status string) string {
+	ts := time.Date(2024, 1, 1, 0, minute, 0, 0, time.UTC).Format(time.RFC3339)
+	return ts + ",prod,web-1,,N/A,N/A," + status + ",Deployment,web,node-1,,,,,\n"
+}
+
+func cpuRule(forDuration, keepFiringFor time.Duration) Rule {
+	return Rule{
+		Name:          "HighCPU",
+		Scope:         ScopeContainer,
+		Metric:        MetricCPU,
+		Op:            ">",
+		Threshold:     500,
+		For:           metav1.Duration{Duration: forDuration},
+		KeepFiringFor: metav1.Duration{Duration: keepFiringFor},
+		Severity:      DefaultSeverity,
+	}
+}
+
+// replay feeds the ticks to a new engine and returns the transitions of
+// every tick as "state" strings, "-" for ticks without transitions.
+func replay(rule Rule, ticks [][]types.PodMetric) ([]string, *Engine) {
+	engine := NewEngine([]Rule{rule})
+	var got []string
+	for _, tick := range ticks {
+		changed := engine.Evaluate(tick[0].Timestamp, tick, nil)
+		if len(changed) == 0 {
+			got = append(got, "-")
+			continue
+		}
+		var states []string
+		for _, a := range changed {
+			states = append(states, string(a.State))
+		}
+		got = append(got, strings.Join(states, "+"))
+	}
+	return got, engine
+}
+
+func TestEngineTransitions(t *testing.T) {
+	tests := []struct {
+		name          string
+		for_          time.Duration
+		keepFiringFor time.Duration
+		rows          string
+		want          []string
+	}{
+		{
+			name: "fires immediately without for",
+			rows: okRow(0, 100) + okRow(1, 900) + okRow(2, 900) + okRow(3, 100),
+			want: []string{"-", "firing", "-", "resolved"},
+		},
+		{
+			name: "pending, firing, resolved",
+			for_: 2 * time.Minute,
+			rows: okRow(0, 900) + okRow(1, 900) + okRow(2, 900) + okRow(3, 900) + okRow(4, 100),
+			want: []string{"pending", "-", "firing", "-", "resolved"},
+		},
+		{
+			name: "pending alert is dropped when the condition clears",
+			for_: 2 * time.Minute,
+			rows: okRow(0, 900) + okRow(1, 100) + okRow(2, 900) + okRow(3, 900),
+			want: []string{"pending", "-", "pending", "-"},
+		},
+		{
+			name:          "keepFiringFor delays resolution",
+			keepFiringFor: 2 * time.Minute,
+			rows:          okRow(0, 900) + okRow(1, 100) + okRow(2, 100) + okRow(3, 100),
+			want:          []string{"firing", "-", "resolved", "-"},
+		},
+		{
+			name:          "keepFiringFor is reset when the condition returns",
+			keepFiringFor: 2 * time.Minute,
+			rows:          okRow(0, 900) + okRow(1, 100) + okRow(2, 900) + okRow(3, 100) + okRow(4, 100),
+			want:          []string{"firing", "-", "-", "-", "resolved"},
+		},
+		{
+			name: "error ticks keep a firing alert",
+			rows: okRow(0, 900) + statusRow(1, "ERROR: metrics unavailable") + statusRow(2, types.StatusNoMetrics) + okRow(3, 900) + okRow(4, 100),
+			want: []string{"firing", "-", "-", "-", "resolved"},
+		},
+		{
+			name: "error ticks do not reset the for window",
+			for_: 3 * time.Minute,
+			rows: okRow(0, 900) + statusRow(1, "ERROR: metrics unavailable") + okRow(2, 900) + okRow(3, 900),
+			want: []string{"pending", "-", "-", "firing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := replay(cpuRule(tt.for_, tt.keepFiringFor), recordedTicks(t, tt.rows))
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("transitions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngineActiveAfterErrorTick(t *testing.T) {
+	_, engine := replay(cpuRule(0, 0), recordedTicks(t, okRow(0, 900)+statusRow(1, "ERROR: metrics unavailable")))
+	active := engine.Active()
+	if len(active) != 1 || active[0].State != StateFiring {
+		t.Fatalf("active = %v, want one firing alert", active)
+	}
+	if want := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC); !active[0].LastSeen.Equal(want) {
+		t.Errorf("LastSeen = %v, want the last measured tick %v", active[0].LastSeen, want)
+	}
+}
+
+func TestEngineLabelsAndRatio(t *testing.T) {
+	rule := cpuRule(0, 0)
+	rule.Scope = ScopePod
+	rule.Metric = MetricCPURequestPct
+	rule.Threshold = 150
+	rule.Labels = map[string]string{"team": "web"}
+
+	changed := NewEngine([]Rule{rule}).Evaluate(time.Now(), recordedTicks(t, okRow(0, 200))[0], nil)
+	if len(changed) != 1 {
+		t.Fatalf("changed = %v, want one alert", changed)
+	}
+	a := changed[0]
+	if a.Value != 200 {
+		t.Errorf("Value = %v, want 200%% of request", a.Value)
+	}
+	want := map[string]string{"alertname": "HighCPU", "severity": DefaultSeverity, "team": "web",
+		"namespace": "prod", "pod": "web-1", "workload": "prod/Deployment/web"}
+	if types.FormatLabels(a.Labels) != types.FormatLabels(want) {
+		t.Errorf("Labels = %v, want %v", a.Labels, want)
+	}
+}
+
+func TestEngineNodeRules(t *testing.T) {
+	rule := Rule{Name: "NodeCPU", Scope: ScopeNode, Metric: MetricCPUAllocatablePct, Op: ">", Threshold: 80, Severity: DefaultSeverity}
+	engine := NewEngine([]Rule{rule})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	node := func(cpu int64, hasUsage bool) []types.NodeMetric {
+		return []types.NodeMetric{{Node: "node-1", CPUAllocatable: 1000, CPU: cpu, HasUsage: hasUsage}}
+	}
+
+	if changed := engine.Evaluate(start, nil, node(900, true)); len(changed) != 1 || changed[0].State != StateFiring {
+		t.Fatalf("changed = %v, want firing", changed)
+	}
+	if changed := engine.Evaluate(start.Add(time.Minute), nil, node(0, false)); len(changed) != 0 {
+		t.Fatalf("node without usage changed %v, want no transitions", changed)
+	}
+	if changed := engine.Evaluate(start.Add(2*time.Minute), nil, node(100, true)); len(changed) != 1 || changed[0].State != StateResolved {
+		t.Fatalf("changed = %v, want resolved", changed)
+	}
+}
@@ -0,0 +1,145 @@
+package alert
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Scopes a rule is evaluated at.
+const (
+	ScopeContainer = "container"
+	ScopePod       = "pod"
+	ScopeNamespace = "namespace"
+	ScopeNode      = "node"
+)
+
+// Metrics. cpu is in millicores and memory in MiB; the *_pct metrics are
+// usage as a percentage of requests, limits or node allocatable.
+const (
+	MetricCPU                  = "cpu"
+	MetricMemory               = "memory"
+	MetricCPURequestPct        = "cpu_request_pct"
+	MetricCPULimitPct          = "cpu_limit_pct"
+	MetricMemoryRequestPct     = "memory_request_pct"
+	MetricMemoryLimitPct       = "memory_limit_pct"
+	MetricCPUAllocatablePct    = "cpu_allocatable_pct"
+	MetricMemoryAllocatablePct = "memory_allocatable_pct"
+)
+
+const DefaultSeverity = "warning"
+
+var (
+	podMetrics = []string{MetricCPU, MetricMemory, MetricCPURequestPct, MetricCPULimitPct,
+		MetricMemoryRequestPct, MetricMemoryLimitPct}
+	nodeMetrics = []string{MetricCPU, MetricMemory, MetricCPUAllocatablePct, MetricMemoryAllocatablePct}
+	operators   = []string{">", ">=", "<", "<="}
+)
+
+// Rule fires when metric compared with threshold by op holds for at least
+// For, and resolves once it has not held for KeepFiringFor.
+type Rule struct {
+	Name          string            `json:"name"`
+	Scope         string            `json:"scope,omitempty"`
+	Metric        string            `json:"metric"`
+	Op            string            `json:"op,omitempty"`
+	Threshold     float64           `json:"threshold"`
+	For           metav1.Duration   `json:"for,omitempty"`
+	KeepFiringFor metav1.Duration   `json:"keepFiringFor,omitempty"`
+	Namespaces    []string          `json:"namespaces,omitempty"`
+	Severity      string            `json:"severity,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Summary       string            `json:"summary,omitempty"`
+}
+
+// Rules is an alerting rules file.
+type Rules struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Load reads alerting rules from a YAML or JSON file.
+func Load(path string) ([]Rule, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла правил: %v", err)
+	}
+
+	var rules Rules
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, fmt.Errorf("ошибка разбора файла правил %s: %v", path, err)
+	}
+	names := make(map[string]bool, len(rules.Rules))
+	for i := range rules.Rules {
+		r := &rules.Rules[i]
+		if r.Scope == "" {
+			r.Scope = ScopeContainer
+		}
+		if r.Op == "" {
+			r.Op = ">"
+		}
+		if r.Severity == "" {
+			r.Severity = DefaultSeverity
+		}
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("файл правил %s, правило %d (%s): %v", path, i+1, r.Name, err)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("файл правил %s: повторяется имя правила %s", path, r.Name)
+		}
+		names[r.Name] = true
+	}
+	return rules.Rules, nil
+}
+
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("не задано имя")
+	}
+
+	metrics := podMetrics
+	switch r.Scope {
+	case ScopeContainer, ScopePod, ScopeNamespace:
+	case ScopeNode:
+		metrics = nodeMetrics
+		if len(r.Namespaces) > 0 {
+			return fmt.Errorf("namespaces не применимы к scope node")
+		}
+	default:
+		return fmt.Errorf("неизвестный scope %q (допустимы container, pod, namespace, node)", r.Scope)
+	}
+	if !contains(metrics, r.Metric) {
+		return fmt.Errorf("метрика %q недоступна для scope %s (допустимы %v)", r.Metric, r.Scope, metrics)
+	}
+	if !contains(operators, r.Op) {
+		return fmt.Errorf("неизвестный оператор %q (допустимы %v)", r.Op, operators)
+	}
+	if r.For.Duration < 0 || r.KeepFiringFor.Duration < 0 {
+		return fmt.Errorf("отрицательная длительность")
+	}
+	return nil
+}
+
+func (r *Rule) compare(value float64) bool {
+	switch r.Op {
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	default:
+		return value > r.Threshold
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,268 @@
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nightness333/k8s-monitor/pkg/manifest"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	"github.com/nightness333/k8s-monitor/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PreviousResourcesAnnotation holds, as JSON, the CPU and memory requests and
+// limits the containers had before the first Apply. Later applies keep it, so
+// Rollback always restores the original values.
+const PreviousResourcesAnnotation = "k8s-monitor/previous-resources"
+
+const fieldManager = "k8s-monitor"
+
+// ErrNoRollback is returned by Rollback for workloads Apply has not changed.
+var ErrNoRollback = errors.New("нет сохранённых значений для отката")
+
+// Options controls how patches are sent. DryRun asks the API server to
+// validate and admit the patch without persisting it.
+type Options struct {
+	DryRun bool
+}
+
+var supportedKinds = []string{"Deployment", "StatefulSet", "DaemonSet"}
+
+// Supported reports whether Apply can patch workloads of kind. The kind is
+// matched case-insensitively, so "deployment" is accepted.
+func Supported(kind string) bool {
+	return canonicalKind(kind) != ""
+}
+
+// canonicalKind returns the API spelling of a supported kind, or "".
+func canonicalKind(kind string) string {
+	for _, k := range supportedKinds {
+		if strings.EqualFold(k, kind) {
+			return k
+		}
+	}
+	return ""
+}
+
+// Apply sets the recommended requests and limits of the workload's
+// containers. The live values are stored in PreviousResourcesAnnotation by
+// the same patch, so Rollback can restore them. Values already saved by an
+// earlier Apply are kept; only containers changed for the first time are
+// added. Containers that are not in the live pod template are ignored.
+func Apply(ctx context.Context, clientset kubernetes.Interface, w types.Workload, containers map[string]types.ContainerResources, opts Options) error {
+	kind := canonicalKind(w.Kind)
+	if kind == "" {
+		return fmt.Errorf("неподдерживаемый тип нагрузки: %s", w.Kind)
+	}
+	w.Kind = kind
+	obj, spec, err := utils.GetWorkloadObject(ctx, clientset, w)
+	if err != nil {
+		return err
+	}
+	previous, err := savedResources(obj)
+	if err != nil {
+		return err
+	}
+	if previous == nil {
+		previous = make(map[string]corev1.ResourceRequirements)
+	}
+
+	changes := make(map[string]types.ContainerResources)
+	for _, c := range spec.Containers {
+		if rec, ok := containers[c.Name]; ok {
+			if _, saved := previous[c.Name]; !saved {
+				previous[c.Name] = cpuMemory(c.Resources)
+			}
+			changes[c.Name] = rec
+		}
+	}
+	if len(changes) == 0 {
+		return fmt.Errorf("в шаблоне пода нет рекомендованных контейнеров")
+	}
+
+	saved, err := json.Marshal(previous)
+	if err != nil {
+		return err
+	}
+	patch := manifest.PatchObject(w, changes)
+	setAnnotation(patch, string(saved))
+	return patchWorkload(ctx, clientset, w, patch, opts)
+}
+
+// Rollback restores the values saved before the first Apply and removes the
+// annotation. Resources that were unset before are removed again. Saved
+// containers that are no longer in the pod template are not restored; their
+// names are returned.
+func Rollback(ctx context.Context, clientset kubernetes.Interface, w types.Workload, opts Options) ([]string, error) {
+	kind := canonicalKind(w.Kind)
+	if kind == "" {
+		return nil, fmt.Errorf("неподдерживаемый тип нагрузки: %s", w.Kind)
+	}
+	w.Kind = kind
+	obj, spec, err := utils.GetWorkloadObject(ctx, clientset, w)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := savedResources(obj)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil {
+		return nil, ErrNoRollback
+	}
+
+	live := make(map[string]bool, len(spec.Containers))
+	for _, c := range spec.Containers {
+		live[c.Name] = true
+	}
+	// A strategic-merge patch would add a missing container, and the API
+	// server rejects a container without an image.
+	var names, skipped []string
+	for name := range previous {
+		if live[name] {
+			names = append(names, name)
+		} else {
+			skipped = append(skipped, name)
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(skipped)
+
+	containers := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		containers = append(containers, map[string]interface{}{
+			"name": name,
+			"resources": map[string]interface{}{
+				"requests": restoreMap(previous[name].Requests),
+				"limits":   restoreMap(previous[name].Limits),
+			},
+		})
+	}
+	patch := manifest.WorkloadPatch(w, containers)
+	setAnnotation(patch, nil)
+	return skipped, patchWorkload(ctx, clientset, w, patch, opts)
+}
+
+// Applied lists the workloads in the namespaces (all when empty) that carry
+// saved values from Apply.
+func Applied(ctx context.Context, clientset kubernetes.Interface, namespaces []string) ([]types.Workload, error) {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	var result []types.Workload
+	add := func(kind string, m metav1.ObjectMeta) {
+		if _, ok := m.Annotations[PreviousResourcesAnnotation]; ok {
+			result = append(result, types.Workload{Namespace: m.Namespace, Kind: kind, Name: m.Name})
+		}
+	}
+	for _, ns := range namespaces {
+		deployments, err := clientset.AppsV1().Deployments(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range deployments.Items {
+			add("Deployment", d.ObjectMeta)
+		}
+		statefulSets, err := clientset.AppsV1().StatefulSets(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range statefulSets.Items {
+			add("StatefulSet", s.ObjectMeta)
+		}
+		daemonSets, err := clientset.AppsV1().DaemonSets(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range daemonSets.Items {
+			add("DaemonSet", d.ObjectMeta)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].String() < result[j].String() })
+	return result, nil
+}
+
+// savedResources decodes PreviousResourcesAnnotation; nil means the workload
+// carries no saved values.
+func savedResources(obj runtime.Object) (map[string]corev1.ResourceRequirements, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	saved, ok := accessor.GetAnnotations()[PreviousResourcesAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	previous := make(map[string]corev1.ResourceRequirements)
+	if err := json.Unmarshal([]byte(saved), &previous); err != nil {
+		return nil, fmt.Errorf("неверная аннотация %s: %v", PreviousResourcesAnnotation, err)
+	}
+	return previous, nil
+}
+
+// cpuMemory keeps only the CPU and memory entries, the ones Apply changes.
+func cpuMemory(r corev1.ResourceRequirements) corev1.ResourceRequirements {
+	pick := func(list corev1.ResourceList) corev1.ResourceList {
+		out := corev1.ResourceList{}
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			if q, ok := list[name]; ok {
+				out[name] = q
+			}
+		}
+		return out
+	}
+	return corev1.ResourceRequirements{Requests: pick(r.Requests), Limits: pick(r.Limits)}
+}
+
+// restoreMap sets the saved quantities and deletes (null in a strategic-merge
+// patch) those that were not set.
+func restoreMap(list corev1.ResourceList) map[string]interface{} {
+	out := make(map[string]interface{}, 2)
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		if q, ok := list[name]; ok {
+			out[string(name)] = q.String()
+		} else {
+			out[string(name)] = nil
+		}
+	}
+	return out
+}
+
+func setAnnotation(patch map[string]interface{}, value interface{}) {
+	metadata := patch["metadata"].(map[string]interface{})
+	metadata["annotations"] = map[string]interface{}{PreviousResourcesAnnotation: value}
+}
+
+func patchWorkload(ctx context.Context, clientset kubernetes.Interface, w types.Workload, patch map[string]interface{}, opts Options) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	patchOpts := metav1.PatchOptions{FieldManager: fieldManager}
+	if opts.DryRun {
+		patchOpts.DryRun = []string{metav1.DryRunAll}
+	}
+
+	pt := k8stypes.StrategicMergePatchType
+	switch w.Kind {
+	case "Deployment":
+		_, err = clientset.AppsV1().Deployments(w.Namespace).Patch(ctx, w.Name, pt, data, patchOpts)
+	case "StatefulSet":
+		_, err = clientset.AppsV1().StatefulSets(w.Namespace).Patch(ctx, w.Name, pt, data, patchOpts)
+	case "DaemonSet":
+		_, err = clientset.AppsV1().DaemonSets(w.Namespace).Patch(ctx, w.Name, pt, data, patchOpts)
+	}
+	return err
+}
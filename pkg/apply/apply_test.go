@@ -0,0 +1,296 @@
+package apply
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testDeployment() *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "web"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name: "app",
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("500m"),
+									corev1.ResourceMemory: resource.MustParse("512Mi"),
+								},
+								Limits: corev1.ResourceList{
+									corev1.ResourceMemory:           resource.MustParse("1Gi"),
+									corev1.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+								},
+							},
+						},
+						{Name: "sidecar"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func recommendation(cpu, memory int64) types.ContainerResources {
+	return types.ContainerResources{
+		Requests: types.PodConfiguration{CPU: cpu, Memory: memory},
+		Limits:   types.PodConfiguration{CPU: 2 * cpu, Memory: 2 * memory},
+	}
+}
+
+func container(t *testing.T, clientset *fake.Clientset, name string) (corev1.Container, map[string]string) {
+	t.Helper()
+	d, err := clientset.AppsV1().Deployments("prod").Get(context.Background(), "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range d.Spec.Template.Spec.Containers {
+		if c.Name == name {
+			return c, d.Annotations
+		}
+	}
+	t.Fatalf("container %s not found", name)
+	return corev1.Container{}, nil
+}
+
+func quantity(list corev1.ResourceList, name corev1.ResourceName) string {
+	q, ok := list[name]
+	if !ok {
+		return "<unset>"
+	}
+	return q.String()
+}
+
+type resourceCheck struct {
+	name string
+	list corev1.ResourceList
+	res  corev1.ResourceName
+	want string
+}
+
+func checkResources(t *testing.T, checks []resourceCheck) {
+	t.Helper()
+	for _, c := range checks {
+		if got := quantity(c.list, c.res); got != c.want {
+			t.Errorf("%s = %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(testDeployment())
+	w := types.Workload{Namespace: "prod", Kind: "Deployment", Name: "web"}
+
+	err := Apply(ctx, clientset, w, map[string]types.ContainerResources{
+		"app":     recommendation(200, 256),
+		"missing": recommendation(100, 100),
+	}, Options{})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	app, annotations := container(t, clientset, "app")
+	checkResources(t, []resourceCheck{
+		{"app requests.cpu", app.Resources.Requests, corev1.ResourceCPU, "200m"},
+		{"app requests.memory", app.Resources.Requests, corev1.ResourceMemory, "256Mi"},
+		{"app limits.cpu", app.Resources.Limits, corev1.ResourceCPU, "400m"},
+		{"app limits.memory", app.Resources.Limits, corev1.ResourceMemory, "512Mi"},
+		{"app limits.ephemeral-storage", app.Resources.Limits, corev1.ResourceEphemeralStorage, "1Gi"},
+	})
+	if sidecar, _ := container(t, clientset, "sidecar"); len(sidecar.Resources.Requests) != 0 {
+		t.Errorf("sidecar resources changed: %v", sidecar.Resources)
+	}
+	if _, ok := annotations[PreviousResourcesAnnotation]; !ok {
+		t.Errorf("annotation %s not set", PreviousResourcesAnnotation)
+	}
+
+	applied, err := Applied(ctx, clientset, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0] != w {
+		t.Errorf("Applied = %v, want [%s]", applied, w)
+	}
+}
+
+func TestRollbackAfterRepeatedApply(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(testDeployment())
+	w := types.Workload{Namespace: "prod", Kind: "Deployment", Name: "web"}
+
+	steps := []map[string]types.ContainerResources{
+		{"app": recommendation(200, 256)},
+		{"app": recommendation(300, 384), "sidecar": recommendation(50, 64)},
+	}
+	for i, containers := range steps {
+		if err := Apply(ctx, clientset, w, containers, Options{}); err != nil {
+			t.Fatalf("Apply #%d: %v", i+1, err)
+		}
+	}
+	if app, _ := container(t, clientset, "app"); quantity(app.Resources.Requests, corev1.ResourceCPU) != "300m" {
+		t.Fatalf("second Apply not applied: %v", app.Resources)
+	}
+
+	// The kind is matched case-insensitively, as typed on the command line.
+	skipped, err := Rollback(ctx, clientset, types.Workload{Namespace: "prod", Kind: "deployment", Name: "web"}, Options{})
+	if err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if len(skipped) != 0 {
+		t.Errorf("skipped = %v, want none", skipped)
+	}
+
+	app, annotations := container(t, clientset, "app")
+	sidecar, _ := container(t, clientset, "sidecar")
+	checkResources(t, []resourceCheck{
+		{"app requests.cpu", app.Resources.Requests, corev1.ResourceCPU, "500m"},
+		{"app requests.memory", app.Resources.Requests, corev1.ResourceMemory, "512Mi"},
+		{"app limits.cpu", app.Resources.Limits, corev1.ResourceCPU, "<unset>"},
+		{"app limits.memory", app.Resources.Limits, corev1.ResourceMemory, "1Gi"},
+		{"app limits.ephemeral-storage", app.Resources.Limits, corev1.ResourceEphemeralStorage, "1Gi"},
+		{"sidecar requests.cpu", sidecar.Resources.Requests, corev1.ResourceCPU, "<unset>"},
+		{"sidecar limits.memory", sidecar.Resources.Limits, corev1.ResourceMemory, "<unset>"},
+	})
+	if _, ok := annotations[PreviousResourcesAnnotation]; ok {
+		t.Errorf("annotation %s left after rollback", PreviousResourcesAnnotation)
+	}
+
+	if _, err := Rollback(ctx, clientset, w, Options{}); !errors.Is(err, ErrNoRollback) {
+		t.Errorf("second Rollback error = %v, want ErrNoRollback", err)
+	}
+}
+
+func TestRollbackSkipsRemovedContainers(t *testing.T) {
+	tests := []struct {
+		name    string
+		keep    []string
+		skipped []string
+	}{
+		{"sidecar removed", []string{"app"}, []string{"sidecar"}},
+		{"all containers replaced", []string{"worker"}, []string{"app", "sidecar"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clientset := fake.NewSimpleClientset(testDeployment())
+			w := types.Workload{Namespace: "prod", Kind: "Deployment", Name: "web"}
+			err := Apply(ctx, clientset, w, map[string]types.ContainerResources{
+				"app":     recommendation(200, 256),
+				"sidecar": recommendation(50, 64),
+			}, Options{})
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+
+			// The template changes between apply and rollback.
+			d, err := clientset.AppsV1().Deployments("prod").Get(ctx, "web", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var containers []corev1.Container
+			for _, name := range tt.keep {
+				c := corev1.Container{Name: name, Image: "web:2"}
+				for _, old := range d.Spec.Template.Spec.Containers {
+					if old.Name == name {
+						c = old
+					}
+				}
+				containers = append(containers, c)
+			}
+			d.Spec.Template.Spec.Containers = containers
+			if _, err := clientset.AppsV1().Deployments("prod").Update(ctx, d, metav1.UpdateOptions{}); err != nil {
+				t.Fatal(err)
+			}
+
+			skipped, err := Rollback(ctx, clientset, w, Options{})
+			if err != nil {
+				t.Fatalf("Rollback: %v", err)
+			}
+			if !reflect.DeepEqual(skipped, tt.skipped) {
+				t.Errorf("skipped = %v, want %v", skipped, tt.skipped)
+			}
+
+			d, err = clientset.AppsV1().Deployments("prod").Get(ctx, "web", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, c := range d.Spec.Template.Spec.Containers {
+				names = append(names, c.Name)
+			}
+			if !reflect.DeepEqual(names, tt.keep) {
+				t.Errorf("containers after rollback = %v, want %v", names, tt.keep)
+			}
+			if _, ok := d.Annotations[PreviousResourcesAnnotation]; ok {
+				t.Errorf("annotation %s left after rollback", PreviousResourcesAnnotation)
+			}
+			if c, _ := container(t, clientset, tt.keep[0]); c.Name == "app" {
+				checkResources(t, []resourceCheck{
+					{"app requests.cpu", c.Resources.Requests, corev1.ResourceCPU, "500m"},
+					{"app limits.memory", c.Resources.Limits, corev1.ResourceMemory, "1Gi"},
+				})
+			}
+		})
+	}
+}
+
+func TestUnsupportedKinds(t *testing.T) {
+	tests := []struct {
+		kind      string
+		supported bool
+	}{
+		{"Deployment", true},
+		{"deployment", true},
+		{"STATEFULSET", true},
+		{"DaemonSet", true},
+		{"CronJob", false},
+		{"Pod", false},
+		{"ReplicaSet", false},
+		{"", false},
+	}
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			if got := Supported(tt.kind); got != tt.supported {
+				t.Errorf("Supported(%q) = %v, want %v", tt.kind, got, tt.supported)
+			}
+			if tt.supported {
+				return
+			}
+			w := types.Workload{Namespace: "prod", Kind: tt.kind, Name: "web"}
+			if err := Apply(ctx, clientset, w, map[string]types.ContainerResources{"app": recommendation(100, 100)}, Options{}); err == nil {
+				t.Error("Apply accepted an unsupported kind")
+			}
+			if _, err := Rollback(ctx, clientset, w, Options{}); err == nil || errors.Is(err, ErrNoRollback) {
+				t.Errorf("Rollback error = %v, want unsupported kind", err)
+			}
+		})
+	}
+	if len(clientset.Actions()) != 0 {
+		t.Errorf("unsupported kinds reached the API: %v", clientset.Actions())
+	}
+}
+
+func TestApplyWithoutRecommendedContainers(t *testing.T) {
+	clientset := fake.NewSimpleClientset(testDeployment())
+	w := types.Workload{Namespace: "prod", Kind: "Deployment", Name: "web"}
+	if err := Apply(context.Background(), clientset, w, map[string]types.ContainerResources{"other": recommendation(1, 1)}, Options{}); err == nil {
+		t.Fatal("Apply succeeded without matching containers")
+	}
+	if _, annotations := container(t, clientset, "app"); annotations[PreviousResourcesAnnotation] != "" {
+		t.Error("annotation written although nothing was applied")
+	}
+}
@@ -0,0 +1,194 @@
+// Package chart draws small inline SVG charts for self-contained HTML
+// reports.
+package chart
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strings"
+	"time"
+)
+
+// Point is one value of a time series.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+type Series struct {
+	Name   string
+	Points []Point
+}
+
+var palette = []string{
+	"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f",
+	"#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac",
+}
+
+// Color returns the colour of the i-th series.
+func Color(i int) string {
+	return palette[i%len(palette)]
+}
+
+const (
+	width        = 720
+	plotHeight   = 180
+	padLeft      = 64
+	padRight     = 16
+	padTop       = 10
+	axisHeight   = 24
+	legendRow    = 18
+	yTicks       = 4
+	timeTicks    = 5
+	fontSize     = 11
+	isolatedDotR = 2
+)
+
+// Line draws the series as a line chart with a shared time axis and a value
+// axis from zero, labelled in unit. Consecutive points further apart than
+// gap are not joined, so holes in the data stay visible.
+func Line(series []Series, unit string, gap time.Duration) template.HTML {
+	var from, to time.Time
+	var top float64
+	for _, s := range series {
+		for _, p := range s.Points {
+			if from.IsZero() || p.Time.Before(from) {
+				from = p.Time
+			}
+			if p.Time.After(to) {
+				to = p.Time
+			}
+			top = math.Max(top, p.Value)
+		}
+	}
+	if from.IsZero() {
+		return ""
+	}
+	step := niceStep(top / yTicks)
+	top = step * math.Ceil(top/step)
+	if top == 0 {
+		top = step * yTicks
+	}
+	span := to.Sub(from)
+	if span <= 0 {
+		span = time.Second
+	}
+
+	plotWidth := float64(width - padLeft - padRight)
+	x := func(t time.Time) float64 {
+		return padLeft + plotWidth*float64(t.Sub(from))/float64(span)
+	}
+	y := func(v float64) float64 {
+		return padTop + plotHeight*(1-v/top)
+	}
+
+	height := padTop + plotHeight + axisHeight + legendRow*len(series)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" font-family="sans-serif" font-size="%d">`,
+		width, height, width, height, fontSize)
+
+	for v := 0.0; v <= top+step/2; v += step {
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#e5e5e5"/>`, padLeft, y(v), width-padRight, y(v))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle" fill="#666">%s%s</text>`,
+			padLeft-6, y(v), formatValue(v), html.EscapeString(unit))
+	}
+	layout := "15:04"
+	if span >= 24*time.Hour {
+		layout = "02.01 15:04"
+	}
+	for i := 0; i < timeTicks; i++ {
+		t := from.Add(time.Duration(float64(span) * float64(i) / (timeTicks - 1)))
+		anchor := "middle"
+		switch i {
+		case 0:
+			anchor = "start"
+		case timeTicks - 1:
+			anchor = "end"
+		}
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="%s" fill="#666">%s</text>`,
+			x(t), padTop+plotHeight+16, anchor, t.Format(layout))
+	}
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999"/>`,
+		padLeft, padTop+plotHeight, width-padRight, padTop+plotHeight)
+
+	for i, s := range series {
+		color := Color(i)
+		var path strings.Builder
+		for j, p := range s.Points {
+			joined := j > 0 && p.Time.Sub(s.Points[j-1].Time) <= gap
+			if joined {
+				fmt.Fprintf(&path, "L%.1f %.1f", x(p.Time), y(p.Value))
+			} else {
+				fmt.Fprintf(&path, "M%.1f %.1f", x(p.Time), y(p.Value))
+			}
+			// Points joined to neither neighbour would not show as a line.
+			next := j+1 < len(s.Points) && s.Points[j+1].Time.Sub(p.Time) <= gap
+			if !joined && !next {
+				fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="%d" fill="%s"/>`, x(p.Time), y(p.Value), isolatedDotR, color)
+			}
+		}
+		fmt.Fprintf(&b, `<path d="%s" fill="none" stroke="%s" stroke-width="1.5"/>`, path.String(), color)
+
+		legendY := padTop + plotHeight + axisHeight + legendRow*i + legendRow/2
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/>`, padLeft, legendY-5, color)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" dominant-baseline="middle">%s</text>`, padLeft+16, legendY, html.EscapeString(s.Name))
+	}
+
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// Bar draws value against limit as a horizontal bar: green up to 70%, amber
+// up to 90% and red above. Values over the limit fill the whole bar.
+func Bar(value, limit float64) template.HTML {
+	if limit <= 0 {
+		return ""
+	}
+	ratio := value / limit
+	color := "#59a14f"
+	switch {
+	case ratio > 0.9:
+		color = "#e15759"
+	case ratio > 0.7:
+		color = "#edc948"
+	}
+	return bar(ratio, color)
+}
+
+// Share draws value as a part of total in a neutral colour.
+func Share(value, total float64) template.HTML {
+	if total <= 0 {
+		return ""
+	}
+	return bar(value/total, palette[0])
+}
+
+func bar(ratio float64, color string) template.HTML {
+	const barWidth, barHeight = 200, 12
+	return template.HTML(fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d"><rect width="%d" height="%d" fill="#eee"/><rect width="%.1f" height="%d" fill="%s"/></svg>`,
+		barWidth, barHeight, barWidth, barHeight, barWidth*math.Max(math.Min(ratio, 1), 0), barHeight, color))
+}
+
+// niceStep rounds v up to 1, 2 or 5 times a power of ten.
+func niceStep(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if v <= m*magnitude {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func formatValue(v float64) string {
+	if v == math.Trunc(v) {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%g", v)
+}
@@ -0,0 +1,384 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	"github.com/nightness333/k8s-monitor/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metrics "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+const (
+	listPageSize = 500
+	eventBuffer  = 1024
+)
+
+// Collector keeps a shared-informer cache of the filtered pods and joins it
+// with one bulk PodMetrics List per tick. Pod lifecycle changes observed by
+// the informers are published on Events between ticks.
+type Collector struct {
+	clientset     kubernetes.Interface
+	metricsClient metrics.Interface
+	namespaces    []string
+	listOptions   metav1.ListOptions
+
+	// ctx is the context given to Start; informer event handlers use it
+	// for the API calls they make.
+	ctx       context.Context
+	factories []informers.SharedInformerFactory
+	listers   []corelisters.PodLister
+	resolver  *utils.WorkloadResolver
+	events    chan types.PodMetric
+
+	// Nodes are watched cluster-wide regardless of the namespace filter.
+	// nodeErr is set by Start when nodes cannot be listed; pod collection
+	// still works then, without node snapshots.
+	nodeFactory informers.SharedInformerFactory
+	nodeLister  corelisters.NodeLister
+	nodeErr     error
+
+	// captureLabels are the pod labels recorded with every sample; a
+	// namespace label with the same key is used when the pod has none.
+	// Namespaces are only watched when labels are captured.
+	captureLabels []string
+	nsFactory     informers.SharedInformerFactory
+	nsLister      corelisters.NamespaceLister
+	nsErr         error
+}
+
+type Tick struct {
+	Metrics []types.PodMetric
+	Nodes   []types.NodeMetric
+	Pods    int
+	Success int
+	Errors  int
+
+	// NodesErr is set when node usage could not be collected. The pod
+	// samples of the tick are complete then, and Nodes have no usage.
+	NodesErr error
+}
+
+func New(clientset kubernetes.Interface, metricsClient metrics.Interface, namespaces []string, labelSelector map[string]string, captureLabels []string) *Collector {
+	c := &Collector{
+		clientset:     clientset,
+		metricsClient: metricsClient,
+		namespaces:    namespaces,
+		captureLabels: captureLabels,
+		listOptions: metav1.ListOptions{
+			LabelSelector: labels.Set(labelSelector).String(),
+		},
+		ctx:      context.Background(),
+		resolver: utils.NewWorkloadResolver(clientset),
+		events:   make(chan types.PodMetric, eventBuffer),
+	}
+
+	for _, ns := range c.scopes() {
+		factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+			informers.WithNamespace(ns),
+			informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.LabelSelector = c.listOptions.LabelSelector
+			}),
+		)
+		podInformer := factory.Core().V1().Pods()
+		podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+			AddFunc:    c.onAdd,
+			UpdateFunc: c.onUpdate,
+			DeleteFunc: c.onDelete,
+		})
+		c.factories = append(c.factories, factory)
+		c.listers = append(c.listers, podInformer.Lister())
+	}
+
+	c.nodeFactory = informers.NewSharedInformerFactory(clientset, 0)
+	c.nodeLister = c.nodeFactory.Core().V1().Nodes().Lister()
+
+	if len(captureLabels) > 0 {
+		c.nsFactory = informers.NewSharedInformerFactory(clientset, 0)
+		c.nsLister = c.nsFactory.Core().V1().Namespaces().Lister()
+	}
+
+	return c
+}
+
+// Start runs the informers until ctx is cancelled and blocks until their
+// caches are synced.
+func (c *Collector) Start(ctx context.Context) error {
+	c.ctx = ctx
+	factories := c.factories
+	if _, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{Limit: 1}); err != nil {
+		c.nodeErr = err
+	} else {
+		factories = append(factories, c.nodeFactory)
+	}
+	if c.nsFactory != nil {
+		if _, err := c.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{Limit: 1}); err != nil {
+			c.nsErr = err
+		} else {
+			factories = append(factories, c.nsFactory)
+		}
+	}
+
+	for _, factory := range factories {
+		factory.Start(ctx.Done())
+	}
+	for _, factory := range factories {
+		for informer, synced := range factory.WaitForCacheSync(ctx.Done()) {
+			if !synced {
+				return fmt.Errorf("не удалось синхронизировать кеш %v", informer)
+			}
+		}
+	}
+	return nil
+}
+
+// Warnings lists the optional data that cannot be collected with the
+// current permissions: node snapshots and namespace labels.
+func (c *Collector) Warnings() []string {
+	var warnings []string
+	if c.nodeErr != nil {
+		warnings = append(warnings, fmt.Sprintf("данные узлов не собираются: %v", c.nodeErr))
+	}
+	if c.nsErr != nil {
+		warnings = append(warnings, fmt.Sprintf("метки namespace не собираются: %v", c.nsErr))
+	}
+	return warnings
+}
+
+// Events delivers pod lifecycle events (created, deleted, phase changed).
+// Events for pods present at startup are not reported.
+func (c *Collector) Events() <-chan types.PodMetric {
+	return c.events
+}
+
+func (c *Collector) CheckMetricsServer(ctx context.Context) error {
+	_, err := c.metricsClient.MetricsV1beta1().PodMetricses("").List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return fmt.Errorf("не удалось получить метрики: %v", err)
+	}
+	return nil
+}
+
+// Pods returns the cached pods matching the filters, ordered by namespace/name.
+func (c *Collector) Pods() ([]*corev1.Pod, error) {
+	var pods []*corev1.Pod
+	for _, lister := range c.listers {
+		items, err := lister.List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, items...)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Name < pods[j].Name
+	})
+	return pods, nil
+}
+
+// Collect samples every cached pod: one row per container of running pods
+// with metrics, and one status row for the others. An error means the pod
+// samples are not usable; a failure of node metrics alone is reported in
+// Tick.NodesErr.
+func (c *Collector) Collect(ctx context.Context, now time.Time) (*Tick, error) {
+	pods, err := c.Pods()
+	if err != nil {
+		return nil, err
+	}
+
+	podMetrics, metricsErr := c.listPodMetrics(ctx)
+
+	tick := &Tick{Pods: len(pods)}
+	for _, pod := range pods {
+		base := c.podRow(ctx, pod, now)
+		resources := utils.ContainerResourcesFromSpec(pod.Spec)
+		// Rows without usage carry the resources of the whole pod, so that
+		// the requests on a node include pods without metrics.
+		total := podResources(resources)
+		base.CPURequest, base.MemoryRequest = total.Requests.CPU, total.Requests.Memory
+		base.CPULimit, base.MemoryLimit = total.Limits.CPU, total.Limits.Memory
+
+		if pod.Status.Phase != corev1.PodRunning {
+			base.Status = types.StatusSkipPrefix + string(pod.Status.Phase)
+			tick.Metrics = append(tick.Metrics, base)
+			continue
+		}
+
+		pm, found := podMetrics[pod.Namespace+"/"+pod.Name]
+		switch {
+		case metricsErr != nil:
+			base.Status = fmt.Sprintf("ERROR: %v", metricsErr)
+			tick.Errors++
+		case !found || len(pm.Containers) == 0:
+			base.Status = types.StatusNoMetrics
+			tick.Errors++
+		default:
+			for _, container := range pm.Containers {
+				row := base
+				row.Container = container.Name
+				spec := resources[container.Name]
+				row.CPURequest, row.MemoryRequest = spec.Requests.CPU, spec.Requests.Memory
+				row.CPULimit, row.MemoryLimit = spec.Limits.CPU, spec.Limits.Memory
+				row.CPU = container.Usage.Cpu().MilliValue()
+				row.Memory = container.Usage.Memory().Value() / 1024 / 1024
+				row.Status = types.StatusOK
+				row.HasCPU = true
+				row.HasMemory = true
+				tick.Metrics = append(tick.Metrics, row)
+			}
+			tick.Success++
+			continue
+		}
+		tick.Metrics = append(tick.Metrics, base)
+	}
+
+	if c.nodeErr == nil {
+		tick.Nodes, tick.NodesErr = c.nodeSnapshots(ctx, now)
+	}
+
+	if metricsErr != nil {
+		return tick, fmt.Errorf("ошибка получения метрик: %v", metricsErr)
+	}
+	return tick, nil
+}
+
+// nodeSnapshots returns every cached node with its capacity, conditions and
+// usage. When NodeMetrics cannot be listed the nodes are still returned,
+// without usage, together with the error.
+func (c *Collector) nodeSnapshots(ctx context.Context, now time.Time) ([]types.NodeMetric, error) {
+	nodes, err := c.nodeLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	usage := make(map[string]corev1.ResourceList)
+	list, metricsErr := c.metricsClient.MetricsV1beta1().NodeMetricses().List(ctx, metav1.ListOptions{})
+	if metricsErr == nil {
+		for _, nm := range list.Items {
+			usage[nm.Name] = nm.Usage
+		}
+	}
+
+	result := make([]types.NodeMetric, 0, len(nodes))
+	for _, node := range nodes {
+		n := types.NodeMetric{
+			Timestamp:         now,
+			Node:              node.Name,
+			Labels:            node.Labels,
+			CPUCapacity:       node.Status.Capacity.Cpu().MilliValue(),
+			MemoryCapacity:    node.Status.Capacity.Memory().Value() / (1024 * 1024),
+			CPUAllocatable:    node.Status.Allocatable.Cpu().MilliValue(),
+			MemoryAllocatable: node.Status.Allocatable.Memory().Value() / (1024 * 1024),
+			Conditions:        make(map[string]string, len(node.Status.Conditions)),
+		}
+		for _, cond := range node.Status.Conditions {
+			n.Conditions[string(cond.Type)] = string(cond.Status)
+		}
+		if u, ok := usage[node.Name]; ok {
+			n.CPU = u.Cpu().MilliValue()
+			n.Memory = u.Memory().Value() / (1024 * 1024)
+			n.HasUsage = true
+		}
+		result = append(result, n)
+	}
+	if metricsErr != nil {
+		return result, fmt.Errorf("ошибка получения метрик узлов: %v", metricsErr)
+	}
+	return result, nil
+}
+
+func (c *Collector) scopes() []string {
+	if len(c.namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return c.namespaces
+}
+
+// listPodMetrics fetches usage for all pods matched by the same filters as
+// the informers in one paginated List per namespace, keyed by namespace/pod.
+func (c *Collector) listPodMetrics(ctx context.Context) (map[string]metricsv1beta1.PodMetrics, error) {
+	result := make(map[string]metricsv1beta1.PodMetrics)
+	for _, ns := range c.scopes() {
+		opts := c.listOptions
+		opts.Limit = listPageSize
+		for {
+			page, err := c.metricsClient.MetricsV1beta1().PodMetricses(ns).List(ctx, opts)
+			if err != nil {
+				return nil, fmt.Errorf("ns %q: %v", ns, err)
+			}
+			for _, pm := range page.Items {
+				result[pm.Namespace+"/"+pm.Name] = pm
+			}
+			if page.Continue == "" {
+				break
+			}
+			opts.Continue = page.Continue
+		}
+	}
+	return result, nil
+}
+
+func podResources(resources map[string]types.ContainerResources) types.ContainerResources {
+	var total types.ContainerResources
+	for _, r := range resources {
+		total.Requests.CPU += r.Requests.CPU
+		total.Requests.Memory += r.Requests.Memory
+		total.Limits.CPU += r.Limits.CPU
+		total.Limits.Memory += r.Limits.Memory
+	}
+	return total
+}
+
+func (c *Collector) podRow(ctx context.Context, pod *corev1.Pod, now time.Time) types.PodMetric {
+	workload := c.resolver.Resolve(ctx, pod)
+	return types.PodMetric{
+		Timestamp:    now,
+		Namespace:    pod.Namespace,
+		Pod:          pod.Name,
+		WorkloadKind: workload.Kind,
+		WorkloadName: workload.Name,
+		Node:         pod.Spec.NodeName,
+		Labels:       c.podLabels(pod),
+	}
+}
+
+// podLabels picks the captured labels of pod, falling back to the labels of
+// its namespace.
+func (c *Collector) podLabels(pod *corev1.Pod) map[string]string {
+	if len(c.captureLabels) == 0 {
+		return nil
+	}
+
+	var nsLabels map[string]string
+	if c.nsErr == nil {
+		if ns, err := c.nsLister.Get(pod.Namespace); err == nil {
+			nsLabels = ns.Labels
+		}
+	}
+
+	result := make(map[string]string)
+	for _, key := range c.captureLabels {
+		if v, ok := pod.Labels[key]; ok {
+			result[key] = v
+		} else if v, ok := nsLabels[key]; ok {
+			result[key] = v
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,297 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+func testPod(namespace, name string, phase corev1.PodPhase, owner *metav1.OwnerReference) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: map[string]string{"app": name}},
+		Spec: corev1.PodSpec{
+			NodeName: "node-1",
+			Containers: []corev1.Container{{
+				Name: "app",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("100m"),
+						corev1.ResourceMemory: resource.MustParse("128Mi"),
+					},
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+				},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+	if owner != nil {
+		pod.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	return pod
+}
+
+func controller(kind, name string) *metav1.OwnerReference {
+	isController := true
+	return &metav1.OwnerReference{Kind: kind, Name: name, Controller: &isController}
+}
+
+func podUsage(namespace, name string, cpu, memory string) metricsv1beta1.PodMetrics {
+	return metricsv1beta1.PodMetrics{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Containers: []metricsv1beta1.ContainerMetrics{{
+			Name: "app",
+			Usage: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse(memory),
+			},
+		}},
+	}
+}
+
+// fakeMetrics serves PodMetrics and NodeMetrics lists through reactors: the
+// generated fake clientset stores them under the "pods" and "nodes"
+// resources, which its tracker cannot list. A non-nil *failure makes every
+// list fail.
+func fakeMetrics(pods []metricsv1beta1.PodMetrics, nodes []metricsv1beta1.NodeMetrics, failure *error) *metricsfake.Clientset {
+	client := metricsfake.NewSimpleClientset()
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if *failure != nil {
+			return true, nil, *failure
+		}
+		ns := action.GetNamespace()
+		list := &metricsv1beta1.PodMetricsList{}
+		for _, pm := range pods {
+			if ns == "" || pm.Namespace == ns {
+				list.Items = append(list.Items, pm)
+			}
+		}
+		return true, list, nil
+	})
+	client.PrependReactor("list", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if *failure != nil {
+			return true, nil, *failure
+		}
+		return true, &metricsv1beta1.NodeMetricsList{Items: nodes}, nil
+	})
+	return client
+}
+
+func startCollector(t *testing.T, c *Collector) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+}
+
+func rowsByPod(tick *Tick) map[string]types.PodMetric {
+	rows := make(map[string]types.PodMetric)
+	for _, m := range tick.Metrics {
+		rows[m.Namespace+"/"+m.Pod] = m
+	}
+	return rows
+}
+
+func TestCollect(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"zone": "a"}},
+		Status: corev1.NodeStatus{
+			Capacity:    corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4"), corev1.ResourceMemory: resource.MustParse("8Gi")},
+			Allocatable: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("3500m"), corev1.ResourceMemory: resource.MustParse("7Gi")},
+			Conditions:  []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "web-7d9f", OwnerReferences: []metav1.OwnerReference{*controller("Deployment", "web")}}}
+	clientset := fake.NewSimpleClientset(node, rs,
+		testPod("prod", "web-7d9f-a", corev1.PodRunning, controller("ReplicaSet", "web-7d9f")),
+		testPod("prod", "web-7d9f-b", corev1.PodRunning, controller("ReplicaSet", "web-7d9f")),
+		testPod("prod", "migrate", corev1.PodSucceeded, nil),
+		testPod("dev", "other", corev1.PodRunning, nil),
+	)
+	var failure error
+	metricsClient := fakeMetrics(
+		[]metricsv1beta1.PodMetrics{podUsage("prod", "web-7d9f-a", "250m", "300Mi"), podUsage("dev", "other", "1", "1Gi")},
+		[]metricsv1beta1.NodeMetrics{{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Usage:      corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1200m"), corev1.ResourceMemory: resource.MustParse("2Gi")},
+		}},
+		&failure,
+	)
+
+	c := New(clientset, metricsClient, []string{"prod"}, nil, []string{"app"})
+	startCollector(t, c)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tick, err := c.Collect(context.Background(), now)
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if tick.Pods != 3 || tick.Success != 1 || tick.Errors != 1 {
+		t.Errorf("tick counts = %d/%d/%d, want pods 3, success 1, errors 1", tick.Pods, tick.Success, tick.Errors)
+	}
+
+	rows := rowsByPod(tick)
+	if _, ok := rows["dev/other"]; ok {
+		t.Error("pod outside the namespace filter was collected")
+	}
+
+	ok := rows["prod/web-7d9f-a"]
+	if ok.Status != types.StatusOK || !ok.HasUsage() || ok.CPU != 250 || ok.Memory != 300 || ok.Container != "app" {
+		t.Errorf("running pod row = %+v", ok)
+	}
+	if ok.WorkloadKind != "Deployment" || ok.WorkloadName != "web" || ok.Node != "node-1" {
+		t.Errorf("workload = %s/%s on %q, want Deployment/web on node-1", ok.WorkloadKind, ok.WorkloadName, ok.Node)
+	}
+	if ok.CPURequest != 100 || ok.MemoryRequest != 128 || ok.MemoryLimit != 256 || ok.CPULimit != 0 {
+		t.Errorf("resources = %+v", ok.Resources())
+	}
+	if ok.Labels["app"] != "web-7d9f-a" {
+		t.Errorf("captured labels = %v", ok.Labels)
+	}
+
+	noMetrics := rows["prod/web-7d9f-b"]
+	if noMetrics.Status != types.StatusNoMetrics || noMetrics.HasUsage() || noMetrics.Container != "" {
+		t.Errorf("pod without metrics row = %+v, want %s without usage", noMetrics, types.StatusNoMetrics)
+	}
+	if noMetrics.CPURequest != 100 || noMetrics.MemoryRequest != 128 || noMetrics.MemoryLimit != 256 {
+		t.Errorf("pod without metrics resources = %+v, want the pod's requests and limits", noMetrics.Resources())
+	}
+	if skipped := rows["prod/migrate"]; skipped.Status != types.StatusSkipPrefix+"Succeeded" || !skipped.Finished() {
+		t.Errorf("finished pod status = %q", skipped.Status)
+	}
+
+	if len(tick.Nodes) != 1 {
+		t.Fatalf("nodes = %v, want node-1", tick.Nodes)
+	}
+	n := tick.Nodes[0]
+	if !n.HasUsage || n.CPU != 1200 || n.Memory != 2048 || n.CPUAllocatable != 3500 || n.MemoryCapacity != 8192 || n.Conditions["Ready"] != "True" {
+		t.Errorf("node snapshot = %+v", n)
+	}
+
+	failure = errors.New("metrics-server unavailable")
+	tick, err = c.Collect(context.Background(), now.Add(time.Minute))
+	if err == nil {
+		t.Fatal("Collect succeeded with metrics-server down")
+	}
+	for _, m := range tick.Metrics {
+		if m.HasUsage() {
+			t.Errorf("row with usage on a failed tick: %+v", m)
+		}
+		if m.Pod != "migrate" && !strings.HasPrefix(m.Status, "ERROR: ") {
+			t.Errorf("running pod status on a failed tick = %q", m.Status)
+		}
+	}
+	if len(tick.Nodes) != 1 || tick.Nodes[0].HasUsage {
+		t.Errorf("nodes on a failed tick = %+v, want node-1 without usage", tick.Nodes)
+	}
+}
+
+func TestCollectorFollowsInformer(t *testing.T) {
+	clientset := fake.NewSimpleClientset(testPod("prod", "web-1", corev1.PodRunning, nil))
+	var failure error
+	c := New(clientset, fakeMetrics(nil, nil, &failure), nil, nil, nil)
+	startCollector(t, c)
+
+	ctx := context.Background()
+	if _, err := clientset.CoreV1().Pods("prod").Create(ctx, testPod("prod", "web-2", corev1.PodPending, nil), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, c, "prod/web-2", "created")
+
+	running := testPod("prod", "web-2", corev1.PodRunning, nil)
+	if _, err := clientset.CoreV1().Pods("prod").Update(ctx, running, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, c, "prod/web-2", "phase=Running")
+
+	if err := clientset.CoreV1().Pods("prod").Delete(ctx, "web-1", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, c, "prod/web-1", "deleted")
+
+	pods, err := c.Pods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods) != 1 || pods[0].Name != "web-2" {
+		t.Errorf("cached pods = %v, want only web-2", pods)
+	}
+
+	tick, err := c.Collect(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if len(tick.Metrics) != 1 || tick.Metrics[0].Status != types.StatusNoMetrics {
+		t.Errorf("tick = %+v, want one %s row for web-2", tick.Metrics, types.StatusNoMetrics)
+	}
+}
+
+func expectEvent(t *testing.T, c *Collector, pod, event string) {
+	t.Helper()
+	select {
+	case m := <-c.Events():
+		if got := m.Namespace + "/" + m.Pod; got != pod || m.Status != types.EventPrefix+event {
+			t.Fatalf("event = %s %q, want %s %q", got, m.Status, pod, types.EventPrefix+event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no %q event for %s", event, pod)
+	}
+}
+
+func TestInitialPodsAreNotReported(t *testing.T) {
+	clientset := fake.NewSimpleClientset(testPod("prod", "web-1", corev1.PodRunning, nil))
+	var failure error
+	c := New(clientset, fakeMetrics(nil, nil, &failure), nil, nil, nil)
+	startCollector(t, c)
+
+	select {
+	case m := <-c.Events():
+		t.Fatalf("unexpected event for a pod present at startup: %+v", m)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNodeMetricsFailureKeepsPodSamples(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2"), corev1.ResourceMemory: resource.MustParse("4Gi")},
+		},
+	}
+	clientset := fake.NewSimpleClientset(node, testPod("prod", "web-1", corev1.PodRunning, nil))
+	var failure error
+	metricsClient := fakeMetrics([]metricsv1beta1.PodMetrics{podUsage("prod", "web-1", "250m", "300Mi")}, nil, &failure)
+	metricsClient.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("nodes.metrics.k8s.io forbidden")
+	})
+	c := New(clientset, metricsClient, nil, nil, nil)
+	startCollector(t, c)
+
+	tick, err := c.Collect(context.Background(), time.Now())
+	if err != nil {
+		t.Fatalf("Collect: %v, want node failures in Tick.NodesErr", err)
+	}
+	if tick.NodesErr == nil {
+		t.Error("NodesErr is nil with node metrics down")
+	}
+	if tick.Success != 1 || len(tick.Metrics) != 1 || !tick.Metrics[0].HasUsage() {
+		t.Errorf("pod samples = %+v, want web-1 with usage", tick.Metrics)
+	}
+	if len(tick.Nodes) != 1 || tick.Nodes[0].HasUsage || tick.Nodes[0].CPUAllocatable != 2000 {
+		t.Errorf("nodes = %+v, want node-1 with allocatable and without usage", tick.Nodes)
+	}
+}
@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func (c *Collector) onAdd(obj interface{}, isInInitialList bool) {
+	if isInInitialList {
+		return
+	}
+	if pod, ok := obj.(*corev1.Pod); ok {
+		c.emit(pod, "created")
+	}
+}
+
+func (c *Collector) onUpdate(oldObj, newObj interface{}) {
+	oldPod, ok := oldObj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	newPod, ok := newObj.(*corev1.Pod)
+	if !ok || oldPod.Status.Phase == newPod.Status.Phase {
+		return
+	}
+	c.emit(newPod, fmt.Sprintf("phase=%s", newPod.Status.Phase))
+}
+
+func (c *Collector) onDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if pod, ok := obj.(*corev1.Pod); ok {
+		c.emit(pod, "deleted")
+	}
+}
+
+// emit never blocks the informer: when the consumer falls behind, the event
+// is dropped rather than stalling the watch.
+func (c *Collector) emit(pod *corev1.Pod, event string) {
+	row := c.podRow(c.ctx, pod, time.Now())
+	row.Status = types.EventPrefix + event
+
+	select {
+	case c.events <- row:
+	default:
+		fmt.Printf("Очередь событий переполнена, событие %s для %s/%s пропущено\n", event, pod.Namespace, pod.Name)
+	}
+}
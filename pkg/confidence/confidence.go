@@ -0,0 +1,120 @@
+package confidence
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+type Level int
+
+const (
+	Low Level = iota
+	Medium
+	High
+)
+
+func (l Level) String() string {
+	switch l {
+	case High:
+		return "высокая"
+	case Medium:
+		return "средняя"
+	default:
+		return "низкая"
+	}
+}
+
+// MarshalText encodes the level as low, medium or high in machine-readable
+// output.
+func (l Level) MarshalText() ([]byte, error) {
+	switch l {
+	case High:
+		return []byte("high"), nil
+	case Medium:
+		return []byte("medium"), nil
+	default:
+		return []byte("low"), nil
+	}
+}
+
+// Thresholds below which a recommendation is low-confidence. High
+// confidence additionally needs highSamples samples over at least a day (a
+// full daily cycle), highCoverage of the span and moderate variance.
+type Thresholds struct {
+	MinSamples int64
+	MinSpan    time.Duration
+}
+
+const (
+	highSamples  = 100
+	highSpan     = 24 * time.Hour
+	lowCoverage  = 0.5
+	highCoverage = 0.9
+	// Coefficients of variation (stddev / mean) of usage.
+	mediumCV = 1.0
+	lowCV    = 3.0
+)
+
+// Score is a confidence level with the reasons it is not high.
+type Score struct {
+	Level   Level    `json:"level"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Evaluate scores the data behind a workload's recommendation by sample
+// count, covered time span, gaps and variance; the weakest criterion decides.
+func Evaluate(s *types.PodStats, t Thresholds) Score {
+	score := Score{Level: High}
+	lower := func(level Level, reason string) {
+		if level < score.Level {
+			score.Level = level
+		}
+		score.Reasons = append(score.Reasons, reason)
+	}
+
+	switch samples := s.CPU.Count; {
+	case samples < t.MinSamples:
+		lower(Low, fmt.Sprintf("мало замеров: %d (нужно не меньше %d)", samples, t.MinSamples))
+	case samples < highSamples:
+		lower(Medium, fmt.Sprintf("замеров: %d", samples))
+	}
+
+	switch span := s.Span(); {
+	case span < t.MinSpan:
+		lower(Low, fmt.Sprintf("короткий период: %s (нужно не меньше %s)", span.Round(time.Second), t.MinSpan))
+	case span < highSpan:
+		lower(Medium, fmt.Sprintf("период меньше суток: %s", span.Round(time.Minute)))
+	}
+
+	if s.Intervals.Count > 0 {
+		gap := fmt.Sprintf("пропуски данных: покрытие %.0f%%, самый длинный %s",
+			s.Coverage()*100, time.Duration(s.Intervals.Max)*time.Second)
+		switch coverage := s.Coverage(); {
+		case coverage < lowCoverage:
+			lower(Low, gap)
+		case coverage < highCoverage:
+			lower(Medium, gap)
+		}
+	}
+
+	for _, series := range []struct {
+		name string
+		s    types.Series
+	}{{"CPU", s.CPU}, {"памяти", s.Memory}} {
+		mean := series.s.Avg()
+		if mean == 0 {
+			continue
+		}
+		cv := series.s.StdDev() / float64(mean)
+		reason := fmt.Sprintf("высокий разброс %s: σ/среднее = %.1f", series.name, cv)
+		switch {
+		case cv > lowCV:
+			lower(Low, reason)
+		case cv > mediumCV:
+			lower(Medium, reason)
+		}
+	}
+	return score
+}
@@ -0,0 +1,132 @@
+package confidence
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+var thresholds = Thresholds{MinSamples: 10, MinSpan: time.Hour}
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// workload describes recorded data: n samples step apart, with one extra gap
+// after the first half, and CPU usage spiking every spikeEvery samples.
+type workload struct {
+	n          int
+	step       time.Duration
+	gap        time.Duration
+	spikeEvery int
+	memory     bool
+}
+
+// stats builds the statistics of w the way report collects them. With a
+// spike of spikeEvery*100 in every spikeEvery samples the mean is 100 and
+// σ/mean is sqrt(spikeEvery-1).
+func (w workload) stats() *types.PodStats {
+	s := &types.PodStats{CPU: types.NewSeries(true), Memory: types.NewSeries(true), Intervals: types.NewSeries(true)}
+	at := start
+	for i := 0; i < w.n; i++ {
+		if i > 0 {
+			next := at.Add(w.step)
+			if i == w.n/2 {
+				next = at.Add(w.gap)
+			}
+			s.Intervals.Add(int64(next.Sub(at).Seconds()))
+			at = next
+		}
+		value := int64(100)
+		if w.spikeEvery > 0 {
+			value = 0
+			if i%w.spikeEvery == 0 {
+				value = int64(w.spikeEvery) * 100
+			}
+		}
+		if w.memory {
+			s.CPU.Add(100)
+			s.Memory.Add(value)
+		} else {
+			s.CPU.Add(value)
+			s.Memory.Add(256)
+		}
+	}
+	s.First, s.Last = start, at
+	return s
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   workload
+		want   Level
+		reason string
+	}{
+		// A day of samples every 10 minutes is the reference: high.
+		{"full day", workload{n: 145, step: 10 * time.Minute}, High, ""},
+
+		{"below min samples", workload{n: 9, step: 10 * time.Minute}, Low, "мало замеров: 9"},
+		{"at min samples", workload{n: 10, step: 10 * time.Minute}, Medium, "замеров: 10"},
+		{"below high samples", workload{n: 99, step: 15 * time.Minute}, Medium, "замеров: 99"},
+		{"at high samples", workload{n: 100, step: 15 * time.Minute}, High, ""},
+
+		{"below min span", workload{n: 120, step: 30 * time.Second}, Low, "короткий период: 59m30s"},
+		{"at min span", workload{n: 121, step: 30 * time.Second}, Medium, "период меньше суток: 1h0m0s"},
+		{"below a day", workload{n: 144, step: 10 * time.Minute}, Medium, "период меньше суток: 23h50m0s"},
+
+		// 200 samples every 10 minutes with one gap: coverage is
+		// 1990m / (1980m + gap).
+		{"gap within high coverage", workload{n: 200, step: 10 * time.Minute, gap: 230 * time.Minute}, High, ""},
+		{"gap below high coverage", workload{n: 200, step: 10 * time.Minute, gap: 240 * time.Minute}, Medium, "покрытие 90%"},
+		{"gap at low coverage", workload{n: 200, step: 10 * time.Minute, gap: 2000 * time.Minute}, Medium, "покрытие 50%"},
+		{"gap below low coverage", workload{n: 200, step: 10 * time.Minute, gap: 2010 * time.Minute}, Low, "покрытие 50%, самый длинный 33h30m0s"},
+
+		{"steady usage", workload{n: 200, step: 10 * time.Minute, spikeEvery: 1}, High, ""},
+		{"variance at medium", workload{n: 200, step: 10 * time.Minute, spikeEvery: 2}, High, ""},
+		{"variance above medium", workload{n: 200, step: 10 * time.Minute, spikeEvery: 5}, Medium, "высокий разброс CPU: σ/среднее = 2.0"},
+		{"variance above low", workload{n: 220, step: 10 * time.Minute, spikeEvery: 11}, Low, "высокий разброс CPU: σ/среднее = 3.2"},
+		{"memory variance", workload{n: 220, step: 10 * time.Minute, spikeEvery: 11, memory: true}, Low, "высокий разброс памяти"},
+
+		{"weakest criterion decides", workload{n: 9, step: time.Hour}, Low, "мало замеров"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.data.gap == 0 {
+				tt.data.gap = tt.data.step
+			}
+			score := Evaluate(tt.data.stats(), thresholds)
+			if score.Level != tt.want {
+				t.Errorf("level = %s, want %s; reasons: %v", score.Level, tt.want, score.Reasons)
+			}
+			if tt.reason == "" {
+				if len(score.Reasons) != 0 {
+					t.Errorf("reasons = %v, want none", score.Reasons)
+				}
+				return
+			}
+			found := false
+			for _, r := range score.Reasons {
+				found = found || strings.Contains(r, tt.reason)
+			}
+			if !found {
+				t.Errorf("reasons = %v, want one with %q", score.Reasons, tt.reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateCollectsReasons(t *testing.T) {
+	score := Evaluate(workload{n: 5, step: time.Minute, gap: time.Minute}.stats(), thresholds)
+	if score.Level != Low || len(score.Reasons) != 2 {
+		t.Errorf("score = %+v, want low for both the samples and the span", score)
+	}
+}
+
+func TestLevelText(t *testing.T) {
+	for level, want := range map[Level]string{Low: "low", Medium: "medium", High: "high"} {
+		if got, _ := level.MarshalText(); string(got) != want {
+			t.Errorf("MarshalText(%d) = %s, want %s", level, got, want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package exporter
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/collector"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+const (
+	namespace = "k8s_monitor"
+
+	contentTypeText        = "text/plain; version=0.0.4; charset=utf-8"
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+	mebibyte = 1024 * 1024
+)
+
+// Exporter serves the samples of the last tick and the collector's own
+// counters in the Prometheus text format, or in OpenMetrics when the scraper
+// asks for it. Values are in base units: cores and bytes.
+type Exporter struct {
+	mu sync.Mutex
+
+	tick     *collector.Tick
+	lastTick time.Time
+	duration time.Duration
+
+	ticks         int64
+	collectErrors int64
+	nodeErrors    int64
+	podErrors     int64
+}
+
+func New() *Exporter {
+	return &Exporter{}
+}
+
+// Observe records a tick. A failed collection (err != nil) only counts the
+// error and its duration, even when Collect returned a tick with it: the
+// samples and the timestamp of the last good tick are kept. A tick whose
+// node metrics alone failed (Tick.NodesErr) is served as usual, with nodes
+// without usage, and counted in node_errors_total.
+func (e *Exporter) Observe(now time.Time, tick *collector.Tick, duration time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.ticks++
+	e.duration = duration
+	if err != nil {
+		e.collectErrors++
+		return
+	}
+	if tick != nil {
+		e.tick = tick
+		e.lastTick = now
+		e.podErrors += int64(tick.Errors)
+		if tick.NodesErr != nil {
+			e.nodeErrors++
+		}
+	}
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", contentTypeOpenMetrics)
+	} else {
+		w.Header().Set("Content-Type", contentTypeText)
+	}
+
+	buf := bufio.NewWriter(w)
+	e.write(&writer{w: buf, openMetrics: openMetrics})
+	buf.Flush()
+}
+
+func (e *Exporter) write(w *writer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	w.family("ticks_total", "counter", "Number of collection ticks.")
+	w.sample("ticks_total", nil, float64(e.ticks))
+	w.family("collect_errors_total", "counter", "Number of ticks whose collection failed.")
+	w.sample("collect_errors_total", nil, float64(e.collectErrors))
+	w.family("node_errors_total", "counter", "Number of ticks whose node metrics could not be collected.")
+	w.sample("node_errors_total", nil, float64(e.nodeErrors))
+	w.family("pod_errors_total", "counter", "Number of pod samples recorded with an error status.")
+	w.sample("pod_errors_total", nil, float64(e.podErrors))
+	w.family("scrape_duration_seconds", "gauge", "Duration of the last collection from the API server and Metrics Server.")
+	w.sample("scrape_duration_seconds", nil, e.duration.Seconds())
+
+	if e.tick == nil {
+		w.end()
+		return
+	}
+	w.family("last_tick_timestamp_seconds", "gauge", "Unix time of the last successful tick.")
+	w.sample("last_tick_timestamp_seconds", nil, float64(e.lastTick.UnixNano())/1e9)
+	w.family("pods", "gauge", "Number of pods seen in the last tick.")
+	w.sample("pods", nil, float64(e.tick.Pods))
+
+	e.writeContainers(w)
+	e.writePods(w)
+	e.writeNodes(w)
+	w.end()
+}
+
+type series struct {
+	labels []string
+	value  float64
+}
+
+type containerMetric struct {
+	name, help string
+	value      func(m types.PodMetric) (float64, bool)
+}
+
+var containerMetrics = []containerMetric{
+	{"container_cpu_usage_cores", "CPU usage of the container.",
+		func(m types.PodMetric) (float64, bool) { return cores(m.CPU), true }},
+	{"container_memory_usage_bytes", "Memory usage of the container.",
+		func(m types.PodMetric) (float64, bool) { return bytes(m.Memory), true }},
+	{"container_cpu_requests_cores", "CPU request of the container.",
+		func(m types.PodMetric) (float64, bool) { return cores(m.CPURequest), m.CPURequest > 0 }},
+	{"container_cpu_limits_cores", "CPU limit of the container.",
+		func(m types.PodMetric) (float64, bool) { return cores(m.CPULimit), m.CPULimit > 0 }},
+	{"container_memory_requests_bytes", "Memory request of the container.",
+		func(m types.PodMetric) (float64, bool) { return bytes(m.MemoryRequest), m.MemoryRequest > 0 }},
+	{"container_memory_limits_bytes", "Memory limit of the container.",
+		func(m types.PodMetric) (float64, bool) { return bytes(m.MemoryLimit), m.MemoryLimit > 0 }},
+	{"container_cpu_request_utilization_ratio", "CPU usage divided by the CPU request.",
+		func(m types.PodMetric) (float64, bool) { return ratio(m.CPU, m.CPURequest) }},
+	{"container_cpu_limit_utilization_ratio", "CPU usage divided by the CPU limit.",
+		func(m types.PodMetric) (float64, bool) { return ratio(m.CPU, m.CPULimit) }},
+	{"container_memory_request_utilization_ratio", "Memory usage divided by the memory request.",
+		func(m types.PodMetric) (float64, bool) { return ratio(m.Memory, m.MemoryRequest) }},
+	{"container_memory_limit_utilization_ratio", "Memory usage divided by the memory limit.",
+		func(m types.PodMetric) (float64, bool) { return ratio(m.Memory, m.MemoryLimit) }},
+}
+
+func (e *Exporter) writeContainers(w *writer) {
+	for _, metric := range containerMetrics {
+		var samples []series
+		for _, m := range e.tick.Metrics {
+			if !m.HasUsage() || m.Container == "" {
+				continue
+			}
+			if v, ok := metric.value(m); ok {
+				samples = append(samples, series{labels: containerLabels(m), value: v})
+			}
+		}
+		w.series(metric.name, "gauge", metric.help, samples)
+	}
+}
+
+func (e *Exporter) writePods(w *writer) {
+	type pod struct {
+		labels      []string
+		cpu, memory int64
+	}
+	pods := make(map[string]*pod)
+	for _, m := range e.tick.Metrics {
+		if !m.HasUsage() {
+			continue
+		}
+		key := m.Namespace + "/" + m.Pod
+		p, ok := pods[key]
+		if !ok {
+			p = &pod{labels: podLabels(m)}
+			pods[key] = p
+		}
+		p.cpu += m.CPU
+		p.memory += m.Memory
+	}
+
+	var cpu, memory []series
+	for _, p := range pods {
+		cpu = append(cpu, series{labels: p.labels, value: cores(p.cpu)})
+		memory = append(memory, series{labels: p.labels, value: bytes(p.memory)})
+	}
+	w.series("pod_cpu_usage_cores", "gauge", "CPU usage of the pod (sum of its containers).", cpu)
+	w.series("pod_memory_usage_bytes", "gauge", "Memory usage of the pod (sum of its containers).", memory)
+}
+
+func (e *Exporter) writeNodes(w *writer) {
+	if len(e.tick.Nodes) == 0 {
+		return
+	}
+	var cpu, memory, cpuAlloc, memoryAlloc []series
+	for _, n := range e.tick.Nodes {
+		labels := []string{"node", n.Node}
+		cpuAlloc = append(cpuAlloc, series{labels: labels, value: cores(n.CPUAllocatable)})
+		memoryAlloc = append(memoryAlloc, series{labels: labels, value: bytes(n.MemoryAllocatable)})
+		if n.HasUsage {
+			cpu = append(cpu, series{labels: labels, value: cores(n.CPU)})
+			memory = append(memory, series{labels: labels, value: bytes(n.Memory)})
+		}
+	}
+	w.series("node_cpu_usage_cores", "gauge", "CPU usage of the node.", cpu)
+	w.series("node_memory_usage_bytes", "gauge", "Memory usage of the node.", memory)
+	w.series("node_cpu_allocatable_cores", "gauge", "Allocatable CPU of the node.", cpuAlloc)
+	w.series("node_memory_allocatable_bytes", "gauge", "Allocatable memory of the node.", memoryAlloc)
+}
+
+func podLabels(m types.PodMetric) []string {
+	return []string{
+		"namespace", m.Namespace,
+		"pod", m.Pod,
+		"workload_kind", m.WorkloadKind,
+		"workload_name", m.WorkloadName,
+		"node", m.Node,
+	}
+}
+
+func containerLabels(m types.PodMetric) []string {
+	return append(podLabels(m), "container", m.Container)
+}
+
+func cores(milli int64) float64 {
+	return float64(milli) / 1000
+}
+
+func bytes(mi int64) float64 {
+	return float64(mi) * mebibyte
+}
+
+func ratio(value, total int64) (float64, bool) {
+	if total <= 0 {
+		return 0, false
+	}
+	return float64(value) / float64(total), true
+}
+
+// writer renders metric families. Counters are declared without the _total
+// suffix in OpenMetrics, and the output ends with "# EOF".
+type writer struct {
+	w           *bufio.Writer
+	openMetrics bool
+}
+
+func (w *writer) family(name, kind, help string) {
+	family := namespace + "_" + name
+	if w.openMetrics && kind == "counter" {
+		family = strings.TrimSuffix(family, "_total")
+	}
+	fmt.Fprintf(w.w, "# HELP %s %s\n", family, help)
+	fmt.Fprintf(w.w, "# TYPE %s %s\n", family, kind)
+}
+
+func (w *writer) sample(name string, labels []string, value float64) {
+	w.w.WriteString(namespace + "_" + name)
+	if len(labels) > 0 {
+		w.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.w.WriteByte(',')
+			}
+			fmt.Fprintf(w.w, "%s=\"%s\"", labels[i], escape(labels[i+1]))
+		}
+		w.w.WriteByte('}')
+	}
+	w.w.WriteByte(' ')
+	w.w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.w.WriteByte('\n')
+}
+
+// series writes a family with its samples in a stable order; families
+// without samples are left out.
+func (w *writer) series(name, kind, help string, samples []series) {
+	if len(samples) == 0 {
+		return
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].labels, "\x00") < strings.Join(samples[j].labels, "\x00")
+	})
+	w.family(name, kind, help)
+	for _, s := range samples {
+		w.sample(name, s.labels, s.value)
+	}
+}
+
+func (w *writer) end() {
+	if w.openMetrics {
+		w.w.WriteString("# EOF\n")
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(v string) string {
+	return labelEscaper.Replace(v)
+}
@@ -0,0 +1,103 @@
+package exporter
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/collector"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+func scrape(t *testing.T, e *Exporter) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestFailedTickKeepsLastGoodSamples(t *testing.T) {
+	good := time.Unix(1700000000, 0)
+	e := New()
+	e.Observe(good, &collector.Tick{
+		Metrics: []types.PodMetric{{
+			Namespace: "prod", Pod: "web-1", Container: "app", Node: "node-1",
+			CPU: 250, Memory: 64, Status: types.StatusOK, HasCPU: true, HasMemory: true,
+		}},
+		Pods: 1, Success: 1,
+	}, time.Second, nil)
+
+	failed := &collector.Tick{
+		Metrics: []types.PodMetric{{Namespace: "prod", Pod: "web-1", Container: "app", Status: "ERROR"}},
+		Pods:    1, Errors: 1,
+	}
+	e.Observe(good.Add(time.Minute), failed, 3*time.Second, errors.New("metrics-server недоступен"))
+
+	body := scrape(t, e)
+	for _, want := range []string{
+		"k8s_monitor_ticks_total 2\n",
+		"k8s_monitor_collect_errors_total 1\n",
+		"k8s_monitor_pod_errors_total 0\n",
+		"k8s_monitor_scrape_duration_seconds 3\n",
+		"k8s_monitor_last_tick_timestamp_seconds 1.7e+09\n",
+		`k8s_monitor_container_cpu_usage_cores{namespace="prod",pod="web-1",workload_kind="",workload_name="",node="node-1",container="app"} 0.25`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("response lacks %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestNodeFailureKeepsPodSamples(t *testing.T) {
+	e := New()
+	e.Observe(time.Unix(1700000000, 0), &collector.Tick{
+		Metrics: []types.PodMetric{{Namespace: "prod", Pod: "web-1", Container: "app", CPU: 100, Memory: 64,
+			Status: types.StatusOK, HasCPU: true, HasMemory: true}},
+		Pods: 1, Success: 1,
+	}, time.Second, nil)
+
+	e.Observe(time.Unix(1700000060, 0), &collector.Tick{
+		Metrics: []types.PodMetric{{Namespace: "prod", Pod: "web-1", Container: "app", CPU: 300, Memory: 64,
+			Status: types.StatusOK, HasCPU: true, HasMemory: true}},
+		Nodes:    []types.NodeMetric{{Node: "node-1", CPUAllocatable: 2000, MemoryAllocatable: 4096}},
+		Pods:     1,
+		Success:  1,
+		NodesErr: errors.New("ошибка получения метрик узлов"),
+	}, time.Second, nil)
+
+	body := scrape(t, e)
+	for _, want := range []string{
+		"k8s_monitor_collect_errors_total 0\n",
+		"k8s_monitor_node_errors_total 1\n",
+		"k8s_monitor_last_tick_timestamp_seconds 1.70000006e+09\n",
+		`k8s_monitor_container_cpu_usage_cores{namespace="prod",pod="web-1",workload_kind="",workload_name="",node="",container="app"} 0.3`,
+		`k8s_monitor_node_cpu_allocatable_cores{node="node-1"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("response lacks %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "k8s_monitor_node_cpu_usage_cores") {
+		t.Errorf("node usage served without node metrics:\n%s", body)
+	}
+}
+
+func TestOpenMetricsFormat(t *testing.T) {
+	e := New()
+	e.Observe(time.Unix(1700000000, 0), &collector.Tick{}, time.Second, nil)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	e.ServeHTTP(rec, req)
+
+	body := rec.Body.String()
+	if got := rec.Header().Get("Content-Type"); got != contentTypeOpenMetrics {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if !strings.Contains(body, "# TYPE k8s_monitor_ticks counter\n") || !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("not an OpenMetrics response:\n%s", body)
+	}
+}
@@ -0,0 +1,173 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// podSpecPath is where the pod template spec lives in a workload of kind.
+func podSpecPath(kind string) []string {
+	switch kind {
+	case types.WorkloadPod:
+		return []string{"spec"}
+	case "CronJob":
+		return []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	default:
+		return []string{"spec", "template", "spec"}
+	}
+}
+
+// PatchObject builds a strategic-merge patch that sets CPU and memory
+// requests and limits of the given containers in the workload's pod template.
+// Other resources of the containers are left alone by the merge.
+func PatchObject(w types.Workload, containers map[string]types.ContainerResources) map[string]interface{} {
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	patches := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		c := containers[name]
+		patches = append(patches, map[string]interface{}{
+			"name": name,
+			"resources": map[string]interface{}{
+				"requests": resourceMap(c.Requests),
+				"limits":   resourceMap(c.Limits),
+			},
+		})
+	}
+
+	return WorkloadPatch(w, patches)
+}
+
+// WorkloadPatch wraps container entries into a strategic-merge patch of the
+// workload's pod template.
+func WorkloadPatch(w types.Workload, containers []interface{}) map[string]interface{} {
+	obj := map[string]interface{}{
+		"apiVersion": types.WorkloadAPIVersion(w.Kind),
+		"kind":       w.Kind,
+		"metadata": map[string]interface{}{
+			"name":      w.Name,
+			"namespace": w.Namespace,
+		},
+	}
+	node := obj
+	for _, key := range podSpecPath(w.Kind) {
+		next := map[string]interface{}{}
+		node[key] = next
+		node = next
+	}
+	node["containers"] = containers
+	return obj
+}
+
+// Patch renders PatchObject as YAML.
+func Patch(w types.Workload, containers map[string]types.ContainerResources) ([]byte, error) {
+	return yaml.Marshal(PatchObject(w, containers))
+}
+
+func resourceMap(c types.PodConfiguration) map[string]interface{} {
+	cpu, memory := CPUQuantity(c.CPU), MemoryQuantity(c.Memory)
+	return map[string]interface{}{
+		"cpu":    cpu.String(),
+		"memory": memory.String(),
+	}
+}
+
+func CPUQuantity(milli int64) resource.Quantity {
+	return *resource.NewMilliQuantity(milli, resource.DecimalSI)
+}
+
+func MemoryQuantity(mi int64) resource.Quantity {
+	return resource.MustParse(fmt.Sprintf("%dMi", mi))
+}
+
+// SetResources updates CPU and memory requests and limits of the given
+// containers in spec, keeping any other resources they declare.
+func SetResources(spec *corev1.PodSpec, containers map[string]types.ContainerResources) {
+	for i := range spec.Containers {
+		c, ok := containers[spec.Containers[i].Name]
+		if !ok {
+			continue
+		}
+		res := &spec.Containers[i].Resources
+		if res.Requests == nil {
+			res.Requests = corev1.ResourceList{}
+		}
+		if res.Limits == nil {
+			res.Limits = corev1.ResourceList{}
+		}
+		res.Requests[corev1.ResourceCPU] = CPUQuantity(c.Requests.CPU)
+		res.Requests[corev1.ResourceMemory] = MemoryQuantity(c.Requests.Memory)
+		res.Limits[corev1.ResourceCPU] = CPUQuantity(c.Limits.CPU)
+		res.Limits[corev1.ResourceMemory] = MemoryQuantity(c.Limits.Memory)
+	}
+}
+
+// Manifest renders a live object as a clean manifest: server-populated
+// metadata and status are dropped so the result can be committed and applied.
+func Manifest(obj runtime.Object) ([]byte, error) {
+	obj = obj.DeepCopyObject()
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	accessor.SetManagedFields(nil)
+	accessor.SetResourceVersion("")
+	accessor.SetUID("")
+	accessor.SetGeneration(0)
+	accessor.SetSelfLink("")
+	accessor.SetCreationTimestamp(metav1.Time{})
+	accessor.SetOwnerReferences(nil)
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	delete(m, "status")
+	if md, ok := m["metadata"].(map[string]interface{}); ok {
+		delete(md, "creationTimestamp")
+		if annotations, ok := md["annotations"].(map[string]interface{}); ok {
+			delete(annotations, corev1.LastAppliedConfigAnnotation)
+			if len(annotations) == 0 {
+				delete(md, "annotations")
+			}
+		}
+	}
+	return yaml.Marshal(m)
+}
+
+// Kustomization renders a kustomization.yaml that applies the given patch
+// files. Resources (the base) are left for the user to add.
+func Kustomization(patchFiles []string) ([]byte, error) {
+	patches := make([]interface{}, 0, len(patchFiles))
+	for _, file := range patchFiles {
+		patches = append(patches, map[string]interface{}{"path": file})
+	}
+	return yaml.Marshal(map[string]interface{}{
+		"apiVersion": "kustomize.config.k8s.io/v1beta1",
+		"kind":       "Kustomization",
+		"patches":    patches,
+	})
+}
+
+// FileName returns a file name for the workload: "<ns>-<kind>-<name>.yaml".
+func FileName(w types.Workload) string {
+	return fmt.Sprintf("%s-%s-%s.yaml", w.Namespace, strings.ToLower(w.Kind), w.Name)
+}
@@ -0,0 +1,121 @@
+package manifest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// VPA update modes, as in autoscaling.k8s.io/v1.
+const (
+	UpdateModeOff      = "Off"
+	UpdateModeInitial  = "Initial"
+	UpdateModeRecreate = "Recreate"
+	UpdateModeAuto     = "Auto"
+)
+
+// VerticalPodAutoscaler mirrors the fields of autoscaling.k8s.io/v1 that are
+// generated here, so the VPA module is not a dependency.
+type VerticalPodAutoscaler struct {
+	APIVersion string      `json:"apiVersion"`
+	Kind       string      `json:"kind"`
+	Metadata   VPAMetadata `json:"metadata"`
+	Spec       VPASpec     `json:"spec"`
+}
+
+type VPAMetadata struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type VPASpec struct {
+	TargetRef      VPATargetRef      `json:"targetRef"`
+	UpdatePolicy   VPAUpdatePolicy   `json:"updatePolicy"`
+	ResourcePolicy VPAResourcePolicy `json:"resourcePolicy"`
+}
+
+type VPATargetRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+}
+
+type VPAUpdatePolicy struct {
+	UpdateMode string `json:"updateMode"`
+}
+
+type VPAResourcePolicy struct {
+	ContainerPolicies []VPAContainerPolicy `json:"containerPolicies"`
+}
+
+type VPAContainerPolicy struct {
+	ContainerName string                 `json:"containerName"`
+	MinAllowed    map[string]interface{} `json:"minAllowed"`
+	MaxAllowed    map[string]interface{} `json:"maxAllowed"`
+}
+
+// ValidUpdateMode reports whether mode is a VPA update mode.
+func ValidUpdateMode(mode string) bool {
+	switch mode {
+	case UpdateModeOff, UpdateModeInitial, UpdateModeRecreate, UpdateModeAuto:
+		return true
+	}
+	return false
+}
+
+// NewVPA builds a VerticalPodAutoscaler for the workload whose per-container
+// bounds are seeded from the recommendations: minAllowed from the
+// recommended requests and maxAllowed from the recommended limits.
+func NewVPA(w types.Workload, containers map[string]types.ContainerResources, updateMode string) (*VerticalPodAutoscaler, error) {
+	if w.Kind == types.WorkloadPod {
+		return nil, fmt.Errorf("VPA не поддерживает отдельные поды")
+	}
+	if !ValidUpdateMode(updateMode) {
+		return nil, fmt.Errorf("неизвестный режим обновления VPA: %s", updateMode)
+	}
+
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	policies := make([]VPAContainerPolicy, 0, len(names))
+	for _, name := range names {
+		c := containers[name]
+		policies = append(policies, VPAContainerPolicy{
+			ContainerName: name,
+			MinAllowed:    resourceMap(c.Requests),
+			MaxAllowed:    resourceMap(c.Limits),
+		})
+	}
+
+	return &VerticalPodAutoscaler{
+		APIVersion: "autoscaling.k8s.io/v1",
+		Kind:       "VerticalPodAutoscaler",
+		Metadata:   VPAMetadata{Name: VPAName(w), Namespace: w.Namespace},
+		Spec: VPASpec{
+			TargetRef:      VPATargetRef{APIVersion: types.WorkloadAPIVersion(w.Kind), Kind: w.Kind, Name: w.Name},
+			UpdatePolicy:   VPAUpdatePolicy{UpdateMode: updateMode},
+			ResourcePolicy: VPAResourcePolicy{ContainerPolicies: policies},
+		},
+	}, nil
+}
+
+// VPAName names the VPA of a workload "<name>-<kind>", so that workloads of
+// different kinds with the same name get separate objects.
+func VPAName(w types.Workload) string {
+	return w.Name + "-" + strings.ToLower(w.Kind)
+}
+
+// VPA renders NewVPA as YAML.
+func VPA(w types.Workload, containers map[string]types.ContainerResources, updateMode string) ([]byte, error) {
+	vpa, err := NewVPA(w, containers, updateMode)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(vpa)
+}
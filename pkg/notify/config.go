@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/alert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// Receiver types.
+const (
+	TypeWebhook      = "webhook"
+	TypeAlertmanager = "alertmanager"
+	TypeSlack        = "slack"
+)
+
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultMaxRetries = 3
+	// Alertmanager resolves alerts that are not re-sent within its
+	// resolve_timeout (5m by default).
+	defaultAlertmanagerRepeat = time.Minute
+)
+
+// DefaultTemplate renders one alert as a line of text.
+const DefaultTemplate = `[{{upper .State}}] {{.Rule}} {{.Subject}}: {{printf "%.1f" .Value}} {{.Op}} {{.Threshold}}{{if .Summary}} — {{.Summary}}{{end}}`
+
+// Receiver is a notification target. Template is a Go text/template
+// executed for every alert; RepeatInterval re-sends firing alerts that long
+// after they were last sent (0 sends each transition once).
+type Receiver struct {
+	Name           string            `json:"name"`
+	Type           string            `json:"type"`
+	URL            string            `json:"url"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	Template       string            `json:"template,omitempty"`
+	Timeout        metav1.Duration   `json:"timeout,omitempty"`
+	MaxRetries     *int              `json:"maxRetries,omitempty"`
+	RepeatInterval metav1.Duration   `json:"repeatInterval,omitempty"`
+
+	template *template.Template
+}
+
+// Route sends the alerts matching all of its conditions to Receiver. Routes
+// are tried in order and the first match wins unless it sets Continue.
+type Route struct {
+	Receiver   string   `json:"receiver"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	Selector   string   `json:"selector,omitempty"`
+	Continue   bool     `json:"continue,omitempty"`
+
+	selector labels.Selector
+}
+
+// Config is a notification file. Alerts no route matches go to
+// DefaultReceiver, if set.
+type Config struct {
+	Receivers       []Receiver `json:"receivers"`
+	Routes          []Route    `json:"routes,omitempty"`
+	DefaultReceiver string     `json:"defaultReceiver,omitempty"`
+}
+
+// Load reads a notification config from a YAML or JSON file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла уведомлений: %v", err)
+	}
+
+	var c Config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("ошибка разбора файла уведомлений %s: %v", path, err)
+	}
+	if err := c.prepare(); err != nil {
+		return nil, fmt.Errorf("файл уведомлений %s: %v", path, err)
+	}
+	return &c, nil
+}
+
+func (c *Config) prepare() error {
+	names := make(map[string]bool, len(c.Receivers))
+	for i := range c.Receivers {
+		r := &c.Receivers[i]
+		if r.Name == "" || names[r.Name] {
+			return fmt.Errorf("получатель %d: пустое или повторяющееся имя %q", i+1, r.Name)
+		}
+		names[r.Name] = true
+
+		switch r.Type {
+		case TypeWebhook, TypeSlack:
+		case TypeAlertmanager:
+			if r.RepeatInterval.Duration == 0 {
+				r.RepeatInterval.Duration = defaultAlertmanagerRepeat
+			}
+		default:
+			return fmt.Errorf("получатель %s: неизвестный тип %q (допустимы webhook, alertmanager, slack)", r.Name, r.Type)
+		}
+		if r.URL == "" {
+			return fmt.Errorf("получатель %s: не задан url", r.Name)
+		}
+		if r.Timeout.Duration <= 0 {
+			r.Timeout.Duration = defaultTimeout
+		}
+		if r.MaxRetries == nil {
+			retries := defaultMaxRetries
+			r.MaxRetries = &retries
+		}
+		if r.Template == "" {
+			r.Template = DefaultTemplate
+		}
+
+		var err error
+		r.template, err = template.New(r.Name).Funcs(templateFuncs).Parse(r.Template)
+		if err != nil {
+			return fmt.Errorf("получатель %s: ошибка шаблона: %v", r.Name, err)
+		}
+	}
+
+	if c.DefaultReceiver != "" && !names[c.DefaultReceiver] {
+		return fmt.Errorf("defaultReceiver: нет получателя %q", c.DefaultReceiver)
+	}
+	for i := range c.Routes {
+		route := &c.Routes[i]
+		if !names[route.Receiver] {
+			return fmt.Errorf("маршрут %d: нет получателя %q", i+1, route.Receiver)
+		}
+		var err error
+		if route.selector, err = labels.Parse(route.Selector); err != nil {
+			return fmt.Errorf("маршрут %d: selector: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// receivers returns the names of the receivers an alert is routed to.
+func (c *Config) receivers(a alert.Alert) []string {
+	var result []string
+	for i := range c.Routes {
+		route := &c.Routes[i]
+		if len(route.Namespaces) > 0 && !contains(route.Namespaces, a.Labels["namespace"]) {
+			continue
+		}
+		if !route.selector.Matches(labels.Set(a.Labels)) {
+			continue
+		}
+		if !contains(result, route.Receiver) {
+			result = append(result, route.Receiver)
+		}
+		if !route.Continue {
+			return result
+		}
+	}
+	if len(result) == 0 && c.DefaultReceiver != "" {
+		result = append(result, c.DefaultReceiver)
+	}
+	return result
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/alert"
+)
+
+const (
+	queueSize  = 100
+	maxBackoff = 30 * time.Second
+)
+
+// Dispatcher routes alerts to receivers and sends them from a background
+// goroutine, so a slow or unavailable receiver does not hold up the monitor
+// loop. Failed requests are retried with exponential backoff.
+type Dispatcher struct {
+	config  *Config
+	client  *http.Client
+	backoff time.Duration
+
+	queue  chan delivery
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// sent holds, per receiver, when each firing alert was last sent.
+	sent map[string]map[string]time.Time
+}
+
+type delivery struct {
+	receiver *Receiver
+	alerts   []alert.Alert
+}
+
+func NewDispatcher(c *Config) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		config:  c,
+		client:  &http.Client{},
+		backoff: time.Second,
+		queue:   make(chan delivery, queueSize),
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+		sent:    make(map[string]map[string]time.Time),
+	}
+	go d.run()
+	return d
+}
+
+// Notify queues the alerts that changed state for their receivers, and
+// re-sends active firing alerts to receivers with a RepeatInterval. Pending
+// alerts are not sent.
+func (d *Dispatcher) Notify(now time.Time, changed, active []alert.Alert) {
+	batches := make(map[string][]alert.Alert)
+	add := func(name string, a alert.Alert) {
+		batches[name] = append(batches[name], a)
+		if d.sent[name] == nil {
+			d.sent[name] = make(map[string]time.Time)
+		}
+		if a.State == alert.StateResolved {
+			delete(d.sent[name], a.Key())
+		} else {
+			d.sent[name][a.Key()] = now
+		}
+	}
+
+	for _, a := range changed {
+		if a.State == alert.StatePending {
+			continue
+		}
+		for _, name := range d.config.receivers(a) {
+			add(name, a)
+		}
+	}
+	for _, a := range active {
+		if a.State != alert.StateFiring {
+			continue
+		}
+		for _, name := range d.config.receivers(a) {
+			last, ok := d.sent[name][a.Key()]
+			repeat := d.receiver(name).RepeatInterval.Duration
+			if ok && repeat > 0 && now.Sub(last) >= repeat {
+				add(name, a)
+			}
+		}
+	}
+
+	for i := range d.config.Receivers {
+		r := &d.config.Receivers[i]
+		if alerts := batches[r.Name]; len(alerts) > 0 {
+			select {
+			case d.queue <- delivery{receiver: r, alerts: alerts}:
+			default:
+				fmt.Printf("Очередь уведомлений переполнена, пропущено для %s: %d алертов\n", r.Name, len(alerts))
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) receiver(name string) *Receiver {
+	for i := range d.config.Receivers {
+		if d.config.Receivers[i].Name == name {
+			return &d.config.Receivers[i]
+		}
+	}
+	return nil
+}
+
+// Close sends what is queued and stops the dispatcher. Deliveries still
+// pending when ctx is done are abandoned.
+func (d *Dispatcher) Close(ctx context.Context) {
+	close(d.queue)
+	select {
+	case <-d.done:
+	case <-ctx.Done():
+		d.cancel()
+		<-d.done
+	}
+	d.cancel()
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	for delivery := range d.queue {
+		if err := d.deliver(delivery); err != nil {
+			fmt.Printf("Ошибка отправки уведомления %s: %v\n", delivery.receiver.Name, err)
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(delivery delivery) error {
+	r := delivery.receiver
+	body, err := r.payload(delivery.alerts)
+	if err != nil {
+		return err
+	}
+
+	backoff := d.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := d.post(r, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= *r.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-d.ctx.Done():
+			return err
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// post sends one request. Network errors, 5xx, 408 and 429 are worth
+// retrying; other failures are not.
+func (d *Dispatcher) post(r *Receiver, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, r.Timeout.Duration)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint(), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("%s ответил %s", r.endpoint(), resp.Status)
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusRequestTimeout
+	return retry, err
+}
@@ -0,0 +1,366 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/alert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// recorder is a receiver endpoint that answers with the queued status codes
+// (200 once they run out) and keeps the request bodies.
+type recorder struct {
+	mu       sync.Mutex
+	statuses []int
+	paths    []string
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paths = append(r.paths, req.URL.Path)
+	r.bodies = append(r.bodies, body)
+	r.headers = append(r.headers, req.Header.Clone())
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *recorder) requests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.bodies)
+}
+
+func newRecorder(t *testing.T, statuses ...int) (*recorder, string) {
+	t.Helper()
+	rec := &recorder{statuses: statuses}
+	server := httptest.NewServer(rec)
+	t.Cleanup(server.Close)
+	return rec, server.URL
+}
+
+func testConfig(t *testing.T, c *Config) *Config {
+	t.Helper()
+	if err := c.prepare(); err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	return c
+}
+
+// dispatch sends one Notify call through a dispatcher with a short backoff
+// and waits for the deliveries.
+func dispatch(t *testing.T, c *Config, calls func(d *Dispatcher)) {
+	t.Helper()
+	d := NewDispatcher(c)
+	d.backoff = time.Millisecond
+	calls(d)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	d.Close(ctx)
+}
+
+var (
+	activeAt   = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	resolvedAt = activeAt.Add(5 * time.Minute)
+)
+
+func testAlert(state alert.State, namespace string) alert.Alert {
+	a := alert.Alert{
+		Rule:      "HighCPU",
+		Severity:  "critical",
+		Summary:   "CPU выше порога",
+		Labels:    map[string]string{"alertname": "HighCPU", "severity": "critical", "namespace": namespace, "pod": "web-1"},
+		Value:     912.5,
+		Op:        ">",
+		Threshold: 800,
+		State:     state,
+		ActiveAt:  activeAt,
+	}
+	if state == alert.StateResolved {
+		a.ResolvedAt = resolvedAt
+	}
+	return a
+}
+
+func TestPayloads(t *testing.T) {
+	t.Run("webhook", func(t *testing.T) {
+		rec, url := newRecorder(t)
+		c := testConfig(t, &Config{
+			Receivers:       []Receiver{{Name: "hook", Type: TypeWebhook, URL: url + "/hook", Headers: map[string]string{"Authorization": "Bearer x"}}},
+			DefaultReceiver: "hook",
+		})
+		dispatch(t, c, func(d *Dispatcher) {
+			d.Notify(activeAt, []alert.Alert{testAlert(alert.StateFiring, "prod"), testAlert(alert.StateResolved, "dev")}, nil)
+		})
+
+		if rec.requests() != 1 {
+			t.Fatalf("requests = %d, want one batch", rec.requests())
+		}
+		if rec.paths[0] != "/hook" || rec.headers[0].Get("Authorization") != "Bearer x" ||
+			rec.headers[0].Get("Content-Type") != "application/json" {
+			t.Errorf("request %s with headers %v", rec.paths[0], rec.headers[0])
+		}
+		var body webhookPayload
+		if err := json.Unmarshal(rec.bodies[0], &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Version != payloadVersion || body.Receiver != "hook" || body.Status != "firing" || len(body.Alerts) != 2 {
+			t.Fatalf("payload = %s", rec.bodies[0])
+		}
+		firing, resolved := body.Alerts[0], body.Alerts[1]
+		if firing.Status != "firing" || firing.Value != 912.5 || firing.Threshold != 800 || firing.EndsAt != nil ||
+			!firing.StartsAt.Equal(activeAt) || firing.Annotations["summary"] != "CPU выше порога" {
+			t.Errorf("firing alert = %+v", firing)
+		}
+		if want := "[FIRING] HighCPU prod/web-1: 912.5 > 800 — CPU выше порога"; firing.Message != want {
+			t.Errorf("message = %q, want %q", firing.Message, want)
+		}
+		if resolved.Status != "resolved" || resolved.EndsAt == nil || !resolved.EndsAt.Equal(resolvedAt) {
+			t.Errorf("resolved alert = %+v", resolved)
+		}
+	})
+
+	t.Run("alertmanager", func(t *testing.T) {
+		rec, url := newRecorder(t)
+		c := testConfig(t, &Config{
+			Receivers:       []Receiver{{Name: "am", Type: TypeAlertmanager, URL: url + "/"}},
+			DefaultReceiver: "am",
+		})
+		dispatch(t, c, func(d *Dispatcher) {
+			d.Notify(activeAt, []alert.Alert{testAlert(alert.StateResolved, "prod")}, nil)
+		})
+
+		if rec.requests() != 1 || rec.paths[0] != "/api/v2/alerts" {
+			t.Fatalf("paths = %v, want /api/v2/alerts", rec.paths)
+		}
+		var body []postableAlert
+		if err := json.Unmarshal(rec.bodies[0], &body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body) != 1 {
+			t.Fatalf("payload = %s", rec.bodies[0])
+		}
+		a := body[0]
+		if a.Labels["alertname"] != "HighCPU" || a.Labels["namespace"] != "prod" || !a.StartsAt.Equal(activeAt) ||
+			a.EndsAt == nil || !a.EndsAt.Equal(resolvedAt) || a.Annotations["value"] != "912.5" ||
+			!strings.HasPrefix(a.Annotations["description"], "[RESOLVED] HighCPU") {
+			t.Errorf("alert = %s", rec.bodies[0])
+		}
+	})
+
+	t.Run("slack", func(t *testing.T) {
+		rec, url := newRecorder(t)
+		c := testConfig(t, &Config{
+			Receivers:       []Receiver{{Name: "chat", Type: TypeSlack, URL: url, Template: "{{lower .State}} {{.Subject}}"}},
+			DefaultReceiver: "chat",
+		})
+		dispatch(t, c, func(d *Dispatcher) {
+			d.Notify(activeAt, []alert.Alert{testAlert(alert.StateFiring, "prod"), testAlert(alert.StateResolved, "dev")}, nil)
+		})
+
+		var body slackPayload
+		if rec.requests() != 1 {
+			t.Fatalf("requests = %d, want 1", rec.requests())
+		}
+		if err := json.Unmarshal(rec.bodies[0], &body); err != nil {
+			t.Fatal(err)
+		}
+		if want := "firing prod/web-1\nresolved dev/web-1"; body.Text != want {
+			t.Errorf("text = %q, want %q", body.Text, want)
+		}
+	})
+}
+
+func TestRetries(t *testing.T) {
+	zero, one := 0, 1
+	tests := []struct {
+		name       string
+		statuses   []int
+		maxRetries *int
+		requests   int
+	}{
+		{name: "5xx is retried until success", statuses: []int{503, 500}, requests: 3},
+		{name: "429 is retried", statuses: []int{429}, requests: 2},
+		{name: "retries are bounded", statuses: []int{502, 502, 502, 502, 502}, maxRetries: &one, requests: 2},
+		{name: "maxRetries 0 sends once", statuses: []int{500}, maxRetries: &zero, requests: 1},
+		{name: "4xx is not retried", statuses: []int{400}, requests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, url := newRecorder(t, tt.statuses...)
+			c := testConfig(t, &Config{
+				Receivers:       []Receiver{{Name: "hook", Type: TypeWebhook, URL: url, MaxRetries: tt.maxRetries}},
+				DefaultReceiver: "hook",
+			})
+			dispatch(t, c, func(d *Dispatcher) {
+				d.Notify(activeAt, []alert.Alert{testAlert(alert.StateFiring, "prod")}, nil)
+			})
+			if rec.requests() != tt.requests {
+				t.Errorf("requests = %d, want %d", rec.requests(), tt.requests)
+			}
+		})
+	}
+}
+
+func TestBackoffGrowsAndIsCancelledByClose(t *testing.T) {
+	rec, url := newRecorder(t, 500, 500, 500, 500)
+	c := testConfig(t, &Config{
+		Receivers:       []Receiver{{Name: "hook", Type: TypeWebhook, URL: url}},
+		DefaultReceiver: "hook",
+	})
+	d := NewDispatcher(c)
+	d.backoff = 50 * time.Millisecond
+	d.Notify(activeAt, []alert.Alert{testAlert(alert.StateFiring, "prod")}, nil)
+
+	// Attempts go out at 0, 50ms and 150ms; the next one would wait 200ms
+	// more, so closing with a short deadline abandons it.
+	time.Sleep(250 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	d.Close(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close took %v, want it to stop waiting for the backoff", elapsed)
+	}
+	if rec.requests() != 3 {
+		t.Errorf("requests = %d, want 3 before Close", rec.requests())
+	}
+}
+
+func TestRouting(t *testing.T) {
+	c := testConfig(t, &Config{
+		Receivers: []Receiver{
+			{Name: "oncall", Type: TypeWebhook, URL: "http://oncall"},
+			{Name: "team", Type: TypeSlack, URL: "http://team"},
+			{Name: "audit", Type: TypeWebhook, URL: "http://audit"},
+			{Name: "default", Type: TypeWebhook, URL: "http://default"},
+		},
+		Routes: []Route{
+			{Receiver: "audit", Selector: "severity=critical", Continue: true},
+			{Receiver: "oncall", Namespaces: []string{"prod"}, Selector: "severity=critical"},
+			{Receiver: "team", Namespaces: []string{"prod", "staging"}},
+		},
+		DefaultReceiver: "default",
+	})
+
+	tests := []struct {
+		name      string
+		namespace string
+		severity  string
+		want      []string
+	}{
+		{"critical in prod stops at the first non-continue route", "prod", "critical", []string{"audit", "oncall"}},
+		{"warning in prod", "prod", "warning", []string{"team"}},
+		{"critical in staging continues to the namespace route", "staging", "critical", []string{"audit", "team"}},
+		{"unmatched goes to the default receiver", "dev", "warning", []string{"default"}},
+		{"continue-only match does not fall back to default", "dev", "critical", []string{"audit"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAlert(alert.StateFiring, tt.namespace)
+			a.Labels["severity"] = tt.severity
+			if got := c.receivers(a); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("receivers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutedDelivery(t *testing.T) {
+	prod, prodURL := newRecorder(t)
+	rest, restURL := newRecorder(t)
+	c := testConfig(t, &Config{
+		Receivers: []Receiver{
+			{Name: "prod", Type: TypeWebhook, URL: prodURL},
+			{Name: "rest", Type: TypeWebhook, URL: restURL},
+		},
+		Routes:          []Route{{Receiver: "prod", Namespaces: []string{"prod"}}},
+		DefaultReceiver: "rest",
+	})
+	dispatch(t, c, func(d *Dispatcher) {
+		d.Notify(activeAt, []alert.Alert{
+			testAlert(alert.StateFiring, "prod"),
+			testAlert(alert.StateFiring, "dev"),
+			testAlert(alert.StatePending, "prod"),
+		}, nil)
+	})
+
+	for _, tt := range []struct {
+		rec       *recorder
+		namespace string
+	}{{prod, "prod"}, {rest, "dev"}} {
+		if tt.rec.requests() != 1 {
+			t.Fatalf("%s: requests = %d, want 1", tt.namespace, tt.rec.requests())
+		}
+		var body webhookPayload
+		if err := json.Unmarshal(tt.rec.bodies[0], &body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.Alerts) != 1 || body.Alerts[0].Labels["namespace"] != tt.namespace {
+			t.Errorf("%s receiver got %s", tt.namespace, tt.rec.bodies[0])
+		}
+	}
+}
+
+func TestRepeatInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		receiver Receiver
+		requests int
+	}{
+		// Ticks at 0, 30s, 60s, 90s and 120s: resent at 60s and 120s.
+		{"repeatInterval resends firing alerts", Receiver{Type: TypeWebhook, RepeatInterval: metav1.Duration{Duration: time.Minute}}, 3},
+		{"no repeatInterval sends once", Receiver{Type: TypeWebhook}, 1},
+		{"alertmanager repeats every minute by default", Receiver{Type: TypeAlertmanager}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, url := newRecorder(t)
+			r := tt.receiver
+			r.Name, r.URL = "r", url
+			c := testConfig(t, &Config{Receivers: []Receiver{r}, DefaultReceiver: "r"})
+
+			firing := testAlert(alert.StateFiring, "prod")
+			dispatch(t, c, func(d *Dispatcher) {
+				d.Notify(activeAt, []alert.Alert{firing}, []alert.Alert{firing})
+				for i := 1; i <= 4; i++ {
+					d.Notify(activeAt.Add(time.Duration(i)*30*time.Second), nil, []alert.Alert{firing})
+				}
+			})
+			if rec.requests() != tt.requests {
+				t.Errorf("requests = %d, want %d", rec.requests(), tt.requests)
+			}
+		})
+	}
+}
+
+func TestResolvedAlertIsNotRepeated(t *testing.T) {
+	rec, url := newRecorder(t)
+	c := testConfig(t, &Config{
+		Receivers:       []Receiver{{Name: "r", Type: TypeWebhook, URL: url, RepeatInterval: metav1.Duration{Duration: time.Minute}}},
+		DefaultReceiver: "r",
+	})
+	firing := testAlert(alert.StateFiring, "prod")
+	dispatch(t, c, func(d *Dispatcher) {
+		d.Notify(activeAt, []alert.Alert{firing}, []alert.Alert{firing})
+		d.Notify(activeAt.Add(time.Minute), []alert.Alert{testAlert(alert.StateResolved, "prod")}, nil)
+		d.Notify(activeAt.Add(3*time.Minute), nil, nil)
+	})
+	if rec.requests() != 2 {
+		t.Errorf("requests = %d, want firing and resolved only", rec.requests())
+	}
+}
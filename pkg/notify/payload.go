@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/alert"
+)
+
+var templateFuncs = template.FuncMap{
+	"upper": func(v interface{}) string { return strings.ToUpper(fmt.Sprint(v)) },
+	"lower": func(v interface{}) string { return strings.ToLower(fmt.Sprint(v)) },
+}
+
+const payloadVersion = "1"
+
+type webhookAlert struct {
+	Status      string            `json:"status"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Value       float64           `json:"value"`
+	Op          string            `json:"op"`
+	Threshold   float64           `json:"threshold"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      *time.Time        `json:"endsAt,omitempty"`
+	Message     string            `json:"message"`
+}
+
+type webhookPayload struct {
+	Version  string         `json:"version"`
+	Receiver string         `json:"receiver"`
+	Status   string         `json:"status"`
+	Alerts   []webhookAlert `json:"alerts"`
+}
+
+// postableAlert is an alert in the Alertmanager /api/v2/alerts format.
+type postableAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      *time.Time        `json:"endsAt,omitempty"`
+}
+
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+// payload renders the request body for the receiver.
+func (r *Receiver) payload(alerts []alert.Alert) ([]byte, error) {
+	messages := make([]string, 0, len(alerts))
+	for _, a := range alerts {
+		var buf bytes.Buffer
+		if err := r.template.Execute(&buf, a); err != nil {
+			return nil, fmt.Errorf("ошибка шаблона: %v", err)
+		}
+		messages = append(messages, buf.String())
+	}
+
+	switch r.Type {
+	case TypeSlack:
+		return json.Marshal(slackPayload{Text: strings.Join(messages, "\n")})
+
+	case TypeAlertmanager:
+		body := make([]postableAlert, 0, len(alerts))
+		for i, a := range alerts {
+			body = append(body, postableAlert{
+				Labels:      a.Labels,
+				Annotations: annotations(a, messages[i]),
+				StartsAt:    a.ActiveAt,
+				EndsAt:      endsAt(a),
+			})
+		}
+		return json.Marshal(body)
+
+	default:
+		body := webhookPayload{Version: payloadVersion, Receiver: r.Name, Status: string(alert.StateResolved)}
+		for i, a := range alerts {
+			if a.State == alert.StateFiring {
+				body.Status = string(alert.StateFiring)
+			}
+			body.Alerts = append(body.Alerts, webhookAlert{
+				Status:      string(a.State),
+				Labels:      a.Labels,
+				Annotations: annotations(a, ""),
+				Value:       a.Value,
+				Op:          a.Op,
+				Threshold:   a.Threshold,
+				StartsAt:    a.ActiveAt,
+				EndsAt:      endsAt(a),
+				Message:     messages[i],
+			})
+		}
+		return json.Marshal(body)
+	}
+}
+
+func annotations(a alert.Alert, description string) map[string]string {
+	result := make(map[string]string)
+	if a.Summary != "" {
+		result["summary"] = a.Summary
+	}
+	if description != "" {
+		result["description"] = description
+	}
+	result["value"] = fmt.Sprintf("%.1f", a.Value)
+	return result
+}
+
+func endsAt(a alert.Alert) *time.Time {
+	if a.State != alert.StateResolved {
+		return nil
+	}
+	t := a.ResolvedAt
+	return &t
+}
+
+// endpoint is where the receiver's payload is posted.
+func (r *Receiver) endpoint() string {
+	if r.Type == TypeAlertmanager && !strings.HasSuffix(r.URL, "/api/v2/alerts") {
+		return strings.TrimSuffix(r.URL, "/") + "/api/v2/alerts"
+	}
+	return r.URL
+}
@@ -0,0 +1,115 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// APIVersion versions the JSON/YAML documents. Fields are only added within
+// a version; renaming or removing one requires a new version.
+const APIVersion = "k8s-monitor/v1"
+
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+	FormatCSV   = "csv"
+)
+
+// Result is the typed outcome of an analysis command.
+type Result interface {
+	// Kind names the result type in documents, e.g. "CostReport".
+	Kind() string
+	// WriteTable renders the human-readable report.
+	WriteTable(w io.Writer) error
+	// Records flattens the main table of the result for CSV, header first.
+	Records() [][]string
+}
+
+// Document is the envelope of JSON and YAML output.
+type Document struct {
+	APIVersion  string    `json:"apiVersion"`
+	Kind        string    `json:"kind"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Result      Result    `json:"result"`
+}
+
+// Renderer writes a result in one format.
+type Renderer func(w io.Writer, r Result) error
+
+var renderers = map[string]Renderer{
+	FormatTable: func(w io.Writer, r Result) error { return r.WriteTable(w) },
+	FormatJSON:  renderJSON,
+	FormatYAML:  renderYAML,
+	FormatCSV:   renderCSV,
+}
+
+// Register adds or replaces the renderer of a format.
+func Register(format string, r Renderer) {
+	renderers[format] = r
+}
+
+// Formats lists the registered formats.
+func Formats() []string {
+	formats := make([]string, 0, len(renderers))
+	for format := range renderers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Validate checks that format has a renderer.
+func Validate(format string) error {
+	if _, ok := renderers[format]; !ok {
+		return fmt.Errorf("неизвестный формат вывода %q (допустимы %s)", format, strings.Join(Formats(), ", "))
+	}
+	return nil
+}
+
+// Render writes r in the given format.
+func Render(w io.Writer, format string, r Result) error {
+	if err := Validate(format); err != nil {
+		return err
+	}
+	return renderers[format](w, r)
+}
+
+// IsTable reports whether format is meant for people rather than programs.
+func IsTable(format string) bool {
+	return format == FormatTable
+}
+
+func document(r Result) Document {
+	return Document{APIVersion: APIVersion, Kind: r.Kind(), GeneratedAt: time.Now().UTC(), Result: r}
+}
+
+func renderJSON(w io.Writer, r Result) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(document(r))
+}
+
+func renderYAML(w io.Writer, r Result) error {
+	data, err := yaml.Marshal(document(r))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func renderCSV(w io.Writer, r Result) error {
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(r.Records()); err != nil {
+		return fmt.Errorf("ошибка записи в CSV: %v", err)
+	}
+	return nil
+}
@@ -2,6 +2,9 @@ package parser
 
 import (
 	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -11,6 +14,69 @@ import (
 	"github.com/nightness333/k8s-monitor/pkg/types"
 )
 
+// Options controls how ParseCSVFile treats malformed rows. In strict mode the
+// first invalid row aborts parsing; otherwise it is skipped and reported in
+// the Summary.
+type Options struct {
+	Strict bool
+}
+
+// Issue is a skipped row. File is set when a scan reads several files.
+type Issue struct {
+	File   string
+	Line   int
+	Reason string
+}
+
+func (i Issue) String() string {
+	if i.File != "" {
+		return fmt.Sprintf("%s, строка %d: %s", i.File, i.Line, i.Reason)
+	}
+	return fmt.Sprintf("строка %d: %s", i.Line, i.Reason)
+}
+
+// Summary describes what was read: Rows counts data rows, Missing the rows
+// without measured usage (N/A, ERROR, SKIP) and Issues the skipped rows.
+type Summary struct {
+	Rows    int
+	Parsed  int
+	Missing int
+	Issues  []Issue
+}
+
+func (s *Summary) Skipped() int {
+	return len(s.Issues)
+}
+
+const (
+	colTimestamp = "timestamp"
+	colNamespace = "namespace"
+	colPod       = "pod"
+	colContainer = "container"
+	colCPU       = "cpu"
+	colMemory    = "memory"
+	colStatus    = "status"
+	colKind      = "workloadkind"
+	colWorkload  = "workloadname"
+	colNode      = "node"
+	colLabels    = "labels"
+
+	colCPURequest    = "cpurequest"
+	colCPULimit      = "cpulimit"
+	colMemoryRequest = "memoryrequest"
+	colMemoryLimit   = "memorylimit"
+)
+
+var requiredColumns = []string{colTimestamp, colNamespace, colPod, colCPU, colMemory}
+
+// Column layouts of files written without a header, by field count.
+var legacyLayouts = map[int][]string{
+	6: {colTimestamp, colNamespace, colPod, colCPU, colMemory, colStatus},
+	7: {colTimestamp, colNamespace, colPod, colContainer, colCPU, colMemory, colStatus},
+	9: {colTimestamp, colNamespace, colPod, colContainer, colCPU, colMemory, colStatus, colKind, colWorkload},
+}
+
+// ParseCSV reads the whole file in lenient mode.
 func ParseCSV(filePath string) ([]types.PodMetric, error) {
 	file, err := os.Open(filepath.Clean(filePath))
 	if err != nil {
@@ -18,31 +84,242 @@ func ParseCSV(filePath string) ([]types.PodMetric, error) {
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	metrics, _, err := Parse(file, Options{})
+	return metrics, err
+}
+
+// StreamCSVFile calls fn for every valid row of the file without keeping
+// the rows in memory.
+func StreamCSVFile(filePath string, opts Options, fn func(types.PodMetric) error) (*Summary, error) {
+	file, err := os.Open(filepath.Clean(filePath))
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
+
+	return Stream(file, opts, fn)
+}
 
+// Parse reads all metric rows from r into memory.
+func Parse(r io.Reader, opts Options) ([]types.PodMetric, *Summary, error) {
 	var metrics []types.PodMetric
-	for i, record := range records {
-		if i == 0 {
+	summary, err := Stream(r, opts, func(m types.PodMetric) error {
+		metrics = append(metrics, m)
+		return nil
+	})
+	if err != nil {
+		return nil, summary, err
+	}
+	return metrics, summary, nil
+}
+
+// Stream reads metric rows from r and passes each valid one to fn; an error
+// returned by fn stops reading. Columns are mapped by the header row when
+// present; files without a header are read by their legacy positional layout.
+// Every row must have as many fields as the header (or the first row of a
+// headerless file): a row of another width was written under a different
+// schema and cannot be mapped reliably.
+func Stream(r io.Reader, opts Options, fn func(types.PodMetric) error) (*Summary, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	summary := &Summary{}
+	var columns map[string]int
+	var width int
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return summary, err
+			}
+			if err := summary.fail(opts, parseErr.Line, parseErr.Err.Error()); err != nil {
+				return summary, err
+			}
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		if columns == nil {
+			if isHeader(record) {
+				columns, err = headerColumns(record, requiredColumns)
+				if err != nil {
+					return summary, fmt.Errorf("строка %d: %v", line, err)
+				}
+				width = len(record)
+				continue
+			}
+			columns = legacyColumns(len(record))
+			if columns == nil {
+				return summary, fmt.Errorf("строка %d: нет заголовка и неизвестный формат из %d колонок", line, len(record))
+			}
+			width = len(record)
+		}
+
+		summary.Rows++
+		if err := checkWidth(record, width); err != nil {
+			if err := summary.fail(opts, line, err.Error()); err != nil {
+				return summary, err
+			}
+			continue
+		}
+		m, err := parseRecord(record, columns)
+		if err != nil {
+			if err := summary.fail(opts, line, err.Error()); err != nil {
+				return summary, err
+			}
 			continue
 		}
 
-		timestamp, _ := time.Parse(time.RFC3339, record[0])
-		cpu, _ := strconv.ParseInt(strings.TrimSuffix(record[3], "m"), 10, 64)
-		mem, _ := strconv.ParseInt(strings.TrimSuffix(record[4], "Mi"), 10, 64)
+		// Pod lifecycle events are not usage samples.
+		if strings.HasPrefix(m.Status, types.EventPrefix) {
+			summary.Rows--
+			continue
+		}
 
-		metrics = append(metrics, types.PodMetric{
-			Timestamp: timestamp,
-			Namespace: record[1],
-			Pod:       record[2],
-			CPU:       cpu,
-			Memory:    mem,
-			Status:    record[5],
-		})
+		summary.Parsed++
+		if !m.HasUsage() {
+			summary.Missing++
+		}
+		if err := fn(m); err != nil {
+			return summary, err
+		}
 	}
 
-	return metrics, nil
+	return summary, nil
+}
+
+func (s *Summary) fail(opts Options, line int, reason string) error {
+	issue := Issue{Line: line, Reason: reason}
+	if opts.Strict {
+		return errors.New(issue.String())
+	}
+	s.Issues = append(s.Issues, issue)
+	return nil
+}
+
+func isHeader(record []string) bool {
+	for _, field := range record {
+		if strings.EqualFold(strings.TrimSpace(field), colTimestamp) {
+			return true
+		}
+	}
+	return false
+}
+
+func headerColumns(record []string, required []string) (map[string]int, error) {
+	columns := make(map[string]int, len(record))
+	for i, field := range record {
+		columns[strings.ToLower(strings.TrimSpace(field))] = i
+	}
+	for _, name := range required {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("в заголовке нет колонки %q", name)
+		}
+	}
+	return columns, nil
+}
+
+func legacyColumns(fields int) map[string]int {
+	layout, ok := legacyLayouts[fields]
+	if !ok {
+		return nil
+	}
+	columns := make(map[string]int, len(layout))
+	for i, name := range layout {
+		columns[name] = i
+	}
+	return columns
+}
+
+// checkWidth rejects rows whose field count differs from the header.
+func checkWidth(record []string, width int) error {
+	if len(record) != width {
+		return fmt.Errorf("ожидалось %d колонок, получено %d", width, len(record))
+	}
+	return nil
+}
+
+func parseRecord(record []string, columns map[string]int) (types.PodMetric, error) {
+	get := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, get(colTimestamp))
+	if err != nil {
+		return types.PodMetric{}, fmt.Errorf("неверное время %q", get(colTimestamp))
+	}
+
+	m := types.PodMetric{
+		Timestamp:    timestamp,
+		Namespace:    get(colNamespace),
+		Pod:          get(colPod),
+		Container:    get(colContainer),
+		Status:       get(colStatus),
+		WorkloadKind: get(colKind),
+		WorkloadName: get(colWorkload),
+		Node:         get(colNode),
+	}
+	if m.Namespace == "" || m.Pod == "" {
+		return types.PodMetric{}, fmt.Errorf("пустой namespace или имя пода")
+	}
+	if m.Status == "" {
+		m.Status = types.StatusOK
+	}
+	m.Labels, err = types.ParseLabels(get(colLabels))
+	if err != nil {
+		return types.PodMetric{}, err
+	}
+
+	// Unset requests and limits are stored empty and read as zero. Rows
+	// without usage carry the resources of the whole pod.
+	for _, r := range []struct {
+		column, suffix string
+		value          *int64
+	}{
+		{colCPURequest, "m", &m.CPURequest},
+		{colCPULimit, "m", &m.CPULimit},
+		{colMemoryRequest, "Mi", &m.MemoryRequest},
+		{colMemoryLimit, "Mi", &m.MemoryLimit},
+	} {
+		if *r.value, _, err = parseQuantity(get(r.column), r.suffix); err != nil {
+			return types.PodMetric{}, fmt.Errorf("%s: %v", r.column, err)
+		}
+	}
+
+	// Usage of non-OK rows is not measured, whatever the columns contain.
+	if m.Status != types.StatusOK {
+		return m, nil
+	}
+
+	m.CPU, m.HasCPU, err = parseQuantity(get(colCPU), "m")
+	if err != nil {
+		return types.PodMetric{}, fmt.Errorf("CPU: %v", err)
+	}
+	m.Memory, m.HasMemory, err = parseQuantity(get(colMemory), "Mi")
+	if err != nil {
+		return types.PodMetric{}, fmt.Errorf("Memory: %v", err)
+	}
+	return m, nil
+}
+
+// parseQuantity parses "123m"/"123Mi" (the suffix is optional). Empty and N/A
+// values are reported as missing rather than as zero.
+func parseQuantity(value, suffix string) (int64, bool, error) {
+	if value == "" || strings.EqualFold(value, "N/A") {
+		return 0, false, nil
+	}
+	n, err := strconv.ParseInt(strings.TrimSuffix(value, suffix), 10, 64)
+	if err != nil || n < 0 {
+		return 0, false, fmt.Errorf("неверное значение %q", value)
+	}
+	return n, true, nil
 }
@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+const (
+	oldHeader = "Timestamp,Namespace,Pod,Container,CPU,Memory,Status,WorkloadKind,WorkloadName\n"
+	newHeader = "Timestamp,Namespace,Pod,Container,CPU,Memory,Status,WorkloadKind,WorkloadName,Node,Labels,CPURequest,CPULimit,MemoryRequest,MemoryLimit\n"
+
+	oldRow = "2024-01-01T00:00:00Z,default,web-1,app,100m,200Mi,OK,Deployment,web\n"
+	newRow = "2024-01-01T00:01:00Z,default,web-1,app,100m,200Mi,OK,Deployment,web,node-1,team=a,50m,,64Mi,\n"
+)
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		parsed  int
+		issues  []int
+		wantCPU []int64
+	}{
+		{
+			name:    "current header",
+			input:   newHeader + newRow,
+			parsed:  1,
+			wantCPU: []int64{100},
+		},
+		{
+			name:    "old header",
+			input:   oldHeader + oldRow,
+			parsed:  1,
+			wantCPU: []int64{100},
+		},
+		{
+			name:    "old header followed by new rows",
+			input:   oldHeader + oldRow + newRow + newRow,
+			parsed:  1,
+			issues:  []int{3, 4},
+			wantCPU: []int64{100},
+		},
+		{
+			name:   "short row",
+			input:  newHeader + "2024-01-01T00:00:00Z,default,web-1\n",
+			issues: []int{2},
+		},
+		{
+			name:    "headerless legacy rows",
+			input:   "2024-01-01T00:00:00Z,default,web-1,100m,200Mi,OK\n2024-01-01T00:01:00Z,default,web-1,app,100m,200Mi,OK\n",
+			parsed:  1,
+			issues:  []int{2},
+			wantCPU: []int64{100},
+		},
+		{
+			name:   "lifecycle events are not rows",
+			input:  newHeader + "2024-01-01T00:00:00Z,default,web-1,,,,EVENT: created,Deployment,web,node-1,,,,,\n",
+			parsed: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, summary, err := Parse(strings.NewReader(tt.input), Options{})
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if summary.Parsed != tt.parsed {
+				t.Errorf("Parsed = %d, want %d", summary.Parsed, tt.parsed)
+			}
+			if len(summary.Issues) != len(tt.issues) {
+				t.Fatalf("Issues = %v, want lines %v", summary.Issues, tt.issues)
+			}
+			for i, issue := range summary.Issues {
+				if issue.Line != tt.issues[i] {
+					t.Errorf("issue %d at line %d, want %d", i, issue.Line, tt.issues[i])
+				}
+			}
+			for i, m := range metrics {
+				if m.CPU != tt.wantCPU[i] {
+					t.Errorf("row %d CPU = %d, want %d", i, m.CPU, tt.wantCPU[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStreamStrictRejectsWidthMismatch(t *testing.T) {
+	_, _, err := Parse(strings.NewReader(oldHeader+oldRow+newRow), Options{Strict: true})
+	if err == nil {
+		t.Fatal("expected error for a row wider than the header")
+	}
+	if !strings.Contains(err.Error(), "строка 3") {
+		t.Errorf("error %q does not name line 3", err)
+	}
+}
+
+func TestStreamMapsColumnsByHeader(t *testing.T) {
+	input := "Namespace,Timestamp,Pod,Memory,CPU,Status,Node,CPURequest\n" +
+		"prod,2024-01-01T00:00:00Z,api-1,300Mi,250m,OK,node-2,100m\n"
+	metrics, _, err := Parse(strings.NewReader(input), Options{Strict: true})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := types.PodMetric{Namespace: "prod", Pod: "api-1", CPU: 250, Memory: 300, Node: "node-2", CPURequest: 100}
+	got := metrics[0]
+	if got.Namespace != want.Namespace || got.Pod != want.Pod || got.CPU != want.CPU ||
+		got.Memory != want.Memory || got.Node != want.Node || got.CPURequest != want.CPURequest {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestStreamNodesRejectsWidthMismatch(t *testing.T) {
+	input := "Timestamp,Node,CPUAllocatable,MemoryAllocatable\n" +
+		"2024-01-01T00:00:00Z,node-1,4000m,8192Mi\n" +
+		"2024-01-01T00:01:00Z,node-1,team=a,4000m,8192Mi,4000m,8192Mi,N/A,N/A,Ready=True\n"
+	var nodes []types.NodeMetric
+	summary, err := StreamNodes(strings.NewReader(input), Options{}, func(n types.NodeMetric) error {
+		nodes = append(nodes, n)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamNodes: %v", err)
+	}
+	if len(nodes) != 1 || nodes[0].CPUAllocatable != 4000 {
+		t.Errorf("nodes = %+v, want the single row matching the header", nodes)
+	}
+	if summary.Skipped() != 1 || summary.Issues[0].Line != 3 {
+		t.Errorf("issues = %v, want one at line 3", summary.Issues)
+	}
+}
+
+func TestStreamReadsResourcesOfRowsWithoutUsage(t *testing.T) {
+	input := newHeader +
+		"2024-01-01T00:00:00Z,default,web-2,,N/A,N/A,NO_METRICS,Deployment,web,node-1,,150m,,256Mi,512Mi\n"
+	metrics, _, err := Parse(strings.NewReader(input), Options{Strict: true})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("metrics = %+v, want one row", metrics)
+	}
+	m := metrics[0]
+	if m.HasUsage() || m.CPURequest != 150 || m.MemoryRequest != 256 || m.MemoryLimit != 512 {
+		t.Errorf("got %+v, want pod resources without usage", m)
+	}
+}
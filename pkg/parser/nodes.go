@@ -0,0 +1,150 @@
+package parser
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+const (
+	colCPUCapacity       = "cpucapacity"
+	colMemoryCapacity    = "memorycapacity"
+	colCPUAllocatable    = "cpuallocatable"
+	colMemoryAllocatable = "memoryallocatable"
+	colConditions        = "conditions"
+)
+
+var requiredNodeColumns = []string{colTimestamp, colNode}
+
+// StreamNodeCSVFile calls fn for every valid row of a node snapshot file.
+func StreamNodeCSVFile(filePath string, opts Options, fn func(types.NodeMetric) error) (*Summary, error) {
+	file, err := os.Open(filepath.Clean(filePath))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return StreamNodes(file, opts, fn)
+}
+
+// StreamNodes reads node snapshot rows from r. Unlike pod samples, node files
+// always start with a header.
+func StreamNodes(r io.Reader, opts Options, fn func(types.NodeMetric) error) (*Summary, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	summary := &Summary{}
+	var columns map[string]int
+	var width int
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return summary, err
+			}
+			if err := summary.fail(opts, parseErr.Line, parseErr.Err.Error()); err != nil {
+				return summary, err
+			}
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		if columns == nil {
+			if !isHeader(record) {
+				return summary, fmt.Errorf("строка %d: нет заголовка", line)
+			}
+			columns, err = headerColumns(record, requiredNodeColumns)
+			if err != nil {
+				return summary, fmt.Errorf("строка %d: %v", line, err)
+			}
+			width = len(record)
+			continue
+		}
+
+		summary.Rows++
+		if err := checkWidth(record, width); err != nil {
+			if err := summary.fail(opts, line, err.Error()); err != nil {
+				return summary, err
+			}
+			continue
+		}
+		n, err := parseNodeRecord(record, columns)
+		if err != nil {
+			if err := summary.fail(opts, line, err.Error()); err != nil {
+				return summary, err
+			}
+			continue
+		}
+
+		summary.Parsed++
+		if err := fn(n); err != nil {
+			return summary, err
+		}
+	}
+
+	return summary, nil
+}
+
+func parseNodeRecord(record []string, columns map[string]int) (types.NodeMetric, error) {
+	get := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, get(colTimestamp))
+	if err != nil {
+		return types.NodeMetric{}, fmt.Errorf("неверное время %q", get(colTimestamp))
+	}
+
+	n := types.NodeMetric{Timestamp: timestamp, Node: get(colNode)}
+	if n.Node == "" {
+		return types.NodeMetric{}, fmt.Errorf("пустое имя узла")
+	}
+	n.Labels, err = types.ParseLabels(get(colLabels))
+	if err != nil {
+		return types.NodeMetric{}, err
+	}
+	n.Conditions, err = types.ParseLabels(get(colConditions))
+	if err != nil {
+		return types.NodeMetric{}, err
+	}
+
+	for _, r := range []struct {
+		column, suffix string
+		value          *int64
+	}{
+		{colCPUCapacity, "m", &n.CPUCapacity},
+		{colMemoryCapacity, "Mi", &n.MemoryCapacity},
+		{colCPUAllocatable, "m", &n.CPUAllocatable},
+		{colMemoryAllocatable, "Mi", &n.MemoryAllocatable},
+	} {
+		if *r.value, _, err = parseQuantity(get(r.column), r.suffix); err != nil {
+			return types.NodeMetric{}, fmt.Errorf("%s: %v", r.column, err)
+		}
+	}
+
+	var hasCPU, hasMemory bool
+	if n.CPU, hasCPU, err = parseQuantity(get(colCPU), "m"); err != nil {
+		return types.NodeMetric{}, fmt.Errorf("CPU: %v", err)
+	}
+	if n.Memory, hasMemory, err = parseQuantity(get(colMemory), "Mi"); err != nil {
+		return types.NodeMetric{}, fmt.Errorf("Memory: %v", err)
+	}
+	n.HasUsage = hasCPU && hasMemory
+	return n, nil
+}
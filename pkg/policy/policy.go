@@ -0,0 +1,285 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// Resources is a pair of quantities in Kubernetes notation ("50m", "2",
+// "64Mi", "4Gi"); empty means not set.
+type Resources struct {
+	CPU    string `json:"cpu,omitempty"`
+	Memory string `json:"memory,omitempty"`
+}
+
+// Rule is one entry of a policy file. It applies to the workloads matched by
+// all of its selectors; a rule without selectors applies to every workload.
+// Settings a rule leaves unset are taken from earlier matching rules.
+type Rule struct {
+	Name string `json:"name"`
+
+	Namespaces        []string `json:"namespaces,omitempty"`
+	NamespaceSelector string   `json:"namespaceSelector,omitempty"`
+	Selector          string   `json:"selector,omitempty"`
+
+	Skip                bool      `json:"skip,omitempty"`
+	MinRequests         Resources `json:"minRequests,omitempty"`
+	MaxRequests         Resources `json:"maxRequests,omitempty"`
+	Round               Resources `json:"round,omitempty"`
+	MaxLimitRatio       float64   `json:"maxLimitRatio,omitempty"`
+	MemoryLimitAboveMax bool      `json:"memoryLimitAboveMax,omitempty"`
+
+	namespaceSelector labels.Selector
+	selector          labels.Selector
+	minRequests       types.PodConfiguration
+	maxRequests       types.PodConfiguration
+	round             types.PodConfiguration
+}
+
+// Config is a policy file: rules are matched in order.
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Target describes the workload a policy is resolved for. Labels are the
+// workload's own labels; NamespaceLabels those of its namespace.
+type Target struct {
+	Namespace       string
+	Labels          map[string]string
+	NamespaceLabels map[string]string
+}
+
+// Load reads a policy file in YAML or JSON.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла политик: %v", err)
+	}
+
+	var c Config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("ошибка разбора файла политик %s: %v", path, err)
+	}
+	for i := range c.Rules {
+		if err := c.Rules[i].parse(); err != nil {
+			return nil, fmt.Errorf("файл политик %s, правило %d (%s): %v", path, i+1, c.Rules[i].Name, err)
+		}
+		if c.Rules[i].Name == "" {
+			c.Rules[i].Name = fmt.Sprintf("rule-%d", i+1)
+		}
+	}
+	return &c, nil
+}
+
+func (r *Rule) parse() error {
+	var err error
+	if r.namespaceSelector, err = labels.Parse(r.NamespaceSelector); err != nil {
+		return fmt.Errorf("namespaceSelector: %v", err)
+	}
+	if r.selector, err = labels.Parse(r.Selector); err != nil {
+		return fmt.Errorf("selector: %v", err)
+	}
+	for _, q := range []struct {
+		name  string
+		value Resources
+		out   *types.PodConfiguration
+	}{
+		{"minRequests", r.MinRequests, &r.minRequests},
+		{"maxRequests", r.MaxRequests, &r.maxRequests},
+		{"round", r.Round, &r.round},
+	} {
+		if q.out.CPU, err = parseQuantity(q.value.CPU, true); err != nil {
+			return fmt.Errorf("%s.cpu: %v", q.name, err)
+		}
+		if q.out.Memory, err = parseQuantity(q.value.Memory, false); err != nil {
+			return fmt.Errorf("%s.memory: %v", q.name, err)
+		}
+	}
+	if r.MaxLimitRatio != 0 && r.MaxLimitRatio < 1 {
+		return fmt.Errorf("maxLimitRatio должен быть не меньше 1: %v", r.MaxLimitRatio)
+	}
+	return nil
+}
+
+// parseQuantity returns millicores for CPU and MiB for memory.
+func parseQuantity(value string, cpu bool) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, fmt.Errorf("неверное значение %q", value)
+	}
+	if q.Sign() < 0 {
+		return 0, fmt.Errorf("отрицательное значение %q", value)
+	}
+	if cpu {
+		return q.MilliValue(), nil
+	}
+	return q.Value() / (1024 * 1024), nil
+}
+
+func (r *Rule) matches(t Target) bool {
+	if len(r.Namespaces) > 0 && !contains(r.Namespaces, t.Namespace) {
+		return false
+	}
+	return r.namespaceSelector.Matches(labels.Set(t.NamespaceLabels)) &&
+		r.selector.Matches(labels.Set(t.Labels))
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// setting is a resolved value together with the rule that set it; an empty
+// rule means the setting is not in effect.
+type setting[T any] struct {
+	value T
+	rule  string
+}
+
+// Policy is the combination of the rules matching one workload.
+type Policy struct {
+	// Skip names the rule that excludes the workload from recommendations.
+	Skip string
+
+	minCPU, minMemory   setting[int64]
+	maxCPU, maxMemory   setting[int64]
+	cpuStep, memoryStep setting[int64]
+	maxLimitRatio       setting[float64]
+	memoryLimitAboveMax setting[bool]
+}
+
+// For resolves the policy of a workload. A nil Config yields an empty policy
+// that changes nothing.
+func (c *Config) For(t Target) *Policy {
+	p := &Policy{}
+	if c == nil {
+		return p
+	}
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if !r.matches(t) {
+			continue
+		}
+		if r.Skip && p.Skip == "" {
+			p.Skip = r.Name
+		}
+		setInt(&p.minCPU, r.minRequests.CPU, r.Name)
+		setInt(&p.minMemory, r.minRequests.Memory, r.Name)
+		setInt(&p.maxCPU, r.maxRequests.CPU, r.Name)
+		setInt(&p.maxMemory, r.maxRequests.Memory, r.Name)
+		setInt(&p.cpuStep, r.round.CPU, r.Name)
+		setInt(&p.memoryStep, r.round.Memory, r.Name)
+		if r.MaxLimitRatio > 0 {
+			p.maxLimitRatio = setting[float64]{r.MaxLimitRatio, r.Name}
+		}
+		if r.MemoryLimitAboveMax {
+			p.memoryLimitAboveMax = setting[bool]{true, r.Name}
+		}
+	}
+	return p
+}
+
+func setInt(s *setting[int64], v int64, rule string) {
+	if v > 0 {
+		*s = setting[int64]{v, rule}
+	}
+}
+
+// Change records a value a rule changed. CPU fields are in millicores,
+// memory fields in MiB.
+type Change struct {
+	Rule  string `json:"rule"`
+	Field string `json:"field"`
+	From  int64  `json:"from"`
+	To    int64  `json:"to"`
+}
+
+func (c Change) String() string {
+	unit := "m"
+	if strings.HasSuffix(c.Field, "memory") {
+		unit = "Mi"
+	}
+	return fmt.Sprintf("%s: %s %d%s → %d%s", c.Rule, c.Field, c.From, unit, c.To, unit)
+}
+
+// Apply adjusts a recommendation in a fixed order: values are rounded up to
+// the steps, requests are clamped to the bounds, limits are capped at
+// maxLimitRatio times the request, and the memory limit is raised to the
+// observed maximum. Limits never end up below requests.
+func (p *Policy) Apply(rec types.ContainerResources, maxMemory int64) (types.ContainerResources, []Change) {
+	var changes []Change
+	set := func(rule, field string, v *int64, to int64) {
+		if *v != to {
+			changes = append(changes, Change{Rule: rule, Field: field, From: *v, To: to})
+			*v = to
+		}
+	}
+
+	type pair struct {
+		name               string
+		request, limit     *int64
+		step, lower, upper setting[int64]
+	}
+	pairs := []pair{
+		{"cpu", &rec.Requests.CPU, &rec.Limits.CPU, p.cpuStep, p.minCPU, p.maxCPU},
+		{"memory", &rec.Requests.Memory, &rec.Limits.Memory, p.memoryStep, p.minMemory, p.maxMemory},
+	}
+
+	for _, r := range pairs {
+		if r.step.rule != "" {
+			set(r.step.rule, "requests."+r.name, r.request, roundUp(*r.request, r.step.value))
+			set(r.step.rule, "limits."+r.name, r.limit, roundUp(*r.limit, r.step.value))
+		}
+		if r.lower.rule != "" && *r.request < r.lower.value {
+			set(r.lower.rule, "requests."+r.name, r.request, r.lower.value)
+		}
+		if r.upper.rule != "" && *r.request > r.upper.value {
+			set(r.upper.rule, "requests."+r.name, r.request, r.upper.value)
+		}
+		if p.maxLimitRatio.rule != "" {
+			capped := int64(float64(*r.request) * p.maxLimitRatio.value)
+			if r.step.value > 0 {
+				capped = capped / r.step.value * r.step.value
+			}
+			if *r.limit > capped {
+				set(p.maxLimitRatio.rule, "limits."+r.name, r.limit, capped)
+			}
+		}
+		if *r.limit < *r.request {
+			rule := r.lower.rule
+			if rule == "" {
+				rule = p.maxLimitRatio.rule
+			}
+			if rule == "" {
+				rule = r.step.rule
+			}
+			set(rule, "limits."+r.name, r.limit, *r.request)
+		}
+	}
+
+	if p.memoryLimitAboveMax.rule != "" && rec.Limits.Memory < maxMemory {
+		set(p.memoryLimitAboveMax.rule, "limits.memory", &rec.Limits.Memory, roundUp(maxMemory, p.memoryStep.value))
+	}
+	return rec, changes
+}
+
+func roundUp(v, step int64) int64 {
+	if step <= 0 || v%step == 0 {
+		return v
+	}
+	return (v/step + 1) * step
+}
@@ -0,0 +1,250 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+func loadConfig(t *testing.T, content string) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return c
+}
+
+func resources(cpuRequest, cpuLimit, memRequest, memLimit int64) types.ContainerResources {
+	return types.ContainerResources{
+		Requests: types.PodConfiguration{CPU: cpuRequest, Memory: memRequest},
+		Limits:   types.PodConfiguration{CPU: cpuLimit, Memory: memLimit},
+	}
+}
+
+var prod = Target{
+	Namespace:       "prod",
+	Labels:          map[string]string{"app": "web", "tier": "frontend"},
+	NamespaceLabels: map[string]string{"env": "production"},
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		target    Target
+		rec       types.ContainerResources
+		maxMemory int64
+		want      types.ContainerResources
+		changes   []Change
+	}{
+		{
+			name:   "no rules",
+			config: "rules: []",
+			target: prod, rec: resources(130, 400, 200, 300),
+			want: resources(130, 400, 200, 300),
+		},
+		{
+			name: "round up to steps",
+			config: `
+rules:
+- name: round
+  round: {cpu: 50m, memory: 64Mi}`,
+			target: prod, rec: resources(130, 400, 200, 300),
+			want: resources(150, 400, 256, 320),
+			changes: []Change{
+				{"round", "requests.cpu", 130, 150},
+				{"round", "requests.memory", 200, 256},
+				{"round", "limits.memory", 300, 320},
+			},
+		},
+		{
+			name: "min requests raise the limit with the request",
+			config: `
+rules:
+- name: floor
+  minRequests: {cpu: 100m, memory: 128Mi}`,
+			target: prod, rec: resources(20, 50, 64, 512),
+			want: resources(100, 100, 128, 512),
+			changes: []Change{
+				{"floor", "requests.cpu", 20, 100},
+				{"floor", "limits.cpu", 50, 100},
+				{"floor", "requests.memory", 64, 128},
+			},
+		},
+		{
+			name: "max requests",
+			config: `
+rules:
+- name: ceiling
+  maxRequests: {cpu: "2", memory: 4Gi}`,
+			target: prod, rec: resources(3000, 4000, 8192, 8192),
+			want: resources(2000, 4000, 4096, 8192),
+			changes: []Change{
+				{"ceiling", "requests.cpu", 3000, 2000},
+				{"ceiling", "requests.memory", 8192, 4096},
+			},
+		},
+		{
+			name: "limit ratio caps limits",
+			config: `
+rules:
+- name: ratio
+  maxLimitRatio: 2`,
+			target: prod, rec: resources(100, 500, 256, 400),
+			want: resources(100, 200, 256, 400),
+			changes: []Change{
+				{"ratio", "limits.cpu", 500, 200},
+			},
+		},
+		{
+			name: "limit ratio keeps the capped limit on the step",
+			config: `
+rules:
+- name: ratio
+  maxLimitRatio: 1.5
+  round: {cpu: 100m}`,
+			target: prod, rec: resources(300, 1000, 256, 256),
+			want: resources(300, 400, 256, 256),
+			changes: []Change{
+				{"ratio", "limits.cpu", 1000, 400},
+			},
+		},
+		{
+			name: "memory limit above the observed maximum",
+			config: `
+rules:
+- name: oom
+  memoryLimitAboveMax: true
+  round: {memory: 64Mi}`,
+			target: prod, rec: resources(100, 200, 256, 256), maxMemory: 300,
+			want: resources(100, 200, 256, 320),
+			changes: []Change{
+				{"oom", "limits.memory", 256, 320},
+			},
+		},
+		{
+			name: "later rules override earlier settings",
+			config: `
+rules:
+- name: base
+  minRequests: {cpu: 50m, memory: 64Mi}
+- name: prod
+  namespaces: [prod]
+  minRequests: {cpu: 200m}`,
+			target: prod, rec: resources(10, 1000, 10, 1000),
+			want: resources(200, 1000, 64, 1000),
+			changes: []Change{
+				{"prod", "requests.cpu", 10, 200},
+				{"base", "requests.memory", 10, 64},
+			},
+		},
+		{
+			name: "rules of other workloads are ignored",
+			config: `
+rules:
+- name: other-namespace
+  namespaces: [dev]
+  minRequests: {cpu: "1"}
+- name: other-env
+  namespaceSelector: env=staging
+  minRequests: {cpu: "1"}
+- name: other-app
+  selector: app=api
+  minRequests: {cpu: "1"}
+- name: frontend
+  namespaceSelector: env=production
+  selector: tier in (frontend),app
+  minRequests: {cpu: 100m}`,
+			target: prod, rec: resources(10, 1000, 64, 64),
+			want: resources(100, 1000, 64, 64),
+			changes: []Change{
+				{"frontend", "requests.cpu", 10, 100},
+			},
+		},
+		{
+			name: "max is applied after min when the bounds cross",
+			config: `
+rules:
+- name: floor
+  minRequests: {cpu: 500m}
+- name: ceiling
+  maxRequests: {cpu: 300m}`,
+			target: prod, rec: resources(100, 1000, 64, 64),
+			want: resources(300, 1000, 64, 64),
+			changes: []Change{
+				{"floor", "requests.cpu", 100, 500},
+				{"ceiling", "requests.cpu", 500, 300},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := loadConfig(t, tt.config).For(tt.target)
+			got, changes := p.Apply(tt.rec, tt.maxMemory)
+			if got != tt.want {
+				t.Errorf("Apply = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(changes, tt.changes) {
+				t.Errorf("changes = %v, want %v", changes, tt.changes)
+			}
+		})
+	}
+}
+
+func TestSkip(t *testing.T) {
+	c := loadConfig(t, `
+rules:
+- name: keep
+  minRequests: {cpu: 10m}
+- selector: app=web
+  skip: true
+- name: later
+  skip: true`)
+	if got := c.For(prod).Skip; got != "rule-2" {
+		t.Errorf("Skip = %q, want the first skipping rule, named by position", got)
+	}
+	if got := c.For(Target{Namespace: "prod", Labels: map[string]string{"app": "api"}}).Skip; got != "later" {
+		t.Errorf("Skip = %q, want later", got)
+	}
+
+	var none *Config
+	if p := none.For(prod); p.Skip != "" {
+		t.Errorf("nil config skips by %q", p.Skip)
+	}
+	if got, changes := none.For(prod).Apply(resources(10, 20, 30, 40), 100); got != resources(10, 20, 30, 40) || changes != nil {
+		t.Errorf("nil config changed %+v: %v", got, changes)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		err     string
+	}{
+		{"rules: [", "ошибка разбора"},
+		{"rules:\n- name: x\n  skipp: true", "ошибка разбора"},
+		{"rules:\n- name: bad\n  selector: 'app in ('", "правило 1 (bad): selector"},
+		{"rules:\n- namespaceSelector: '!!'", "правило 1 (): namespaceSelector"},
+		{"rules:\n- minRequests: {cpu: lots}", "minRequests.cpu: неверное значение"},
+		{"rules:\n- maxRequests: {memory: -1Gi}", "maxRequests.memory: отрицательное значение"},
+		{"rules:\n- maxLimitRatio: 0.5", "maxLimitRatio должен быть не меньше 1"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "policy.yaml")
+		if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Load(%q) error = %v, want %q", tt.content, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package pricing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const DefaultCurrency = "USD"
+
+// Well-known node labels. Node pool labels are tried in order unless the
+// pricing file sets its own list.
+var (
+	DefaultNodePoolLabels = []string{
+		"cloud.google.com/gke-nodepool",
+		"eks.amazonaws.com/nodegroup",
+		"karpenter.sh/nodepool",
+		"kubernetes.azure.com/agentpool",
+		"agentpool",
+	}
+	InstanceTypeLabels = []string{
+		"node.kubernetes.io/instance-type",
+		"beta.kubernetes.io/instance-type",
+	}
+	// spotLabels maps capacity-type labels to the value that marks a spot
+	// (preemptible) node; values are compared case-insensitively.
+	spotLabels = map[string]string{
+		"karpenter.sh/capacity-type":            "spot",
+		"eks.amazonaws.com/capacityType":        "spot",
+		"cloud.google.com/gke-spot":             "true",
+		"cloud.google.com/gke-preemptible":      "true",
+		"kubernetes.azure.com/scalesetpriority": "spot",
+		"node.kubernetes.io/lifecycle":          "spot",
+	}
+)
+
+// Rate is a price per CPU core-hour and per GiB-hour of memory.
+type Rate struct {
+	CPU    float64 `json:"cpu"`
+	Memory float64 `json:"memory"`
+}
+
+// Rates holds the on-demand price and, optionally, a cheaper spot price.
+// Spot nodes fall back to the on-demand price when Spot is not set.
+type Rates struct {
+	OnDemand Rate  `json:"onDemand"`
+	Spot     *Rate `json:"spot,omitempty"`
+}
+
+// Model is a pricing file. The rate of a sample is taken from the first
+// match of: namespace override, node pool, instance type, default.
+type Model struct {
+	Currency       string           `json:"currency,omitempty"`
+	Default        Rates            `json:"default"`
+	NodePoolLabels []string         `json:"nodePoolLabels,omitempty"`
+	NodePools      map[string]Rates `json:"nodePools,omitempty"`
+	InstanceTypes  map[string]Rates `json:"instanceTypes,omitempty"`
+	Namespaces     map[string]Rates `json:"namespaces,omitempty"`
+}
+
+// Flat returns a model with a single on-demand rate for every pod.
+func Flat(cpu, memory float64) *Model {
+	return &Model{
+		Currency: DefaultCurrency,
+		Default:  Rates{OnDemand: Rate{CPU: cpu, Memory: memory}},
+	}
+}
+
+// Load reads a pricing model from a YAML or JSON file.
+func Load(path string) (*Model, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла цен: %v", err)
+	}
+
+	var m Model
+	if err := yaml.UnmarshalStrict(data, &m); err != nil {
+		return nil, fmt.Errorf("ошибка разбора файла цен %s: %v", path, err)
+	}
+	if m.Currency == "" {
+		m.Currency = DefaultCurrency
+	}
+	if len(m.NodePoolLabels) == 0 {
+		m.NodePoolLabels = DefaultNodePoolLabels
+	}
+	if err := m.validate(); err != nil {
+		return nil, fmt.Errorf("файл цен %s: %v", path, err)
+	}
+	return &m, nil
+}
+
+func (m *Model) validate() error {
+	check := func(where string, r Rates) error {
+		for _, rate := range []*Rate{&r.OnDemand, r.Spot} {
+			if rate != nil && (rate.CPU < 0 || rate.Memory < 0) {
+				return fmt.Errorf("%s: отрицательная цена", where)
+			}
+		}
+		return nil
+	}
+
+	if err := check("default", m.Default); err != nil {
+		return err
+	}
+	for _, group := range []struct {
+		name  string
+		rates map[string]Rates
+	}{
+		{"nodePools", m.NodePools},
+		{"instanceTypes", m.InstanceTypes},
+		{"namespaces", m.Namespaces},
+	} {
+		for key, r := range group.rates {
+			if err := check(group.name+"."+key, r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Rate returns the price for a pod in namespace running on a node with the
+// given labels. Unknown nodes (nil labels) get the namespace or default rate.
+func (m *Model) Rate(namespace string, nodeLabels map[string]string) Rate {
+	return m.rates(namespace, nodeLabels).pick(IsSpot(nodeLabels))
+}
+
+// NodeRate returns the price of a node's capacity, ignoring namespace
+// overrides.
+func (m *Model) NodeRate(nodeLabels map[string]string) Rate {
+	return m.nodeRates(nodeLabels).pick(IsSpot(nodeLabels))
+}
+
+func (m *Model) rates(namespace string, nodeLabels map[string]string) Rates {
+	if r, ok := m.Namespaces[namespace]; ok {
+		return r
+	}
+	return m.nodeRates(nodeLabels)
+}
+
+func (m *Model) nodeRates(nodeLabels map[string]string) Rates {
+	for _, label := range m.NodePoolLabels {
+		if r, ok := m.NodePools[nodeLabels[label]]; ok {
+			return r
+		}
+	}
+	for _, label := range InstanceTypeLabels {
+		if r, ok := m.InstanceTypes[nodeLabels[label]]; ok {
+			return r
+		}
+	}
+	return m.Default
+}
+
+func (r Rates) pick(spot bool) Rate {
+	if spot && r.Spot != nil {
+		return *r.Spot
+	}
+	return r.OnDemand
+}
+
+// IsSpot reports whether the node labels mark a spot/preemptible node.
+func IsSpot(nodeLabels map[string]string) bool {
+	for label, value := range spotLabels {
+		if strings.EqualFold(nodeLabels[label], value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Format renders an amount in the model currency: "$12.34" for USD,
+// "12.34 EUR" otherwise.
+func (m *Model) Format(amount float64) string {
+	if m.Currency == DefaultCurrency {
+		return fmt.Sprintf("$%.2f", amount)
+	}
+	return fmt.Sprintf("%.2f %s", amount, m.Currency)
+}
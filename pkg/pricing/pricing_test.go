@@ -0,0 +1,161 @@
+package pricing
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testModel = `
+currency: EUR
+default:
+  onDemand: {cpu: 0.04, memory: 0.005}
+  spot: {cpu: 0.01, memory: 0.001}
+nodePools:
+  batch:
+    onDemand: {cpu: 0.02, memory: 0.002}
+instanceTypes:
+  m5.large:
+    onDemand: {cpu: 0.05, memory: 0.006}
+    spot: {cpu: 0.015, memory: 0.002}
+  c5.xlarge:
+    onDemand: {cpu: 0.03, memory: 0.004}
+namespaces:
+  dev:
+    onDemand: {cpu: 0.001, memory: 0.0001}
+`
+
+func writeModel(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pricing.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		currency string
+		labels   []string
+		err      string
+	}{
+		{name: "full model", content: testModel, currency: "EUR", labels: DefaultNodePoolLabels},
+		{name: "defaults", content: "default:\n  onDemand: {cpu: 0.04, memory: 0.005}\n", currency: DefaultCurrency, labels: DefaultNodePoolLabels},
+		{name: "json", content: `{"default": {"onDemand": {"cpu": 0.04, "memory": 0.005}}}`, currency: DefaultCurrency, labels: DefaultNodePoolLabels},
+		{name: "own node pool labels", content: "nodePoolLabels: [pool]\ndefault:\n  onDemand: {cpu: 1, memory: 1}\n",
+			currency: DefaultCurrency, labels: []string{"pool"}},
+		{name: "malformed yaml", content: "default: [", err: "ошибка разбора"},
+		{name: "unknown field", content: "default:\n  onDemand: {cpu: 1, memroy: 1}\n", err: "ошибка разбора"},
+		{name: "wrong type", content: "default:\n  onDemand: {cpu: cheap}\n", err: "ошибка разбора"},
+		{name: "negative default", content: "default:\n  onDemand: {cpu: -1}\n", err: "default: отрицательная цена"},
+		{name: "negative spot", content: "default:\n  onDemand: {cpu: 1}\ninstanceTypes:\n  m5.large:\n    spot: {memory: -1}\n",
+			err: "instanceTypes.m5.large: отрицательная цена"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Load(writeModel(t, tt.content))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Load error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if m.Currency != tt.currency {
+				t.Errorf("currency = %q, want %q", m.Currency, tt.currency)
+			}
+			if !reflect.DeepEqual(m.NodePoolLabels, tt.labels) {
+				t.Errorf("node pool labels = %v, want %v", m.NodePoolLabels, tt.labels)
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil || !strings.Contains(err.Error(), "ошибка чтения") {
+		t.Errorf("Load of a missing file: error = %v", err)
+	}
+}
+
+func TestRate(t *testing.T) {
+	m, err := Load(writeModel(t, testModel))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	tests := []struct {
+		name      string
+		namespace string
+		labels    map[string]string
+		want      Rate
+		node      Rate
+	}{
+		{name: "unknown node", labels: nil,
+			want: Rate{0.04, 0.005}, node: Rate{0.04, 0.005}},
+		{name: "unknown instance type", labels: map[string]string{"node.kubernetes.io/instance-type": "t3.micro"},
+			want: Rate{0.04, 0.005}, node: Rate{0.04, 0.005}},
+		{name: "instance type", labels: map[string]string{"node.kubernetes.io/instance-type": "m5.large"},
+			want: Rate{0.05, 0.006}, node: Rate{0.05, 0.006}},
+		{name: "beta instance type label", labels: map[string]string{"beta.kubernetes.io/instance-type": "c5.xlarge"},
+			want: Rate{0.03, 0.004}, node: Rate{0.03, 0.004}},
+		{name: "spot instance type", labels: map[string]string{"node.kubernetes.io/instance-type": "m5.large", "karpenter.sh/capacity-type": "spot"},
+			want: Rate{0.015, 0.002}, node: Rate{0.015, 0.002}},
+		{name: "spot without spot price", labels: map[string]string{"node.kubernetes.io/instance-type": "c5.xlarge", "cloud.google.com/gke-spot": "true"},
+			want: Rate{0.03, 0.004}, node: Rate{0.03, 0.004}},
+		{name: "spot default", labels: map[string]string{"eks.amazonaws.com/capacityType": "SPOT"},
+			want: Rate{0.01, 0.001}, node: Rate{0.01, 0.001}},
+		{name: "node pool before instance type", labels: map[string]string{"cloud.google.com/gke-nodepool": "batch", "node.kubernetes.io/instance-type": "m5.large"},
+			want: Rate{0.02, 0.002}, node: Rate{0.02, 0.002}},
+		{name: "namespace override", namespace: "dev", labels: map[string]string{"node.kubernetes.io/instance-type": "m5.large"},
+			want: Rate{0.001, 0.0001}, node: Rate{0.05, 0.006}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.Rate(tt.namespace, tt.labels); got != tt.want {
+				t.Errorf("Rate = %+v, want %+v", got, tt.want)
+			}
+			if got := m.NodeRate(tt.labels); got != tt.node {
+				t.Errorf("NodeRate = %+v, want %+v", got, tt.node)
+			}
+		})
+	}
+}
+
+func TestIsSpot(t *testing.T) {
+	tests := []struct {
+		labels map[string]string
+		want   bool
+	}{
+		{nil, false},
+		{map[string]string{"node.kubernetes.io/instance-type": "m5.large"}, false},
+		{map[string]string{"karpenter.sh/capacity-type": "spot"}, true},
+		{map[string]string{"karpenter.sh/capacity-type": "on-demand"}, false},
+		{map[string]string{"eks.amazonaws.com/capacityType": "SPOT"}, true},
+		{map[string]string{"eks.amazonaws.com/capacityType": "ON_DEMAND"}, false},
+		{map[string]string{"cloud.google.com/gke-spot": "true"}, true},
+		{map[string]string{"cloud.google.com/gke-preemptible": "true"}, true},
+		{map[string]string{"cloud.google.com/gke-preemptible": "false"}, false},
+		{map[string]string{"kubernetes.azure.com/scalesetpriority": "spot"}, true},
+		{map[string]string{"kubernetes.azure.com/scalesetpriority": "regular"}, false},
+		{map[string]string{"node.kubernetes.io/lifecycle": "spot"}, true},
+		{map[string]string{"spot": "true"}, false},
+	}
+	for _, tt := range tests {
+		if got := IsSpot(tt.labels); got != tt.want {
+			t.Errorf("IsSpot(%v) = %v, want %v", tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	if got := Flat(1, 1).Format(12.345); got != "$12.35" {
+		t.Errorf("USD: %q", got)
+	}
+	if got := (&Model{Currency: "EUR"}).Format(3); got != "3.00 EUR" {
+		t.Errorf("EUR: %q", got)
+	}
+}
@@ -0,0 +1,96 @@
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultAccuracy is the relative error of Sketch quantiles.
+const DefaultAccuracy = 0.01
+
+// Sketch is a streaming quantile estimator for non-negative values with a
+// bounded relative error (a DDSketch-style log-bucket histogram). Its size
+// depends on the value range, not on the number of samples. The zero value
+// is ready to use with DefaultAccuracy.
+type Sketch struct {
+	gamma   float64
+	logG    float64
+	zeros   int64
+	buckets map[int]int64
+	count   int64
+	min     int64
+	max     int64
+}
+
+func NewSketch(accuracy float64) *Sketch {
+	s := &Sketch{}
+	s.init(accuracy)
+	return s
+}
+
+func (s *Sketch) init(accuracy float64) {
+	s.gamma = (1 + accuracy) / (1 - accuracy)
+	s.logG = math.Log(s.gamma)
+	s.buckets = make(map[int]int64)
+}
+
+func (s *Sketch) Add(v int64) {
+	if s.buckets == nil {
+		s.init(DefaultAccuracy)
+	}
+	if v < 0 {
+		v = 0
+	}
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.count++
+
+	if v == 0 {
+		s.zeros++
+		return
+	}
+	s.buckets[int(math.Ceil(math.Log(float64(v))/s.logG))]++
+}
+
+func (s *Sketch) Count() int64 {
+	return s.count
+}
+
+// Quantile returns the estimated p-th percentile (0..100).
+func (s *Sketch) Quantile(p float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	p = clampPercentile(p)
+	if p == 0 {
+		return float64(s.min)
+	}
+	if p == 100 {
+		return float64(s.max)
+	}
+
+	rank := int64(math.Ceil(p / 100 * float64(s.count)))
+	seen := s.zeros
+	if seen >= rank {
+		return 0
+	}
+
+	keys := make([]int, 0, len(s.buckets))
+	for k := range s.buckets {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	for _, k := range keys {
+		seen += s.buckets[k]
+		if seen >= rank {
+			v := 2 * math.Pow(s.gamma, float64(k)) / (s.gamma + 1)
+			return math.Min(math.Max(v, float64(s.min)), float64(s.max))
+		}
+	}
+	return float64(s.max)
+}
@@ -0,0 +1,89 @@
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// Percentile returns the p-th percentile (0..100) of values using linear
+// interpolation between the closest ranks. values is not modified.
+func Percentile(values []int64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := make([]int64, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return percentileSorted(sorted, p)
+}
+
+func percentileSorted(sorted []int64, p float64) float64 {
+	p = clampPercentile(p)
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	if lo == hi {
+		return float64(sorted[lo])
+	}
+	frac := rank - float64(lo)
+	return float64(sorted[lo]) + frac*float64(sorted[hi]-sorted[lo])
+}
+
+func Median(values []int64) float64 {
+	return Percentile(values, 50)
+}
+
+func Mean(values []int64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += float64(v)
+	}
+	return sum / float64(len(values))
+}
+
+// StdDev returns the population standard deviation.
+func StdDev(values []int64) float64 {
+	var m Moments
+	for _, v := range values {
+		m.Add(float64(v))
+	}
+	return m.StdDev()
+}
+
+// Moments keeps a running mean and variance (Welford's algorithm).
+type Moments struct {
+	Count int64
+	mean  float64
+	m2    float64
+}
+
+func (m *Moments) Add(v float64) {
+	m.Count++
+	delta := v - m.mean
+	m.mean += delta / float64(m.Count)
+	m.m2 += delta * (v - m.mean)
+}
+
+func (m Moments) Mean() float64 {
+	return m.mean
+}
+
+func (m Moments) StdDev() float64 {
+	if m.Count == 0 {
+		return 0
+	}
+	return math.Sqrt(m.m2 / float64(m.Count))
+}
+
+func clampPercentile(p float64) float64 {
+	switch {
+	case p < 0:
+		return 0
+	case p > 100:
+		return 100
+	}
+	return p
+}
@@ -0,0 +1,177 @@
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+var percentiles = []float64{0, 1, 25, 50, 75, 90, 95, 99, 99.9, 100}
+
+// series returns deterministic samples shaped like recorded usage: a flat
+// range, a long tail and a series dominated by one value.
+func series() map[string][]int64 {
+	r := rand.New(rand.NewSource(1))
+	uniform := make([]int64, 10000)
+	for i := range uniform {
+		uniform[i] = 1 + r.Int63n(4000)
+	}
+	tail := make([]int64, 10000)
+	for i := range tail {
+		tail[i] = int64(math.Exp(r.NormFloat64()*1.5 + 5))
+	}
+	flat := make([]int64, 1000)
+	for i := range flat {
+		flat[i] = 512
+		if i%100 == 0 {
+			flat[i] = 2048
+		}
+	}
+	return map[string][]int64{"uniform": uniform, "long tail": tail, "flat with spikes": flat}
+}
+
+func sketchOf(values []int64, accuracy float64) *Sketch {
+	s := NewSketch(accuracy)
+	for _, v := range values {
+		s.Add(v)
+	}
+	return s
+}
+
+// nearestRank is the value a sketch estimates: the smallest sample with at
+// least p% of the samples at or below it.
+func nearestRank(sorted []int64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return float64(sorted[rank-1])
+}
+
+func TestSketchRelativeError(t *testing.T) {
+	for _, accuracy := range []float64{DefaultAccuracy, 0.05} {
+		for name, values := range series() {
+			s := sketchOf(values, accuracy)
+			sorted := append([]int64(nil), values...)
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+			for _, p := range percentiles {
+				want := nearestRank(sorted, p)
+				got := s.Quantile(p)
+				if math.Abs(got-want) > accuracy*want {
+					t.Errorf("%s, accuracy %g: p%g = %g, want %g within %g%%", name, accuracy, p, got, want, 100*accuracy)
+				}
+			}
+		}
+	}
+}
+
+func TestSketchAgreesWithExactPercentile(t *testing.T) {
+	// Percentile interpolates between ranks while the sketch picks a rank,
+	// so they differ by the accuracy plus the gap between neighbouring
+	// samples. The gap is small on smooth series only: at the jump of the
+	// flat series the interpolated value is not a sample at all.
+	const tolerance = 2 * DefaultAccuracy
+	all := series()
+	for _, name := range []string{"uniform", "long tail"} {
+		values := all[name]
+		s := sketchOf(values, DefaultAccuracy)
+		for _, p := range []float64{50, 90, 95, 99} {
+			exact := Percentile(values, p)
+			if got := s.Quantile(p); math.Abs(got-exact) > tolerance*exact {
+				t.Errorf("%s: p%g sketch = %g, exact = %g", name, p, got, exact)
+			}
+		}
+	}
+}
+
+func TestEmptyAndSingleValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int64
+		want   float64
+	}{
+		{"empty", nil, 0},
+		{"single value", []int64{750}, 750},
+		{"single zero", []int64{0}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := sketchOf(tt.values, DefaultAccuracy)
+			if s.Count() != int64(len(tt.values)) {
+				t.Errorf("Count = %d, want %d", s.Count(), len(tt.values))
+			}
+			for _, p := range percentiles {
+				if got := s.Quantile(p); got != tt.want {
+					t.Errorf("sketch p%g = %g, want %g", p, got, tt.want)
+				}
+			}
+			for _, p := range percentiles {
+				if got := Percentile(tt.values, p); got != tt.want {
+					t.Errorf("Percentile p%g = %g, want %g", p, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestZeroValueSketch(t *testing.T) {
+	var s Sketch
+	if got := s.Quantile(95); got != 0 {
+		t.Errorf("empty zero-value sketch p95 = %g, want 0", got)
+	}
+	for _, v := range []int64{0, -5, 100, 200} {
+		s.Add(v)
+	}
+	if got := s.Quantile(50); got != 0 {
+		t.Errorf("p50 = %g, want 0: half of the samples are zero or negative", got)
+	}
+	if got := s.Quantile(100); got != 200 {
+		t.Errorf("p100 = %g, want the maximum 200", got)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []int64{40, 10, 30, 20}
+	tests := []struct {
+		p, want float64
+	}{
+		{-10, 10},
+		{0, 10},
+		{50, 25},
+		{75, 32.5},
+		{100, 40},
+		{150, 40},
+	}
+	for _, tt := range tests {
+		if got := Percentile(values, tt.p); got != tt.want {
+			t.Errorf("Percentile(p%g) = %g, want %g", tt.p, got, tt.want)
+		}
+	}
+	if values[0] != 40 {
+		t.Errorf("Percentile sorted its input: %v", values)
+	}
+}
+
+func TestMoments(t *testing.T) {
+	tests := []struct {
+		name         string
+		values       []int64
+		mean, stddev float64
+	}{
+		{"empty", nil, 0, 0},
+		{"single value", []int64{7}, 7, 0},
+		{"several values", []int64{2, 4, 4, 4, 5, 5, 7, 9}, 5, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Mean(tt.values); got != tt.mean {
+				t.Errorf("Mean = %g, want %g", got, tt.mean)
+			}
+			if got := StdDev(tt.values); math.Abs(got-tt.stddev) > 1e-9 {
+				t.Errorf("StdDev = %g, want %g", got, tt.stddev)
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package storage
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/parser"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+var (
+	csvHeader = []string{"Timestamp", "Namespace", "Pod", "Container", "CPU", "Memory", "Status", "WorkloadKind", "WorkloadName", "Node", "Labels",
+		"CPURequest", "CPULimit", "MemoryRequest", "MemoryLimit"}
+	csvNodeHeader = []string{"Timestamp", "Node", "Labels", "CPUAllocatable", "MemoryAllocatable",
+		"CPUCapacity", "MemoryCapacity", "CPU", "Memory", "Conditions"}
+)
+
+type csvWriter struct {
+	path   string
+	file   *os.File
+	writer *csv.Writer
+
+	// The node file is opened on the first AppendNodes.
+	nodesFile   *os.File
+	nodesWriter *csv.Writer
+}
+
+func newCSVWriter(path string) (*csvWriter, error) {
+	file, writer, err := openCSV(path, csvHeader)
+	if err != nil {
+		return nil, err
+	}
+	return &csvWriter{path: path, file: file, writer: writer}, nil
+}
+
+// openCSV opens path for appending and writes header if the file is empty.
+// A file written with a different header (an older schema or no header at
+// all) is renamed to name.<timestamp>.ext so that new rows never end up under
+// a header that does not describe them.
+func openCSV(path string, header []string) (*os.File, *csv.Writer, error) {
+	path = filepath.Clean(path)
+	if err := rotateStaleCSV(path, header); err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка открытия файла: %v", err)
+	}
+
+	writer := csv.NewWriter(file)
+	if stat, err := file.Stat(); err == nil && stat.Size() == 0 {
+		writer.Write(header)
+	}
+	return file, writer, nil
+}
+
+// rotateStaleCSV moves an existing non-empty file aside when its first
+// record differs from header.
+func rotateStaleCSV(path string, header []string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка открытия файла: %v", err)
+	}
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	first, err := reader.Read()
+	file.Close()
+	if err == io.EOF {
+		return nil
+	}
+	if err == nil && equalHeader(first, header) {
+		return nil
+	}
+
+	rotated := rotatedPath(path, time.Now())
+	if err := os.Rename(path, rotated); err != nil {
+		return fmt.Errorf("ошибка переименования файла со старым заголовком %s: %v", path, err)
+	}
+	fmt.Fprintf(Log, "Заголовок %s не совпадает с текущим форматом: файл переименован в %s, запись начата в новый файл; команды анализа читают оба\n", path, rotated)
+	return nil
+}
+
+func equalHeader(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if strings.TrimSpace(got[i]) != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+const rotatedLayout = "20060102T150405"
+
+// rotatedPath turns output.csv into output.20060102T150405.csv.
+func rotatedPath(path string, now time.Time) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + now.Format(rotatedLayout) + ext
+}
+
+// rotatedSiblings returns the files rotateStaleCSV moved aside from path,
+// oldest first. A file rotated before from holds no rows at or after it and
+// is left out.
+func rotatedSiblings(path string, from time.Time) []string {
+	ext := filepath.Ext(path)
+	prefix := filepath.Base(strings.TrimSuffix(path, ext)) + "."
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil
+	}
+
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) || len(name) < len(prefix)+len(ext) {
+			continue
+		}
+		rotated, err := time.ParseInLocation(rotatedLayout, name[len(prefix):len(name)-len(ext)], time.Local)
+		if err != nil || (!from.IsZero() && rotated.Before(from)) {
+			continue
+		}
+		files = append(files, filepath.Join(filepath.Dir(path), name))
+	}
+	sort.Strings(files)
+	return files
+}
+
+// scanRotated runs scan over the rotated siblings of path and then path
+// itself, so that rows written before a schema change are read too. Issues
+// in rotated files are reported with the file name.
+func scanRotated(path string, from time.Time, scan func(string) (*parser.Summary, error)) (*parser.Summary, error) {
+	total := &parser.Summary{}
+	add := func(s *parser.Summary, file string) {
+		if s == nil {
+			return
+		}
+		total.Rows += s.Rows
+		total.Parsed += s.Parsed
+		total.Missing += s.Missing
+		for _, issue := range s.Issues {
+			issue.File = file
+			total.Issues = append(total.Issues, issue)
+		}
+	}
+
+	for _, rotated := range rotatedSiblings(path, from) {
+		s, err := scan(rotated)
+		add(s, filepath.Base(rotated))
+		if err != nil {
+			return total, err
+		}
+	}
+	s, err := scan(path)
+	add(s, "")
+	return total, err
+}
+
+func (w *csvWriter) Append(metrics ...types.PodMetric) error {
+	for _, m := range metrics {
+		if err := w.writer.Write(formatRecord(m)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *csvWriter) AppendNodes(nodes ...types.NodeMetric) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+	if w.nodesWriter == nil {
+		file, writer, err := openCSV(nodesPath(w.path), csvNodeHeader)
+		if err != nil {
+			return err
+		}
+		w.nodesFile, w.nodesWriter = file, writer
+	}
+	for _, n := range nodes {
+		if err := w.nodesWriter.Write(formatNodeRecord(n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *csvWriter) Flush() error {
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		return fmt.Errorf("ошибка записи в CSV: %v", err)
+	}
+	if w.nodesWriter != nil {
+		w.nodesWriter.Flush()
+		if err := w.nodesWriter.Error(); err != nil {
+			return fmt.Errorf("ошибка записи в CSV: %v", err)
+		}
+	}
+	return nil
+}
+
+func (w *csvWriter) Close() error {
+	if err := w.Flush(); err != nil {
+		w.file.Close()
+		if w.nodesFile != nil {
+			w.nodesFile.Close()
+		}
+		return err
+	}
+	if w.nodesFile != nil {
+		if err := syncAndClose(w.nodesFile); err != nil {
+			w.file.Close()
+			return err
+		}
+	}
+	return syncAndClose(w.file)
+}
+
+// formatRecord renders a sample as a CSV row, with N/A for values that were
+// not measured.
+func formatRecord(m types.PodMetric) []string {
+	cpu, mem := "N/A", "N/A"
+	if m.HasCPU {
+		cpu = fmt.Sprintf("%dm", m.CPU)
+	}
+	if m.HasMemory {
+		mem = fmt.Sprintf("%dMi", m.Memory)
+	}
+	return []string{
+		m.Timestamp.Format(time.RFC3339),
+		m.Namespace,
+		m.Pod,
+		m.Container,
+		cpu,
+		mem,
+		m.Status,
+		m.WorkloadKind,
+		m.WorkloadName,
+		m.Node,
+		types.FormatLabels(m.Labels),
+		formatQuantity(m.CPURequest, "m"),
+		formatQuantity(m.CPULimit, "m"),
+		formatQuantity(m.MemoryRequest, "Mi"),
+		formatQuantity(m.MemoryLimit, "Mi"),
+	}
+}
+
+// formatQuantity leaves unset (zero) requests and limits empty.
+func formatQuantity(value int64, suffix string) string {
+	if value == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d%s", value, suffix)
+}
+
+func formatNodeRecord(n types.NodeMetric) []string {
+	cpu, mem := "N/A", "N/A"
+	if n.HasUsage {
+		cpu = fmt.Sprintf("%dm", n.CPU)
+		mem = fmt.Sprintf("%dMi", n.Memory)
+	}
+	return []string{
+		n.Timestamp.Format(time.RFC3339),
+		n.Node,
+		types.FormatLabels(n.Labels),
+		formatQuantity(n.CPUAllocatable, "m"),
+		formatQuantity(n.MemoryAllocatable, "Mi"),
+		formatQuantity(n.CPUCapacity, "m"),
+		formatQuantity(n.MemoryCapacity, "Mi"),
+		cpu,
+		mem,
+		types.FormatLabels(n.Conditions),
+	}
+}
+
+type csvReader struct {
+	path string
+	opts parser.Options
+}
+
+func (r *csvReader) Scan(q Query, fn func(types.PodMetric) error) (*parser.Summary, error) {
+	return scanRotated(r.path, q.From, func(path string) (*parser.Summary, error) {
+		return parser.StreamCSVFile(path, r.opts, func(m types.PodMetric) error {
+			if !q.Match(m) {
+				return nil
+			}
+			return fn(m)
+		})
+	})
+}
+
+func (r *csvReader) ScanNodes(q Query, fn func(types.NodeMetric) error) (*parser.Summary, error) {
+	summary, err := scanRotated(nodesPath(r.path), q.From, func(path string) (*parser.Summary, error) {
+		return parser.StreamNodeCSVFile(path, r.opts, func(n types.NodeMetric) error {
+			if !q.MatchTime(n.Timestamp) {
+				return nil
+			}
+			return fn(n)
+		})
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return &parser.Summary{}, nil
+	}
+	return summary, err
+}
+
+func syncAndClose(file *os.File) error {
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("ошибка синхронизации файла: %v", err)
+	}
+	return file.Close()
+}
+
+func truncateFile(path string) error {
+	file, err := os.OpenFile(filepath.Clean(path), os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+func TestOpenCSVRotatesStaleHeader(t *testing.T) {
+	Log = io.Discard
+	defer func() { Log = os.Stderr }()
+
+	tests := []struct {
+		name    string
+		content string
+		rotated bool
+	}{
+		{name: "missing file"},
+		{name: "empty file", content: ""},
+		{name: "current header", content: strings.Join(csvHeader, ",") + "\n"},
+		{name: "old header", content: "Timestamp,Namespace,Pod,CPU,Memory,Status\n2024-01-01 00:00:00,default,web,10,20,OK\n", rotated: true},
+		{name: "no header", content: "2024-01-01 00:00:00,default,web,10,20,OK\n", rotated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "output.csv")
+			if tt.name != "missing file" {
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w, err := newCSVWriter(path)
+			if err != nil {
+				t.Fatalf("newCSVWriter: %v", err)
+			}
+			if err := w.Append(types.PodMetric{Timestamp: time.Now(), Namespace: "default", Pod: "web", Status: "OK"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			if lines[0] != strings.Join(csvHeader, ",") {
+				t.Errorf("header = %q, want current schema", lines[0])
+			}
+			for _, line := range lines[1:] {
+				if n := len(strings.Split(line, ",")); n < len(csvHeader) {
+					t.Errorf("row %q has %d fields, want %d", line, n, len(csvHeader))
+				}
+			}
+
+			matches, _ := filepath.Glob(filepath.Join(dir, "output.*.csv"))
+			if tt.rotated && len(matches) != 1 {
+				t.Fatalf("rotated files = %v, want one", matches)
+			}
+			if !tt.rotated && len(matches) != 0 {
+				t.Fatalf("unexpected rotation: %v", matches)
+			}
+			if tt.rotated {
+				old, _ := os.ReadFile(matches[0])
+				if string(old) != tt.content {
+					t.Errorf("rotated file content changed: %q", old)
+				}
+			}
+		})
+	}
+}
+
+func TestRotatedPath(t *testing.T) {
+	now := time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC)
+	tests := map[string]string{
+		"/data/output.csv":       "/data/output.20240305T140709.csv",
+		"/data/output.nodes.csv": "/data/output.nodes.20240305T140709.csv",
+		"metrics":                "metrics.20240305T140709",
+	}
+	for in, want := range tests {
+		if got := rotatedPath(in, now); got != want {
+			t.Errorf("rotatedPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestScanReadsRotatedFiles(t *testing.T) {
+	var log bytes.Buffer
+	Log = &log
+	defer func() { Log = os.Stderr }()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "output.csv")
+	old := "Timestamp,Namespace,Pod,CPU,Memory,Status\n2024-01-01T00:00:00Z,default,old,10m,20Mi,OK\n2024-01-01T00:00:10Z,default,old,bad,20Mi,OK\n"
+	if err := os.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := newCSVWriter(path)
+	if err != nil {
+		t.Fatalf("newCSVWriter: %v", err)
+	}
+	now := time.Now().Truncate(time.Second)
+	if err := w.Append(types.PodMetric{Timestamp: now, Namespace: "default", Pod: "new", Status: "OK", HasCPU: true, HasMemory: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := rotatedSiblings(path, time.Time{})
+	if len(rotated) != 1 {
+		t.Fatalf("rotated files = %v, want one", rotated)
+	}
+	if !strings.Contains(log.String(), rotated[0]) {
+		t.Errorf("rotation not logged: %q", log.String())
+	}
+
+	r := &csvReader{path: path}
+	metrics, summary, err := ReadAll(r, Query{})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	var pods []string
+	for _, m := range metrics {
+		pods = append(pods, m.Pod)
+	}
+	if strings.Join(pods, ",") != "old,new" {
+		t.Errorf("pods = %v, want the rotated rows first", pods)
+	}
+	if summary.Skipped() != 1 || summary.Issues[0].File != filepath.Base(rotated[0]) {
+		t.Errorf("issues = %v, want one in %s", summary.Issues, filepath.Base(rotated[0]))
+	}
+
+	metrics, _, err = ReadAll(r, Query{From: now.Add(time.Hour)})
+	if err != nil || len(metrics) != 0 {
+		t.Errorf("Scan after the rotation = %v, %v; want no rows", metrics, err)
+	}
+
+	if err := Reset("csv://" + path); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if rotated := rotatedSiblings(path, time.Time{}); len(rotated) != 0 {
+		t.Errorf("rotated files left after Reset: %v", rotated)
+	}
+}
+
+func TestRotatedSiblings(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"output.csv",
+		"output.20240305T140709.csv",
+		"output.20240101T000000.csv",
+		"output.nodes.csv",
+		"output.nodes.20240305T140709.csv",
+		"output.backup.csv",
+		"other.20240305T140709.csv",
+		"output.20240305T140709.jsonl",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	march := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		path string
+		from time.Time
+		want []string
+	}{
+		{"output.csv", time.Time{}, []string{"output.20240101T000000.csv", "output.20240305T140709.csv"}},
+		{"output.csv", march, []string{"output.20240305T140709.csv"}},
+		{"output.nodes.csv", time.Time{}, []string{"output.nodes.20240305T140709.csv"}},
+		{"missing.csv", time.Time{}, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, path := range rotatedSiblings(filepath.Join(dir, tt.path), tt.from) {
+			got = append(got, filepath.Base(path))
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("rotatedSiblings(%s, %v) = %v, want %v", tt.path, tt.from, got, tt.want)
+		}
+	}
+}
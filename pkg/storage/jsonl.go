@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nightness333/k8s-monitor/pkg/parser"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+// jsonlWriter stores one JSON object per sample per line. Node snapshots go
+// to a sibling file opened on the first AppendNodes.
+type jsonlWriter struct {
+	path  string
+	file  *jsonlFile
+	nodes *jsonlFile
+}
+
+type jsonlFile struct {
+	file    *os.File
+	buf     *bufio.Writer
+	encoder *json.Encoder
+}
+
+func newJSONLWriter(path string) (*jsonlWriter, error) {
+	file, err := openJSONL(path)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonlWriter{path: path, file: file}, nil
+}
+
+func openJSONL(path string) (*jsonlFile, error) {
+	file, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия файла: %v", err)
+	}
+	buf := bufio.NewWriter(file)
+	return &jsonlFile{file: file, buf: buf, encoder: json.NewEncoder(buf)}, nil
+}
+
+func (w *jsonlWriter) Append(metrics ...types.PodMetric) error {
+	for _, m := range metrics {
+		if err := w.file.encoder.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *jsonlWriter) AppendNodes(nodes ...types.NodeMetric) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+	if w.nodes == nil {
+		file, err := openJSONL(nodesPath(w.path))
+		if err != nil {
+			return err
+		}
+		w.nodes = file
+	}
+	for _, n := range nodes {
+		if err := w.nodes.encoder.Encode(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *jsonlWriter) Flush() error {
+	for _, f := range []*jsonlFile{w.file, w.nodes} {
+		if f == nil {
+			continue
+		}
+		if err := f.buf.Flush(); err != nil {
+			return fmt.Errorf("ошибка записи в JSONL: %v", err)
+		}
+	}
+	return nil
+}
+
+func (w *jsonlWriter) Close() error {
+	if err := w.Flush(); err != nil {
+		w.file.file.Close()
+		if w.nodes != nil {
+			w.nodes.file.Close()
+		}
+		return err
+	}
+	if w.nodes != nil {
+		if err := syncAndClose(w.nodes.file); err != nil {
+			w.file.file.Close()
+			return err
+		}
+	}
+	return syncAndClose(w.file.file)
+}
+
+type jsonlReader struct {
+	path string
+	opts parser.Options
+}
+
+func (r *jsonlReader) Scan(q Query, fn func(types.PodMetric) error) (*parser.Summary, error) {
+	summary := &parser.Summary{}
+	err := scanJSONL(r.path, r.opts, summary, func(m types.PodMetric) error {
+		if strings.HasPrefix(m.Status, types.EventPrefix) {
+			return nil
+		}
+
+		summary.Rows++
+		summary.Parsed++
+		m.HasCPU = m.Status == types.StatusOK
+		m.HasMemory = m.HasCPU
+		if !m.HasUsage() {
+			m.CPU, m.Memory = 0, 0
+			summary.Missing++
+		}
+		if !q.Match(m) {
+			return nil
+		}
+		return fn(m)
+	})
+	if err != nil {
+		return summary, err
+	}
+	return summary, nil
+}
+
+func (r *jsonlReader) ScanNodes(q Query, fn func(types.NodeMetric) error) (*parser.Summary, error) {
+	summary := &parser.Summary{}
+	err := scanJSONL(nodesPath(r.path), r.opts, summary, func(n types.NodeMetric) error {
+		summary.Rows++
+		summary.Parsed++
+		if !q.MatchTime(n.Timestamp) {
+			return nil
+		}
+		return fn(n)
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return &parser.Summary{}, nil
+	}
+	if err != nil {
+		return summary, err
+	}
+	return summary, nil
+}
+
+// scanJSONL decodes every non-empty line of path into a T and passes it to
+// fn. Lines that fail to decode are recorded in summary (or are an error in
+// strict mode).
+func scanJSONL[T any](path string, opts parser.Options, summary *parser.Summary, fn func(T) error) error {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var v T
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			issue := parser.Issue{Line: line, Reason: err.Error()}
+			if opts.Strict {
+				return errors.New(issue.String())
+			}
+			summary.Issues = append(summary.Issues, issue)
+			continue
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
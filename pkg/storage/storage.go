@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/parser"
+	"github.com/nightness333/k8s-monitor/pkg/types"
+)
+
+// Log receives notices about existing files a store changes on disk, such as
+// a CSV file with an old header that is moved aside.
+var Log io.Writer = os.Stderr
+
+// Writer appends samples to a backend. Flush makes buffered samples visible
+// to readers; Close also syncs them to stable storage.
+type Writer interface {
+	Append(metrics ...types.PodMetric) error
+	AppendNodes(nodes ...types.NodeMetric) error
+	Flush() error
+	Close() error
+}
+
+// Reader streams the samples matching q to fn in storage order and returns a
+// summary of rows that were skipped as invalid (or an error in strict mode).
+// An error returned by fn stops the scan.
+//
+// ScanNodes does the same for node snapshots, filtered by the time range of
+// q only. Stores without node data yield no nodes.
+type Reader interface {
+	Scan(q Query, fn func(types.PodMetric) error) (*parser.Summary, error)
+	ScanNodes(q Query, fn func(types.NodeMetric) error) (*parser.Summary, error)
+}
+
+// ReadAll collects the samples matching q into memory. Prefer Scan for
+// anything proportional to the history length.
+func ReadAll(r Reader, q Query) ([]types.PodMetric, *parser.Summary, error) {
+	var metrics []types.PodMetric
+	summary, err := r.Scan(q, func(m types.PodMetric) error {
+		metrics = append(metrics, m)
+		return nil
+	})
+	if err != nil {
+		return nil, summary, err
+	}
+	return metrics, summary, nil
+}
+
+// Query selects samples by time range, namespace and pod. Zero values match
+// everything; To is exclusive.
+type Query struct {
+	From       time.Time
+	To         time.Time
+	Namespaces []string
+	Pod        string
+}
+
+func (q Query) Match(m types.PodMetric) bool {
+	if !q.MatchTime(m.Timestamp) {
+		return false
+	}
+	if q.Pod != "" && m.Pod != q.Pod {
+		return false
+	}
+	if len(q.Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range q.Namespaces {
+		if m.Namespace == ns {
+			return true
+		}
+	}
+	return false
+}
+
+func (q Query) MatchTime(t time.Time) bool {
+	if !q.From.IsZero() && t.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !t.Before(q.To) {
+		return false
+	}
+	return true
+}
+
+// Location is a parsed --store URI: "csv:///data/output.csv",
+// "jsonl:///data/metrics.jsonl" or a plain path, in which case the backend is
+// picked by file extension (.jsonl/.ndjson, otherwise CSV).
+//
+// Node snapshots are kept next to the samples in a sibling file with the
+// same format, see nodesPath.
+type Location struct {
+	Scheme string
+	Path   string
+}
+
+const (
+	SchemeCSV   = "csv"
+	SchemeJSONL = "jsonl"
+)
+
+func ParseURI(uri string) (Location, error) {
+	if uri == "" {
+		return Location{}, fmt.Errorf("не указано хранилище")
+	}
+
+	scheme, path, found := strings.Cut(uri, "://")
+	if !found {
+		path = uri
+		switch strings.ToLower(filepath.Ext(uri)) {
+		case ".jsonl", ".ndjson":
+			scheme = SchemeJSONL
+		default:
+			scheme = SchemeCSV
+		}
+	}
+
+	switch scheme {
+	case SchemeCSV, SchemeJSONL:
+	default:
+		return Location{}, fmt.Errorf("неподдерживаемое хранилище: %s", scheme)
+	}
+	if path == "" {
+		return Location{}, fmt.Errorf("не указан путь хранилища: %s", uri)
+	}
+	return Location{Scheme: scheme, Path: path}, nil
+}
+
+func OpenWriter(uri string) (Writer, error) {
+	loc, err := ParseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	switch loc.Scheme {
+	case SchemeJSONL:
+		return newJSONLWriter(loc.Path)
+	default:
+		return newCSVWriter(loc.Path)
+	}
+}
+
+func OpenReader(uri string, opts parser.Options) (Reader, error) {
+	loc, err := ParseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	switch loc.Scheme {
+	case SchemeJSONL:
+		return &jsonlReader{path: loc.Path, opts: opts}, nil
+	default:
+		return &csvReader{path: loc.Path, opts: opts}, nil
+	}
+}
+
+// Reset removes all stored samples, including rotated CSV files. It returns
+// an error wrapping os.ErrNotExist when there is nothing to reset.
+func Reset(uri string) error {
+	loc, err := ParseURI(uri)
+	if err != nil {
+		return err
+	}
+	if err := truncateFile(loc.Path); err != nil {
+		return err
+	}
+	if err := truncateFile(nodesPath(loc.Path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if loc.Scheme != SchemeCSV {
+		return nil
+	}
+	for _, path := range []string{loc.Path, nodesPath(loc.Path)} {
+		for _, rotated := range rotatedSiblings(path, time.Time{}) {
+			if err := os.Remove(rotated); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nodesPath returns the node snapshot file of a store:
+// "/data/output.csv" -> "/data/output.nodes.csv".
+func nodesPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".nodes" + ext
+}
@@ -1,23 +1,214 @@
 package types
 
-import "time"
+import (
+	"math"
+	"time"
+
+	"github.com/nightness333/k8s-monitor/pkg/stats"
+)
+
+const (
+	WorkloadPod = "Pod"
+
+	StatusOK        = "OK"
+	StatusNoMetrics = "NO_METRICS"
+	// StatusSkipPrefix starts the status of pods that are not running,
+	// followed by their phase.
+	StatusSkipPrefix = "SKIP: status="
+	EventPrefix      = "EVENT: "
+)
 
 type PodMetric struct {
-	Timestamp time.Time
-	Namespace string
-	Pod       string
-	CPU       int64
-	Memory    int64
-	Status    string
+	Timestamp    time.Time `json:"timestamp"`
+	Namespace    string    `json:"namespace"`
+	Pod          string    `json:"pod"`
+	Container    string    `json:"container,omitempty"`
+	CPU          int64     `json:"cpu"`
+	Memory       int64     `json:"memory"`
+	Status       string    `json:"status"`
+	WorkloadKind string    `json:"workloadKind,omitempty"`
+	WorkloadName string    `json:"workloadName,omitempty"`
+	Node         string    `json:"node,omitempty"`
+
+	// Configured container resources (m, Mi) at sampling time; zero when
+	// not set or not recorded.
+	CPURequest    int64 `json:"cpuRequest,omitempty"`
+	CPULimit      int64 `json:"cpuLimit,omitempty"`
+	MemoryRequest int64 `json:"memoryRequest,omitempty"`
+	MemoryLimit   int64 `json:"memoryLimit,omitempty"`
+
+	// Labels are the captured pod (or namespace) labels, see monitor
+	// --capture-labels.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// HasCPU and HasMemory are false when the value was not measured
+	// (N/A, ERROR, SKIP rows); CPU and Memory are zero then and must not be
+	// used in statistics.
+	HasCPU    bool `json:"-"`
+	HasMemory bool `json:"-"`
+}
+
+func (m PodMetric) HasUsage() bool {
+	return m.HasCPU && m.HasMemory
+}
+
+// Finished reports whether the sample is of a pod that has succeeded or
+// failed; such a pod no longer holds its requests on the node.
+func (m PodMetric) Finished() bool {
+	return m.Status == StatusSkipPrefix+"Succeeded" || m.Status == StatusSkipPrefix+"Failed"
+}
+
+func (m PodMetric) Resources() ContainerResources {
+	return ContainerResources{
+		Requests: PodConfiguration{CPU: m.CPURequest, Memory: m.MemoryRequest},
+		Limits:   PodConfiguration{CPU: m.CPULimit, Memory: m.MemoryLimit},
+	}
 }
 
+// Workload returns the owning workload of the sample, falling back to the
+// pod itself for bare pods and for data recorded without owner information.
+func (m PodMetric) Workload() Workload {
+	if m.WorkloadKind == "" || m.WorkloadName == "" {
+		return Workload{Namespace: m.Namespace, Kind: WorkloadPod, Name: m.Pod}
+	}
+	return Workload{Namespace: m.Namespace, Kind: m.WorkloadKind, Name: m.WorkloadName}
+}
+
+type Workload struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+}
+
+func (w Workload) String() string {
+	if w.Kind == WorkloadPod {
+		return w.Namespace + "/" + w.Name
+	}
+	return w.Namespace + "/" + w.Kind + "/" + w.Name
+}
+
+// WorkloadAPIVersion returns the API group version of a workload kind.
+func WorkloadAPIVersion(kind string) string {
+	switch kind {
+	case WorkloadPod:
+		return "v1"
+	case "Job", "CronJob":
+		return "batch/v1"
+	default:
+		return "apps/v1"
+	}
+}
+
+// PodConfiguration holds CPU (m) and memory (Mi) quantities.
 type PodConfiguration struct {
-	CPU    int64
-	Memory int64
+	CPU    int64 `json:"cpu"`
+	Memory int64 `json:"memory"`
+}
+
+type ContainerResources struct {
+	Requests PodConfiguration `json:"requests"`
+	Limits   PodConfiguration `json:"limits"`
 }
 
 type PodStats struct {
-	CPU    []int64
-	Memory []int64
-	Status string
+	Workload   Workload
+	CPU        Series
+	Memory     Series
+	Status     string
+	Pods       map[string]struct{}
+	Containers map[string]*ContainerStats
+
+	// First and Last are the first and last sample times; Intervals holds
+	// the seconds between consecutive sample times, for coverage and gaps.
+	First     time.Time
+	Last      time.Time
+	Intervals Series
+}
+
+// Span is the time covered by the samples.
+func (s *PodStats) Span() time.Duration {
+	return s.Last.Sub(s.First)
+}
+
+// Coverage estimates the share of Span that has samples: the intervals at
+// the usual (median) sampling step against the whole span. Gaps lower it.
+func (s *PodStats) Coverage() float64 {
+	span := s.Span().Seconds()
+	if span <= 0 {
+		return 0
+	}
+	covered := float64(s.Intervals.Count) * float64(s.Intervals.Median())
+	if covered >= span {
+		return 1
+	}
+	return covered / span
+}
+
+type ContainerStats struct {
+	CPU    Series
+	Memory Series
+}
+
+// Series is a running summary of samples, so that statistics over long
+// histories do not need to keep the samples themselves. Percentiles come
+// from a streaming sketch unless the series was created with NewSeries(true),
+// in which case the samples are kept and percentiles are exact.
+type Series struct {
+	Count int64
+	Sum   int64
+	Max   int64
+
+	moments stats.Moments
+	sketch  *stats.Sketch
+	exact   bool
+	values  []int64
+}
+
+func NewSeries(exact bool) Series {
+	return Series{exact: exact}
+}
+
+func (s *Series) Add(v int64) {
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	s.Sum += v
+	s.moments.Add(float64(v))
+
+	if s.exact {
+		s.values = append(s.values, v)
+		return
+	}
+	if s.sketch == nil {
+		s.sketch = stats.NewSketch(stats.DefaultAccuracy)
+	}
+	s.sketch.Add(v)
+}
+
+func (s Series) Avg() int64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / s.Count
+}
+
+// Percentile returns the p-th percentile (0..100), rounded to an integer.
+func (s Series) Percentile(p float64) int64 {
+	switch {
+	case s.Count == 0:
+		return 0
+	case s.exact:
+		return int64(math.Round(stats.Percentile(s.values, p)))
+	default:
+		return int64(math.Round(s.sketch.Quantile(p)))
+	}
+}
+
+func (s Series) Median() int64 {
+	return s.Percentile(50)
+}
+
+func (s Series) StdDev() float64 {
+	return s.moments.StdDev()
 }
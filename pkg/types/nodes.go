@@ -0,0 +1,81 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NodeMetric is a per-tick snapshot of a cluster node. Resources are in
+// millicores and MiB; zero means not recorded.
+type NodeMetric struct {
+	Timestamp         time.Time         `json:"timestamp"`
+	Node              string            `json:"node"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	CPUCapacity       int64             `json:"cpuCapacity,omitempty"`
+	MemoryCapacity    int64             `json:"memoryCapacity,omitempty"`
+	CPUAllocatable    int64             `json:"cpuAllocatable,omitempty"`
+	MemoryAllocatable int64             `json:"memoryAllocatable,omitempty"`
+
+	// Usage from NodeMetrics; HasUsage is false when it was not available.
+	CPU      int64 `json:"cpu,omitempty"`
+	Memory   int64 `json:"memory,omitempty"`
+	HasUsage bool  `json:"hasUsage,omitempty"`
+
+	// Conditions maps condition types to their status, e.g. Ready=True.
+	Conditions map[string]string `json:"conditions,omitempty"`
+}
+
+const NodeReady = "Ready"
+
+// Problems lists the conditions that need attention: Ready that is not True
+// and any other condition (MemoryPressure, DiskPressure, ...) that is True.
+func (n NodeMetric) Problems() []string {
+	var problems []string
+	if status, ok := n.Conditions[NodeReady]; ok && status != "True" {
+		problems = append(problems, "NotReady")
+	}
+	keys := make([]string, 0, len(n.Conditions))
+	for k := range n.Conditions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k != NodeReady && n.Conditions[k] == "True" {
+			problems = append(problems, k)
+		}
+	}
+	return problems
+}
+
+// FormatLabels renders labels (or any string map, such as node conditions) as "k1=v1,k2=v2" sorted by key. Label values
+// cannot contain commas or '=', so the result round-trips via ParseLabels.
+func FormatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func ParseLabels(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		k, v, found := strings.Cut(pair, "=")
+		if !found || k == "" {
+			return nil, fmt.Errorf("неверная метка %q", pair)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
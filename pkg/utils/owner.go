@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nightness333/k8s-monitor/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// WorkloadResolver walks pod owner references up to the top-level workload
+// (ReplicaSet→Deployment, Job→CronJob, StatefulSet, DaemonSet). Intermediate
+// owners are cached, so one resolver should live for the whole monitor run.
+// It is safe for concurrent use.
+type WorkloadResolver struct {
+	clientset kubernetes.Interface
+	mu        sync.Mutex
+	cache     map[string]types.Workload
+}
+
+func NewWorkloadResolver(clientset kubernetes.Interface) *WorkloadResolver {
+	return &WorkloadResolver{
+		clientset: clientset,
+		cache:     make(map[string]types.Workload),
+	}
+}
+
+func (r *WorkloadResolver) Resolve(ctx context.Context, pod *corev1.Pod) types.Workload {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return types.Workload{Namespace: pod.Namespace, Kind: types.WorkloadPod, Name: pod.Name}
+	}
+
+	switch owner.Kind {
+	case "ReplicaSet", "Job":
+		return r.resolveOwner(ctx, pod.Namespace, owner.Kind, owner.Name)
+	default:
+		return types.Workload{Namespace: pod.Namespace, Kind: owner.Kind, Name: owner.Name}
+	}
+}
+
+func (r *WorkloadResolver) resolveOwner(ctx context.Context, namespace, kind, name string) types.Workload {
+	key := namespace + "/" + kind + "/" + name
+	r.mu.Lock()
+	w, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok {
+		return w
+	}
+
+	workload := types.Workload{Namespace: namespace, Kind: kind, Name: name}
+
+	var meta *metav1.ObjectMeta
+	switch kind {
+	case "ReplicaSet":
+		rs, err := r.clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return workload
+		}
+		meta = &rs.ObjectMeta
+	case "Job":
+		job, err := r.clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return workload
+		}
+		meta = &job.ObjectMeta
+	}
+
+	if owner := metav1.GetControllerOf(meta); owner != nil &&
+		(owner.Kind == "Deployment" || owner.Kind == "CronJob") {
+		workload.Kind = owner.Kind
+		workload.Name = owner.Name
+	}
+
+	r.mu.Lock()
+	r.cache[key] = workload
+	r.mu.Unlock()
+	return workload
+}
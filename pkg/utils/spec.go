@@ -2,14 +2,17 @@ package utils
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/nightness333/k8s-monitor/pkg/types"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 )
 
-func GetPodLimits(clientset *kubernetes.Clientset, namespace, podName string) (*types.PodConfiguration, error) {
-	pod, err := clientset.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+func GetPodLimits(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName string) (*types.PodConfiguration, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -24,8 +27,8 @@ func GetPodLimits(clientset *kubernetes.Clientset, namespace, podName string) (*
 	return limits, nil
 }
 
-func GetPodRequests(clientset *kubernetes.Clientset, namespace, podName string) (*types.PodConfiguration, error) {
-	pod, err := clientset.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+func GetPodRequests(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName string) (*types.PodConfiguration, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -39,3 +42,106 @@ func GetPodRequests(clientset *kubernetes.Clientset, namespace, podName string)
 	}
 	return limits, nil
 }
+
+func GetContainerResources(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName string) (map[string]types.ContainerResources, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return ContainerResourcesFromSpec(pod.Spec), nil
+}
+
+func ContainerResourcesFromSpec(spec corev1.PodSpec) map[string]types.ContainerResources {
+	resources := make(map[string]types.ContainerResources, len(spec.Containers))
+	for _, container := range spec.Containers {
+		resources[container.Name] = types.ContainerResources{
+			Requests: types.PodConfiguration{
+				CPU:    container.Resources.Requests.Cpu().MilliValue(),
+				Memory: container.Resources.Requests.Memory().Value() / (1024 * 1024),
+			},
+			Limits: types.PodConfiguration{
+				CPU:    container.Resources.Limits.Cpu().MilliValue(),
+				Memory: container.Resources.Limits.Memory().Value() / (1024 * 1024),
+			},
+		}
+	}
+	return resources
+}
+
+// GetWorkloadContainerResources returns the configured resources of every
+// container in the workload's pod template (or in the pod itself for bare
+// pods).
+func GetWorkloadContainerResources(ctx context.Context, clientset kubernetes.Interface, workload types.Workload) (map[string]types.ContainerResources, error) {
+	spec, err := GetWorkloadPodSpec(ctx, clientset, workload)
+	if err != nil {
+		return nil, err
+	}
+	return ContainerResourcesFromSpec(*spec), nil
+}
+
+func GetWorkloadPodSpec(ctx context.Context, clientset kubernetes.Interface, workload types.Workload) (*corev1.PodSpec, error) {
+	_, spec, err := GetWorkloadObject(ctx, clientset, workload)
+	return spec, err
+}
+
+// GetWorkloadObject fetches the workload with its TypeMeta filled in and
+// returns it together with a pointer to its pod template spec, so changes
+// to the spec are reflected in the object.
+func GetWorkloadObject(ctx context.Context, clientset kubernetes.Interface, workload types.Workload) (runtime.Object, *corev1.PodSpec, error) {
+	ns, name := workload.Namespace, workload.Name
+	typeMeta := metav1.TypeMeta{Kind: workload.Kind, APIVersion: types.WorkloadAPIVersion(workload.Kind)}
+
+	switch workload.Kind {
+	case types.WorkloadPod:
+		pod, err := clientset.CoreV1().Pods(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		pod.TypeMeta = typeMeta
+		return pod, &pod.Spec, nil
+	case "Deployment":
+		obj, err := clientset.AppsV1().Deployments(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		obj.TypeMeta = typeMeta
+		return obj, &obj.Spec.Template.Spec, nil
+	case "StatefulSet":
+		obj, err := clientset.AppsV1().StatefulSets(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		obj.TypeMeta = typeMeta
+		return obj, &obj.Spec.Template.Spec, nil
+	case "DaemonSet":
+		obj, err := clientset.AppsV1().DaemonSets(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		obj.TypeMeta = typeMeta
+		return obj, &obj.Spec.Template.Spec, nil
+	case "ReplicaSet":
+		obj, err := clientset.AppsV1().ReplicaSets(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		obj.TypeMeta = typeMeta
+		return obj, &obj.Spec.Template.Spec, nil
+	case "Job":
+		obj, err := clientset.BatchV1().Jobs(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		obj.TypeMeta = typeMeta
+		return obj, &obj.Spec.Template.Spec, nil
+	case "CronJob":
+		obj, err := clientset.BatchV1().CronJobs(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		obj.TypeMeta = typeMeta
+		return obj, &obj.Spec.JobTemplate.Spec.Template.Spec, nil
+	default:
+		return nil, nil, fmt.Errorf("неподдерживаемый тип нагрузки: %s", workload.Kind)
+	}
+}